@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiError is an error response of the pupervisor API.
+type apiError struct {
+	Status  int
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Status == http.StatusUnauthorized {
+		msg += " (use -token or -user, or set PUPERVISOR_TOKEN)"
+	}
+	return msg
+}
+
+// client talks to the REST API over TCP or a local Unix socket.
+type client struct {
+	addr     string
+	base     string
+	http     *http.Client
+	timeout  time.Duration
+	token    string
+	user     string
+	password string
+}
+
+// newClient creates a client for addr, either an http(s) URL or
+// unix:///path/to/socket.
+func newClient(addr string, timeout time.Duration) (*client, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL %q: %w", addr, err)
+	}
+
+	c := &client{addr: addr, http: &http.Client{}, timeout: timeout}
+	switch u.Scheme {
+	case "http", "https":
+		c.base = strings.TrimRight(addr, "/")
+	case "unix":
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		if path == "" {
+			return nil, fmt.Errorf("invalid server URL %q: missing socket path", addr)
+		}
+		c.base = "http://unix"
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	default:
+		return nil, fmt.Errorf("invalid server URL %q: scheme must be http, https or unix", addr)
+	}
+	return c, nil
+}
+
+func (c *client) newRequest(ctx context.Context, method, path string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.user != "":
+		req.SetBasicAuth(c.user, c.password)
+	}
+	return req, nil
+}
+
+// do sends a request and decodes the JSON response into out, if not nil.
+func (c *client) do(method, path string, out interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, method, path)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("no response from pupervisor within %s", c.timeout)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends req and reports connection failures with the server address.
+func (c *client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && req.Context().Err() == nil {
+		return nil, fmt.Errorf("cannot reach pupervisor at %s: %w", c.addr, urlErr.Err)
+	}
+	return resp, err
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	apiErr := &apiError{Status: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = json.Unmarshal(body, apiErr)
+	return apiErr
+}
+
+// stream reads a Server-Sent Events stream and calls fn with the data of
+// every message event. It returns when the server sends an end event, the
+// connection closes or ctx is cancelled.
+func (c *client) stream(ctx context.Context, path string, fn func(data []byte) error) error {
+	req, err := c.newRequest(ctx, http.MethodGet, path)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	event := ""
+	var data []byte
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// A blank line dispatches the event
+			if event == "end" {
+				return nil
+			}
+			if data != nil {
+				if err := fn(data); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"pupervisor/internal/models"
+)
+
+// controller runs commands against the API.
+type controller struct {
+	client *client
+	json   bool
+	out    io.Writer
+}
+
+type command struct {
+	name  string
+	usage string
+	help  string
+	run   func(ctl *controller, args []string) error
+}
+
+var commands = []command{
+	{"status", "status [name...]", "Show process status", (*controller).status},
+	{"start", "start <name|group:name|all>...", "Start processes", actionCommand("start", "started")},
+	{"stop", "stop <name|group:name|all>...", "Stop processes", actionCommand("stop", "stopped")},
+	{"restart", "restart <name|group:name|all>...", "Restart processes", actionCommand("restart", "restarted")},
+	{"tail", "tail [-f] [-n lines] <name> [stdout|stderr]", "Show process output", (*controller).tail},
+	{"crashes", "crashes [-n count] [name]", "Show crash history", (*controller).crashes},
+	{"reload", "reload", "Reload the configuration file and apply changes", (*controller).reload},
+	{"avail", "avail", "List configured processes", (*controller).avail},
+	{"help", "help", "Show this help", nil},
+}
+
+// run executes a single command line.
+func (ctl *controller) run(args []string) error {
+	if args[0] == "help" {
+		printCommands(ctl.out)
+		return nil
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(ctl, args[1:])
+		}
+	}
+	return usagef("unknown command %q, see help", args[0])
+}
+
+// printJSON writes v as indented JSON.
+func (ctl *controller) printJSON(v interface{}) error {
+	enc := json.NewEncoder(ctl.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (ctl *controller) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(ctl.out, 0, 0, 2, ' ', 0)
+}
+
+func (ctl *controller) processes() ([]models.Process, error) {
+	var processes []models.Process
+	if err := ctl.client.do(http.MethodGet, "/api/processes", &processes); err != nil {
+		return nil, err
+	}
+	return processes, nil
+}
+
+// selectProcesses returns the processes matching names: process names,
+// program names (all their instances), group:name or name:* for groups.
+// No names select every process.
+func selectProcesses(processes []models.Process, names []string) ([]models.Process, error) {
+	if len(names) == 0 {
+		return processes, nil
+	}
+
+	var selected []models.Process
+	seen := make(map[string]bool)
+	for _, name := range names {
+		group, isGroup := groupName(name)
+		found := false
+		for _, p := range processes {
+			match := p.Name == name || p.Program == name || name == "all"
+			if isGroup {
+				match = p.Group == group
+			}
+			if match {
+				found = true
+				if !seen[p.Name] {
+					seen[p.Name] = true
+					selected = append(selected, p)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no such process: %s", name)
+		}
+	}
+	return selected, nil
+}
+
+// groupName parses group:name and name:* group selectors.
+func groupName(name string) (string, bool) {
+	if group, ok := strings.CutPrefix(name, "group:"); ok {
+		return group, true
+	}
+	if group, ok := strings.CutSuffix(name, ":*"); ok {
+		return group, true
+	}
+	return "", false
+}
+
+func (ctl *controller) status(args []string) error {
+	processes, err := ctl.processes()
+	if err != nil {
+		return err
+	}
+	selected, err := selectProcesses(processes, args)
+	if err != nil {
+		return err
+	}
+
+	if ctl.json {
+		if selected == nil {
+			selected = []models.Process{}
+		}
+		if err := ctl.printJSON(selected); err != nil {
+			return err
+		}
+	} else {
+		tw := ctl.table()
+		fmt.Fprintln(tw, "NAME\tSTATE\tPID\tUPTIME\tCPU\tMEMORY")
+		for _, p := range selected {
+			pid := "-"
+			if p.Pid > 0 {
+				pid = strconv.Itoa(p.Pid)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Name, p.Status, pid, p.Uptime, p.CPU, p.Memory)
+		}
+		tw.Flush()
+	}
+
+	for _, p := range selected {
+		if p.Status != models.StateRunning && p.Status != models.StateSucceeded {
+			return errNotRunning
+		}
+	}
+	return nil
+}
+
+// actionResult is the outcome of start, stop or restart for one target.
+type actionResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// actionCommand returns a command that applies verb (start, stop or
+// restart) to processes and groups. Groups are handled by the server so that
+// their priorities and dependencies are respected. With "all", processes
+// that are already in the requested state are skipped.
+func actionCommand(verb, done string) func(ctl *controller, args []string) error {
+	return func(ctl *controller, args []string) error {
+		if len(args) == 0 {
+			return usagef("%s needs a process name, group:name or all", verb)
+		}
+
+		processes, err := ctl.processes()
+		if err != nil {
+			return err
+		}
+
+		var results []actionResult
+		failed := false
+		report := func(r actionResult) {
+			if r.Error != "" {
+				failed = true
+			}
+			if ctl.json {
+				results = append(results, r)
+				return
+			}
+			switch {
+			case r.Error != "":
+				fmt.Fprintf(ctl.out, "%s: ERROR (%s)\n", r.Name, r.Error)
+			case r.Message != "":
+				fmt.Fprintf(ctl.out, "%s: %s\n", r.Name, r.Message)
+			default:
+				fmt.Fprintf(ctl.out, "%s: %s\n", r.Name, r.Status)
+			}
+		}
+
+		for _, name := range args {
+			if group, ok := groupName(name); ok {
+				var resp struct {
+					Succeeded int    `json:"succeeded"`
+					Failed    int    `json:"failed"`
+					Message   string `json:"message"`
+				}
+				err := ctl.client.do(http.MethodPost, "/api/groups/"+url.PathEscape(group)+"/"+verb, &resp)
+				switch {
+				case err != nil:
+					report(actionResult{Name: name, Status: "error", Error: err.Error()})
+				case resp.Failed > 0:
+					report(actionResult{Name: name, Status: "error", Error: resp.Message})
+				default:
+					report(actionResult{Name: name, Status: done, Message: resp.Message})
+				}
+				continue
+			}
+
+			selected, err := selectProcesses(processes, []string{name})
+			if err != nil {
+				report(actionResult{Name: name, Status: "error", Error: err.Error()})
+				continue
+			}
+			for _, p := range selected {
+				if name == "all" && skipForAll(verb, p.Status) {
+					continue
+				}
+				err := ctl.client.do(http.MethodPost, "/api/processes/"+url.PathEscape(p.Name)+"/"+verb, nil)
+				if err != nil {
+					report(actionResult{Name: p.Name, Status: "error", Error: err.Error()})
+					continue
+				}
+				report(actionResult{Name: p.Name, Status: done})
+			}
+		}
+
+		if ctl.json {
+			if results == nil {
+				results = []actionResult{}
+			}
+			if err := ctl.printJSON(results); err != nil {
+				return err
+			}
+		}
+		if failed {
+			return errFailed
+		}
+		return nil
+	}
+}
+
+// skipForAll reports whether "verb all" leaves a process in state alone.
+func skipForAll(verb string, state models.State) bool {
+	switch verb {
+	case "start":
+		return state.IsActive()
+	case "stop":
+		return !state.IsActive()
+	}
+	return false
+}
+
+func (ctl *controller) tail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	follow := fs.Bool("f", false, "follow")
+	lines := fs.Int("n", 20, "lines")
+	if err := fs.Parse(args); err != nil {
+		return usagef("tail: %v", err)
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return usagef("usage: tail [-f] [-n lines] <name> [stdout|stderr]")
+	}
+
+	query := url.Values{}
+	query.Set("backlog", strconv.Itoa(*lines))
+	if fs.NArg() == 2 {
+		query.Set("stream", fs.Arg(1))
+	}
+	if !*follow {
+		query.Set("follow", "false")
+	}
+	path := "/api/processes/" + url.PathEscape(fs.Arg(0)) + "/logs/stream?" + query.Encode()
+
+	// Ctrl-C ends tail -f; in the shell it returns to the prompt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return ctl.client.stream(ctx, path, func(data []byte) error {
+		if ctl.json {
+			_, err := fmt.Fprintf(ctl.out, "%s\n", data)
+			return err
+		}
+		var line models.OutputLine
+		if err := json.Unmarshal(data, &line); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(ctl.out, line.Line)
+		return err
+	})
+}
+
+// crash is the part of a crash record shown by crashes.
+type crash struct {
+	ProcessName string    `json:"process_name"`
+	ExitCode    int       `json:"exit_code"`
+	Signal      string    `json:"signal,omitempty"`
+	ErrorMsg    string    `json:"error_message,omitempty"`
+	CrashedAt   time.Time `json:"crashed_at"`
+	Uptime      string    `json:"uptime"`
+	Reason      string    `json:"reason"`
+}
+
+func (ctl *controller) crashes(args []string) error {
+	fs := flag.NewFlagSet("crashes", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	count := fs.Int("n", 20, "count")
+	if err := fs.Parse(args); err != nil {
+		return usagef("crashes: %v", err)
+	}
+	if fs.NArg() > 1 {
+		return usagef("usage: crashes [-n count] [name]")
+	}
+
+	path := "/api/crashes"
+	if fs.NArg() == 1 {
+		path += "/" + url.PathEscape(fs.Arg(0))
+	}
+
+	var records []json.RawMessage
+	if err := ctl.client.do(http.MethodGet, path, &records); err != nil {
+		return err
+	}
+	if *count >= 0 && len(records) > *count {
+		records = records[:*count]
+	}
+	if ctl.json {
+		if records == nil {
+			records = []json.RawMessage{}
+		}
+		return ctl.printJSON(records)
+	}
+
+	tw := ctl.table()
+	fmt.Fprintln(tw, "TIME\tNAME\tREASON\tEXIT\tSIGNAL\tUPTIME\tERROR")
+	for _, raw := range records {
+		var c crash
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return err
+		}
+		signal := c.Signal
+		if signal == "" {
+			signal = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", c.CrashedAt.Local().Format("2006-01-02 15:04:05"),
+			c.ProcessName, c.Reason, c.ExitCode, signal, c.Uptime, c.ErrorMsg)
+	}
+	return tw.Flush()
+}
+
+func (ctl *controller) reload(args []string) error {
+	if len(args) > 0 {
+		return usagef("reload takes no arguments")
+	}
+
+	var result models.ReloadResult
+	if err := ctl.client.do(http.MethodPost, "/api/config/reload", &result); err != nil {
+		return err
+	}
+	if ctl.json {
+		return ctl.printJSON(result)
+	}
+
+	if len(result.Added)+len(result.Removed)+len(result.Changed) == 0 {
+		fmt.Fprintln(ctl.out, "No changes")
+		return nil
+	}
+	for _, change := range []struct {
+		label    string
+		programs []string
+	}{
+		{"added", result.Added},
+		{"changed", result.Changed},
+		{"removed", result.Removed},
+	} {
+		for _, program := range change.programs {
+			fmt.Fprintf(ctl.out, "%s: %s\n", program, change.label)
+		}
+	}
+	return nil
+}
+
+func (ctl *controller) avail(args []string) error {
+	if len(args) > 0 {
+		return usagef("avail takes no arguments")
+	}
+
+	processes, err := ctl.processes()
+	if err != nil {
+		return err
+	}
+
+	type availability struct {
+		Name      string `json:"name"`
+		Program   string `json:"program"`
+		Group     string `json:"group"`
+		InUse     bool   `json:"in_use"`
+		AutoStart bool   `json:"autostart"`
+		Priority  int    `json:"priority"`
+	}
+	list := make([]availability, 0, len(processes))
+	for _, p := range processes {
+		list = append(list, availability{p.Name, p.Program, p.Group, p.Status.IsActive(), p.AutoStart, p.Priority})
+	}
+	if ctl.json {
+		return ctl.printJSON(list)
+	}
+
+	tw := ctl.table()
+	fmt.Fprintln(tw, "NAME\tGROUP\tSTATE\tSTART\tPRIORITY")
+	for _, a := range list {
+		inUse, start := "avail", "manual"
+		if a.InUse {
+			inUse = "in use"
+		}
+		if a.AutoStart {
+			start = "auto"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", a.Name, a.Group, inUse, start, a.Priority)
+	}
+	return tw.Flush()
+}
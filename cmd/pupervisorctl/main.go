@@ -0,0 +1,156 @@
+// Command pupervisorctl controls a running pupervisor through its REST API,
+// over TCP or a local Unix socket. Without a command it starts an
+// interactive shell.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Exit codes
+const (
+	exitOK         = 0
+	exitFailure    = 1 // an action failed or the server could not be reached
+	exitUsage      = 2 // invalid command line
+	exitNotRunning = 3 // status: a selected process is not running
+)
+
+const defaultURL = "http://localhost:8080"
+
+// usageError is returned for invalid command arguments.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// errNotRunning is returned by status when a selected process is not running.
+// The table already shows which, so it is not printed.
+var errNotRunning = errors.New("not all processes are running")
+
+// errFailed is returned when some actions failed. Their errors were already
+// printed per process.
+var errFailed = errors.New("some actions failed")
+
+func main() {
+	flag.Usage = usage
+	serverURL := flag.String("url", envOr("PUPERVISOR_URL", defaultURL), "Server URL, http(s)://host:port or unix:///path/to/socket (env PUPERVISOR_URL)")
+	token := flag.String("token", os.Getenv("PUPERVISOR_TOKEN"), "API token (env PUPERVISOR_TOKEN)")
+	user := flag.String("user", os.Getenv("PUPERVISOR_USER"), "User for basic auth, as name or name:password; the password may also be set in PUPERVISOR_PASSWORD (env PUPERVISOR_USER)")
+	jsonOutput := flag.Bool("json", false, "Print JSON instead of tables")
+	timeout := flag.Duration("timeout", 60*time.Second, "Timeout for API requests, except tail -f")
+	flag.Parse()
+
+	c, err := newClient(*serverURL, *timeout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitUsage)
+	}
+	c.token = *token
+	if *user != "" {
+		name, password, ok := strings.Cut(*user, ":")
+		if !ok {
+			password = os.Getenv("PUPERVISOR_PASSWORD")
+		}
+		c.user, c.password = name, password
+	}
+
+	ctl := &controller{client: c, json: *jsonOutput, out: os.Stdout}
+	if flag.NArg() == 0 {
+		ctl.shell(os.Stdin)
+		return
+	}
+	os.Exit(exitCode(ctl.run(flag.Args())))
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: pupervisorctl [options] [command [args]]\n\n")
+	fmt.Fprintf(out, "Without a command, pupervisorctl starts an interactive shell.\n\nCommands:\n")
+	printCommands(out)
+	fmt.Fprintf(out, "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// exitCode prints err, unless it was already reported, and maps it to the
+// process exit code.
+func exitCode(err error) int {
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errNotRunning):
+		return exitNotRunning
+	case errors.Is(err, errFailed):
+		return exitFailure
+	case errors.As(err, &usageErr):
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitUsage
+	default:
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailure
+	}
+}
+
+// shell reads commands from in until EOF or exit. A prompt is only shown
+// when in is a terminal.
+func (ctl *controller) shell(in *os.File) {
+	interactive := false
+	if info, err := in.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		interactive = true
+	}
+	if interactive {
+		fmt.Fprintf(ctl.out, "pupervisorctl connected to %s; type help for commands, exit to leave\n", ctl.client.addr)
+	}
+
+	scanner := bufio.NewScanner(in)
+	for {
+		if interactive {
+			fmt.Fprint(ctl.out, "pupervisor> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return
+		}
+		// Errors are reported but don't end the shell
+		exitCode(ctl.run(args))
+	}
+	if interactive {
+		fmt.Fprintln(ctl.out)
+	}
+}
+
+func printCommands(out io.Writer) {
+	tw := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.usage, cmd.help)
+	}
+	tw.Flush()
+}
@@ -1,28 +1,49 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"pupervisor/internal/api"
+	"pupervisor/internal/auth"
 	"pupervisor/internal/config"
+	"pupervisor/internal/notify"
 	"pupervisor/internal/service"
 	"pupervisor/internal/storage"
 	"pupervisor/web"
+
+	"gopkg.in/yaml.v3"
 )
 
 func main() {
 	configPath := flag.String("config", "pupervisor.yaml", "Path to process configuration file")
 	dbPath := flag.String("db", "pupervisor.db", "Path to SQLite database file")
+	watch := flag.Duration("watch", 0, "Reload the process configuration when the file changes, polling at this interval (0 disables)")
+	sampleInterval := flag.Duration("sample-interval", service.DefaultSampleInterval, "Interval for sampling CPU, memory and other resource usage of running processes")
+	hashPassword := flag.Bool("hash-password", false, "Read a password from stdin, print its bcrypt hash for auth.users and exit")
+	convert := flag.String("convert", "", "Convert a supervisord configuration file to pupervisor YAML on stdout and exit")
 	flag.Parse()
 
+	if *hashPassword {
+		printPasswordHash()
+		return
+	}
+	if *convert != "" {
+		convertConfig(*convert)
+		return
+	}
+
 	// Load server config
 	cfg := config.LoadConfig()
 
@@ -37,22 +58,50 @@ func main() {
 	log.Printf("Database initialized at %s", absDbPath)
 
 	// Load process configuration
-	procCfg, err := config.LoadProcessConfig(*configPath)
-	if err != nil {
-		log.Printf("Warning: Could not load process config from %s: %v", *configPath, err)
-		log.Println("Starting with empty process list. Create pupervisor.yaml to define processes.")
-		procCfg = &config.SupervisorConfig{Processes: []config.ProcessConfig{}}
+	procCfg := loadProcessConfig(*configPath)
+	for _, warning := range procCfg.Warnings {
+		log.Printf("Warning: %s", warning)
 	}
 
 	// Initialize process manager
 	pm := service.NewProcessManager(procCfg, store)
 
+	if procCfg.Cgroups.Enabled {
+		cgroups, err := service.NewCgroups(procCfg.Cgroups.Parent)
+		if err != nil {
+			log.Printf("Warning: cgroups are disabled: %v", err)
+		} else {
+			log.Printf("Running programs in cgroups below %s", cgroups.Root())
+			pm.UseCgroups(cgroups)
+		}
+	}
+
+	// Notifications are sent from their own goroutine, until shutdown
+	notifyCtx, stopNotify := context.WithCancel(context.Background())
+	defer stopNotify()
+	if channels := procCfg.Notifications.Channels; len(channels) > 0 {
+		notifier, err := notify.New(procCfg.Notifications)
+		if err != nil {
+			log.Fatalf("Failed to set up notifications: %v", err)
+		}
+		log.Printf("Sending notifications to %d channel(s)", len(channels))
+		pm.UseNotifier(notifier)
+		go notifier.Run(notifyCtx)
+	}
+
 	// Get embedded filesystems
 	templatesFS := web.GetTemplatesFS()
 	staticFS := web.GetStaticFS()
 
 	// Create router
-	router, err := api.NewRouter(pm, templatesFS, staticFS)
+	if procCfg.Auth.Enabled {
+		log.Printf("Authentication enabled with %d user(s)", len(procCfg.Auth.Users))
+		if len(procCfg.Auth.Users) == 0 {
+			log.Println("Warning: auth is enabled but no users are configured; only API tokens can log in")
+		}
+	}
+
+	router, err := api.NewRouter(pm, procCfg.Auth, procCfg.Socket, templatesFS, staticFS)
 	if err != nil {
 		log.Fatalf("Failed to create router: %v", err)
 	}
@@ -66,35 +115,169 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	// Start auto-start processes
-	pm.StartAll()
+	// Serve the API on the Unix socket, before any process is started
+	var socketSrv *http.Server
+	if socketCfg := procCfg.Socket; socketCfg.Path != "" {
+		ln, err := listenUnix(socketCfg)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", socketCfg.Path, err)
+		}
+		socketSrv = &http.Server{
+			Handler:     router,
+			ReadTimeout: 15 * time.Second,
+			IdleTimeout: 60 * time.Second,
+			ConnContext: socketConnContext,
+		}
+		go func() {
+			log.Printf("Serving the API on unix socket %s (mode %s)", socketCfg.Path, socketCfg.Mode)
+			if err := socketSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Socket server error: %v", err)
+			}
+		}()
+	}
+
+	// Start auto-start processes; programs may wait on their dependencies,
+	// so don't hold up the web UI
+	log.Printf("Loaded %d process(es) from configuration", len(procCfg.Processes))
+	go pm.StartAll()
 
 	// Start server in goroutine
+	if procCfg.Socket.DisableTCP {
+		log.Println("TCP listener disabled, the API is only served on the unix socket")
+	} else {
+		go func() {
+			log.Printf("Starting Pupervisor Web UI server on %s", cfg.Server.Address)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Server error: %v", err)
+			}
+		}()
+	}
+
+	// Reopen process log files on SIGUSR2
+	reopen := make(chan os.Signal, 1)
+	notifyReopenLogs(reopen)
+	go func() {
+		for range reopen {
+			log.Println("Reopening process log files")
+			pm.ReopenLogs()
+		}
+	}()
+
+	// Reload process configuration on SIGHUP
+	reload := make(chan os.Signal, 1)
+	notifyReload(reload)
 	go func() {
-		log.Printf("Starting Pupervisor Web UI server on %s", cfg.Server.Address)
-		log.Printf("Loaded %d process(es) from configuration", len(procCfg.Processes))
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+		for range reload {
+			log.Println("Reloading process configuration")
+			if result, err := pm.Reload(); err != nil {
+				log.Printf("Configuration reload failed: %v", err)
+			} else {
+				log.Printf("Configuration reloaded: %d added, %d removed, %d changed",
+					len(result.Added), len(result.Removed), len(result.Changed))
+			}
 		}
 	}()
 
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if *sampleInterval > 0 {
+		go pm.RunSampler(watchCtx, *sampleInterval)
+	}
+	go pm.RunScheduler(watchCtx)
+	if *watch > 0 {
+		log.Printf("Watching %s for changes every %s", *configPath, *watch)
+		go pm.WatchConfig(watchCtx, *watch)
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopWatch()
 
 	// Stop all managed processes
 	pm.StopAll()
+	pm.CloseLogFiles()
 
 	// Shutdown HTTP server
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if socketSrv != nil {
+		// Closing the listener removes the socket file
+		if err := socketSrv.Shutdown(ctx); err != nil {
+			log.Printf("Socket server forced to shutdown: %v", err)
+		}
+	}
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
 	log.Println("Server exited gracefully")
 }
+
+// loadProcessConfig loads the process configuration, or returns an empty
+// one if the file does not exist. A file that exists but does not load is
+// fatal: starting without it would also drop its auth and unix_socket
+// settings, leaving the API open to everyone on the TCP address.
+func loadProcessConfig(path string) *config.SupervisorConfig {
+	cfg, err := config.LoadProcessConfig(path)
+	if err == nil {
+		return cfg
+	}
+	if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+		log.Fatalf("Failed to load process config from %s: %v", path, err)
+	}
+
+	log.Printf("Warning: process config %s does not exist", path)
+	log.Println("Starting with empty process list. Create pupervisor.yaml to define processes.")
+	return &config.SupervisorConfig{Processes: []config.ProcessConfig{}, Path: path}
+}
+
+func printPasswordHash() {
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		log.Fatalf("Failed to read password: %v", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		log.Fatal("Password must not be empty")
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+	fmt.Println(hash)
+}
+
+// convertConfig prints a supervisord configuration as pupervisor YAML.
+// Warnings about unsupported settings go to stderr.
+func convertConfig(path string) {
+	cfg, err := config.ReadSupervisordConfig(path)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", path, err)
+	}
+	for _, warning := range cfg.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+
+	// Check the result as pupervisor would load it, without writing out
+	// the defaults
+	check := *cfg
+	check.Processes = append([]config.ProcessConfig(nil), cfg.Processes...)
+	check.SetDefaults()
+	if err := check.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: the converted configuration is not valid on this host: %v\n", err)
+	}
+
+	fmt.Printf("# Converted from %s\n", path)
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		log.Fatalf("Failed to encode configuration: %v", err)
+	}
+	enc.Close()
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReopenLogs relays SIGUSR2, used by logrotate setups to ask for log
+// files to be reopened.
+func notifyReopenLogs(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR2)
+}
+
+// notifyReload relays SIGHUP, which asks for the process configuration to be
+// reloaded.
+func notifyReload(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGHUP)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyReopenLogs is a no-op on Windows, which has no SIGUSR2.
+func notifyReopenLogs(c chan<- os.Signal) {}
+
+// notifyReload is a no-op on Windows, which has no SIGHUP.
+func notifyReload(c chan<- os.Signal) {}
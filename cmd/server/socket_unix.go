@@ -0,0 +1,103 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+
+	"pupervisor/internal/auth"
+	"pupervisor/internal/config"
+)
+
+// listenUnix listens on the socket from cfg and applies its mode and owner.
+// A socket file left behind by a previous run is replaced. Must be called
+// before processes are started, as it changes the umask.
+func listenUnix(cfg config.UnixSocketConfig) (net.Listener, error) {
+	if info, err := os.Lstat(cfg.Path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", cfg.Path)
+		}
+		if conn, err := net.Dial("unix", cfg.Path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", cfg.Path)
+		}
+		if err := os.Remove(cfg.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	mode, err := config.ParseFileMode(cfg.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nobody else may connect before the mode and owner are applied
+	old := syscall.Umask(0o077)
+	ln, err := net.Listen("unix", cfg.Path)
+	syscall.Umask(old)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Owner != "" {
+		id, err := config.LookupIdentity(cfg.Owner)
+		if err == nil {
+			err = os.Chown(cfg.Path, int(id.UID), int(id.GID))
+		}
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("cannot change owner of %s: %w", cfg.Path, err)
+		}
+	}
+	if err := os.Chmod(cfg.Path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	if runtime.GOOS == "linux" {
+		return peerListener{ln}, nil
+	}
+	return ln, nil
+}
+
+// peerListener reads the peer credentials of every accepted connection.
+// Connections whose credentials cannot be read are closed.
+type peerListener struct {
+	net.Listener
+}
+
+func (l peerListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		peer, err := auth.PeerCredentials(conn)
+		if err != nil {
+			log.Printf("Closing socket connection: cannot read peer credentials: %v", err)
+			conn.Close()
+			continue
+		}
+		return &peerConn{Conn: conn, peer: peer}, nil
+	}
+}
+
+type peerConn struct {
+	net.Conn
+	peer *auth.Peer
+}
+
+// socketConnContext makes the peer credentials of a socket connection
+// available to its requests.
+func socketConnContext(ctx context.Context, c net.Conn) context.Context {
+	if pc, ok := c.(*peerConn); ok {
+		return auth.WithPeer(ctx, pc.peer)
+	}
+	return ctx
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"pupervisor/internal/config"
+)
+
+// listenUnix is not supported on Windows; the configuration rejects
+// unix_socket there.
+func listenUnix(cfg config.UnixSocketConfig) (net.Listener, error) {
+	return nil, errors.New("unix sockets are not supported on windows")
+}
+
+func socketConnContext(ctx context.Context, c net.Conn) context.Context {
+	return ctx
+}
@@ -3,7 +3,11 @@ package api
 import (
 	"io/fs"
 	"net/http"
+	"time"
 
+	"pupervisor/internal/audit"
+	"pupervisor/internal/auth"
+	"pupervisor/internal/config"
 	"pupervisor/internal/handlers"
 	"pupervisor/internal/middleware"
 	"pupervisor/internal/service"
@@ -15,7 +19,7 @@ type Router struct {
 	*mux.Router
 }
 
-func NewRouter(pm *service.ProcessManager, templatesFS, staticFS fs.FS) (*Router, error) {
+func NewRouter(pm *service.ProcessManager, authCfg config.AuthConfig, socketCfg config.UnixSocketConfig, templatesFS, staticFS fs.FS) (*Router, error) {
 	r := mux.NewRouter()
 
 	tmplHandler, err := handlers.NewTemplateHandler(templatesFS)
@@ -24,10 +28,44 @@ func NewRouter(pm *service.ProcessManager, templatesFS, staticFS fs.FS) (*Router
 	}
 
 	procHandler := handlers.NewProcessHandler(pm)
+	healthHandler := handlers.NewHealthHandler(pm)
+	metricsHandler := handlers.NewMetricsHandler(pm)
+	rpcHandler := handlers.NewRPCHandler(pm)
+
+	// Authentication: basic auth and login sessions for configured users,
+	// bearer tokens from the database. Viewers may read everything; changing
+	// process state needs operator, configuration and tokens need admin.
+	var provider auth.Provider
+	var users *auth.Users
+	var sessions *auth.Sessions
+	if authCfg.Enabled {
+		users = auth.NewUsers(authCfg.Users)
+		sessions = auth.NewSessions(time.Duration(authCfg.SessionTimeout) * time.Second)
+		provider = auth.Chain{sessions, auth.NewTokens(pm.GetStorage()), users}
+	}
+	// Unix socket clients are also identified by their peer credentials
+	var peers *auth.Peers
+	if socketCfg.Path != "" {
+		if peers, err = auth.NewPeers(socketCfg.Peers); err != nil {
+			return nil, err
+		}
+	}
+	authHandler := handlers.NewAuthHandler(users, sessions, pm.GetStorage(), tmplHandler)
+	operator := middleware.RequireRole(auth.RoleOperator)
+	admin := middleware.RequireRole(auth.RoleAdmin)
 
 	// Health check endpoints
 	r.HandleFunc("/health", handlers.HealthCheck).Methods(http.MethodGet)
-	r.HandleFunc("/ready", handlers.ReadyCheck).Methods(http.MethodGet)
+	r.HandleFunc("/ready", healthHandler.ReadyCheck).Methods(http.MethodGet)
+	r.HandleFunc("/metrics", metricsHandler.ServeMetrics).Methods(http.MethodGet)
+
+	// Supervisord-compatible XML-RPC; roles are checked per method
+	r.Handle("/RPC2", rpcHandler).Methods(http.MethodPost)
+
+	// Login routes
+	r.HandleFunc("/login", authHandler.LoginPage).Methods(http.MethodGet)
+	r.HandleFunc("/login", authHandler.Login).Methods(http.MethodPost)
+	r.HandleFunc("/logout", authHandler.Logout).Methods(http.MethodPost)
 
 	// Web UI routes
 	r.HandleFunc("/", tmplHandler.ServeTemplate("dashboard")).Methods(http.MethodGet)
@@ -35,6 +73,7 @@ func NewRouter(pm *service.ProcessManager, templatesFS, staticFS fs.FS) (*Router
 	r.HandleFunc("/logs", tmplHandler.ServeTemplate("logs")).Methods(http.MethodGet)
 	r.HandleFunc("/crashes", tmplHandler.ServeTemplate("crashes")).Methods(http.MethodGet)
 	r.HandleFunc("/settings", tmplHandler.ServeTemplate("settings")).Methods(http.MethodGet)
+	r.HandleFunc("/audit", tmplHandler.ServeTemplate("audit")).Methods(http.MethodGet)
 
 	// Serve static files
 	staticHandler := http.FileServer(http.FS(staticFS))
@@ -43,11 +82,28 @@ func NewRouter(pm *service.ProcessManager, templatesFS, staticFS fs.FS) (*Router
 	// API routes
 	api := r.PathPrefix("/api").Subrouter()
 	api.HandleFunc("/processes", procHandler.GetProcesses).Methods(http.MethodGet)
-	api.HandleFunc("/processes/restart-all", procHandler.RestartAllProcesses).Methods(http.MethodPost)
-	api.HandleFunc("/processes/restart-selected", procHandler.RestartSelectedProcesses).Methods(http.MethodPost)
-	api.HandleFunc("/processes/{name}/start", procHandler.StartProcess).Methods(http.MethodPost)
-	api.HandleFunc("/processes/{name}/stop", procHandler.StopProcess).Methods(http.MethodPost)
-	api.HandleFunc("/processes/{name}/restart", procHandler.RestartProcess).Methods(http.MethodPost)
+	api.HandleFunc("/processes/restart-all", operator(procHandler.RestartAllProcesses)).Methods(http.MethodPost)
+	api.HandleFunc("/processes/restart-selected", operator(procHandler.RestartSelectedProcesses)).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}", procHandler.GetProcess).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{name}/start", operator(procHandler.StartProcess)).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/stop", operator(procHandler.StopProcess)).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/restart", operator(procHandler.RestartProcess)).Methods(http.MethodPost)
+	api.HandleFunc("/processes/{name}/metrics", procHandler.GetProcessMetrics).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{name}/runs", procHandler.GetJobRuns).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{name}/logs/stream", procHandler.StreamLogs).Methods(http.MethodGet)
+	api.HandleFunc("/processes/{name}/logs/ws", procHandler.StreamLogsWS).Methods(http.MethodGet)
+	api.HandleFunc("/programs/{name}/scale", operator(procHandler.ScaleProgram)).Methods(http.MethodPost)
+	api.HandleFunc("/programs/{name}", admin(procHandler.GetProgram)).Methods(http.MethodGet)
+	api.HandleFunc("/programs/{name}", admin(procHandler.CreateProgram)).Methods(http.MethodPost)
+	api.HandleFunc("/programs/{name}", admin(procHandler.UpdateProgram)).Methods(http.MethodPut)
+	api.HandleFunc("/programs/{name}", admin(procHandler.DeleteProgram)).Methods(http.MethodDelete)
+	api.HandleFunc("/programs/{name}/changes", admin(procHandler.GetProgramChanges)).Methods(http.MethodGet)
+	api.HandleFunc("/config/reread", admin(procHandler.RereadConfig)).Methods(http.MethodPost)
+	api.HandleFunc("/config/reload", admin(procHandler.ReloadConfig)).Methods(http.MethodPost)
+	api.HandleFunc("/groups", procHandler.GetGroups).Methods(http.MethodGet)
+	api.HandleFunc("/groups/{group}/start", operator(procHandler.StartGroup)).Methods(http.MethodPost)
+	api.HandleFunc("/groups/{group}/stop", operator(procHandler.StopGroup)).Methods(http.MethodPost)
+	api.HandleFunc("/groups/{group}/restart", operator(procHandler.RestartGroup)).Methods(http.MethodPost)
 	api.HandleFunc("/logs", procHandler.GetLogs).Methods(http.MethodGet)
 	api.HandleFunc("/logs/worker", procHandler.GetWorkerLogs).Methods(http.MethodGet)
 	api.HandleFunc("/logs/system", procHandler.GetSystemLogs).Methods(http.MethodGet)
@@ -60,11 +116,23 @@ func NewRouter(pm *service.ProcessManager, templatesFS, staticFS fs.FS) (*Router
 
 	// Settings routes
 	api.HandleFunc("/settings", procHandler.GetSettings).Methods(http.MethodGet)
-	api.HandleFunc("/settings", procHandler.UpdateSettings).Methods(http.MethodPost)
+	api.HandleFunc("/settings", admin(procHandler.UpdateSettings)).Methods(http.MethodPost)
+	api.HandleFunc("/notifications/test", admin(procHandler.TestNotification)).Methods(http.MethodPost)
+
+	// Audit log; it records every call that changes something
+	api.HandleFunc("/audit", admin(procHandler.GetAudit)).Methods(http.MethodGet)
+
+	// Auth routes
+	api.HandleFunc("/auth/me", authHandler.Me).Methods(http.MethodGet)
+	api.HandleFunc("/tokens", admin(authHandler.GetTokens)).Methods(http.MethodGet)
+	api.HandleFunc("/tokens", admin(authHandler.CreateToken)).Methods(http.MethodPost)
+	api.HandleFunc("/tokens/{id}", admin(authHandler.DeleteToken)).Methods(http.MethodDelete)
 
 	// Apply middleware
 	r.Use(middleware.Recovery)
 	r.Use(middleware.Logging)
+	r.Use(middleware.Auth(provider, peers))
+	r.Use(audit.Middleware(pm.GetStorage()))
 
 	return &Router{Router: r}, nil
 }
@@ -0,0 +1,319 @@
+// Package audit records every API call that changes something: who made it,
+// from where, what it was applied to, with which parameters and how it
+// ended.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"pupervisor/internal/auth"
+	"pupervisor/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxParams is the number of bytes of parameters stored per entry
+	maxParams = 4096
+	// maxError is the number of bytes of an error response kept as the error
+	maxError = 512
+
+	redacted = "[redacted]"
+)
+
+// targetVars are the route variables naming the target of a call, in order
+// of preference.
+var targetVars = []string{"name", "group", "id"}
+
+// sensitiveKeys are parameter keys whose values are not stored. Keys
+// containing password, secret or token are also redacted.
+var sensitiveKeys = map[string]bool{
+	"environment": true,
+}
+
+type recordKey struct{}
+
+// record holds what a handler tells about the call being audited.
+type record struct {
+	action string
+	target string
+	params interface{}
+	err    string
+	skip   bool
+}
+
+func fromContext(ctx context.Context) *record {
+	rec, _ := ctx.Value(recordKey{}).(*record)
+	return rec
+}
+
+// Describe replaces the action, target and parameters derived from the
+// request, for handlers like XML-RPC that serve many actions on one route.
+func Describe(ctx context.Context, action, target string, params interface{}) {
+	if rec := fromContext(ctx); rec != nil {
+		rec.action, rec.target, rec.params = action, target, params
+	}
+}
+
+// Fail marks the call as failed although its response status is a success.
+func Fail(ctx context.Context, message string) {
+	if rec := fromContext(ctx); rec != nil {
+		rec.err = message
+	}
+}
+
+// Skip leaves the call out of the audit log, e.g. a read-only XML-RPC call.
+func Skip(ctx context.Context) {
+	if rec := fromContext(ctx); rec != nil {
+		rec.skip = true
+	}
+}
+
+// audited reports whether a request can change something: any API or
+// XML-RPC call that is not a GET, HEAD or OPTIONS.
+func audited(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/RPC2"
+}
+
+// responseWriter keeps the status and the start of error responses.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status >= http.StatusBadRequest && rw.body.Len() < maxError {
+		rw.body.Write(b[:min(len(b), maxError-rw.body.Len())])
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Middleware records every mutating call in store. It must run after
+// authentication, so that the caller is known; calls rejected for missing
+// credentials are not recorded, calls rejected for a missing role are.
+// A nil store disables the audit log.
+func Middleware(store *storage.Storage) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if store == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !audited(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			body := readBody(r)
+			rec := &record{}
+			wrapped := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(wrapped, r.WithContext(context.WithValue(r.Context(), recordKey{}, rec)))
+			if rec.skip {
+				return
+			}
+
+			entry := &storage.AuditEntry{
+				Actor:      actor(r),
+				Source:     source(r),
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Action:     rec.action,
+				Target:     rec.target,
+				Status:     wrapped.status,
+				Result:     storage.AuditSuccess,
+				Error:      rec.err,
+				DurationMs: time.Since(start).Milliseconds(),
+				CreatedAt:  start,
+			}
+			if entry.Action == "" {
+				entry.Action = routeName(r)
+				entry.Target = routeTarget(r)
+			}
+			if rec.params != nil {
+				entry.Params = encodeParams(rec.params)
+			} else {
+				entry.Params = requestParams(r, body)
+			}
+			if wrapped.status >= http.StatusBadRequest && entry.Error == "" {
+				entry.Error = responseError(wrapped.body.Bytes())
+			}
+			if wrapped.status >= http.StatusBadRequest || entry.Error != "" {
+				entry.Result = storage.AuditFailure
+			}
+
+			if err := store.SaveAuditEntry(entry); err != nil {
+				log.Printf("Failed to save audit entry for %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		})
+	}
+}
+
+// readBody returns the start of the request body and puts it back for the
+// handler.
+func readBody(r *http.Request) []byte {
+	if r.Body == nil {
+		return nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxParams+1))
+	if err != nil {
+		return nil
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	return buf
+}
+
+func actor(r *http.Request) string {
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		return principal.Name
+	}
+	return "unknown"
+}
+
+// source is the remote IP of the caller, or its process credentials for
+// calls over the Unix socket.
+func source(r *http.Request) string {
+	if peer := auth.PeerFromContext(r.Context()); peer != nil {
+		return "unix (" + peer.String() + ")"
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// routeName is the path template of the matched route, e.g.
+// /api/processes/{name}/start.
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return r.URL.Path
+}
+
+func routeTarget(r *http.Request) string {
+	vars := mux.Vars(r)
+	for _, name := range targetVars {
+		if v, ok := vars[name]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// requestParams encodes the query and JSON body of a request, with
+// sensitive values redacted. A body that is not JSON or too long to parse
+// is stored as text, cut at maxParams.
+func requestParams(r *http.Request, body []byte) string {
+	params := make(map[string]interface{})
+	if query := r.URL.Query(); len(query) > 0 {
+		params["query"] = redact(flatten(query))
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && len(body) <= maxParams {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			params["body"] = redact(v)
+		} else {
+			params["body"] = string(body)
+		}
+	} else if len(body) > 0 {
+		params["body"] = string(body[:maxParams]) + "..."
+	}
+
+	if len(params) == 0 {
+		return ""
+	}
+	return encodeParams(params)
+}
+
+func flatten(query map[string][]string) map[string]interface{} {
+	flat := make(map[string]interface{}, len(query))
+	for k, v := range query {
+		if len(v) == 1 {
+			flat[k] = v[0]
+		} else {
+			flat[k] = v
+		}
+	}
+	return flat
+}
+
+func encodeParams(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	if len(data) > maxParams {
+		return string(data[:maxParams]) + "..."
+	}
+	return string(data)
+}
+
+// redact replaces the values of sensitive keys in decoded JSON.
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if sensitive(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redact(val)
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = redact(val)
+		}
+	}
+	return v
+}
+
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	return sensitiveKeys[key] || strings.Contains(key, "password") || strings.Contains(key, "secret") || strings.Contains(key, "token")
+}
+
+// responseError extracts the message of an error response written by the
+// API handlers, {"error": ..., "message": ...}, or returns it as text.
+func responseError(body []byte) string {
+	var resp struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && (resp.Error != "" || resp.Message != "") {
+		if resp.Message == "" || resp.Error == "" {
+			return resp.Message + resp.Error
+		}
+		return resp.Message + ": " + resp.Error
+	}
+	return strings.TrimSpace(string(body))
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUnknownRole        = errors.New("unknown role")
+)
+
+// Role grants access to a set of routes. Higher roles include lower ones.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleRank[role]; !ok {
+		return "", ErrUnknownRole
+	}
+	return role, nil
+}
+
+// Allows reports whether r grants at least the access of required.
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required]
+}
+
+// Authentication methods
+const (
+	MethodBasic   = "basic"
+	MethodToken   = "token"
+	MethodSession = "session"
+	MethodNone    = "none"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Name   string `json:"name"`
+	Role   Role   `json:"role"`
+	Method string `json:"method"`
+}
+
+// Provider authenticates requests carrying one kind of credentials. It
+// returns nil, nil when the request has no credentials it understands and
+// ErrInvalidCredentials when they are present but wrong.
+type Provider interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries providers in order and returns the first match.
+type Chain []Provider
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, p := range c {
+		principal, err := p.Authenticate(r)
+		if err != nil || principal != nil {
+			return principal, err
+		}
+	}
+	return nil, nil
+}
+
+type contextKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal stored by the auth middleware, if any.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
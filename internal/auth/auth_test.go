@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/storage"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newStore(t *testing.T) *storage.Storage {
+	t.Helper()
+	store, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleViewer, RoleAdmin, false},
+		{RoleOperator, RoleViewer, true},
+		{RoleOperator, RoleOperator, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleAdmin, RoleViewer, true},
+		{RoleAdmin, RoleAdmin, true},
+		{Role(""), RoleViewer, false},
+		{Role("root"), RoleViewer, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, s := range []string{"viewer", "operator", "admin"} {
+		if role, err := ParseRole(s); err != nil || string(role) != s {
+			t.Errorf("ParseRole(%q) = %q, %v", s, role, err)
+		}
+	}
+	for _, s := range []string{"", "Admin", "root"} {
+		if _, err := ParseRole(s); !errors.Is(err, ErrUnknownRole) {
+			t.Errorf("ParseRole(%q) error = %v, want ErrUnknownRole", s, err)
+		}
+	}
+}
+
+func TestUsersAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewUsers([]config.UserConfig{
+		{Username: "admin", PasswordHash: string(hash), Role: "admin"},
+		{Username: "oncall", PasswordHash: string(hash), Role: "operator"},
+	})
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		basic    bool
+		want     *Principal
+		err      error
+	}{
+		{"no credentials", "", "", false, nil, nil},
+		{"admin", "admin", "secret", true, &Principal{Name: "admin", Role: RoleAdmin, Method: MethodBasic}, nil},
+		{"operator", "oncall", "secret", true, &Principal{Name: "oncall", Role: RoleOperator, Method: MethodBasic}, nil},
+		// A second check is answered from the cache and must still compare
+		// the password
+		{"cached", "admin", "secret", true, &Principal{Name: "admin", Role: RoleAdmin, Method: MethodBasic}, nil},
+		{"wrong password", "admin", "Secret", true, nil, ErrInvalidCredentials},
+		{"empty password", "admin", "", true, nil, ErrInvalidCredentials},
+		{"unknown user", "nobody", "secret", true, nil, ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/processes", nil)
+			if tt.basic {
+				r.SetBasicAuth(tt.username, tt.password)
+			}
+			got, err := users.Authenticate(r)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("principal = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokensAuthenticate(t *testing.T) {
+	store := newStore(t)
+	create := func(name, role string, expires *time.Time) (string, int64) {
+		token, hash, err := GenerateToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored := &storage.APIToken{Name: name, Role: role, ExpiresAt: expires}
+		if err := store.CreateAPIToken(stored, hash); err != nil {
+			t.Fatal(err)
+		}
+		return token, stored.ID
+	}
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	valid, _ := create("deploy", "operator", nil)
+	expiring, _ := create("ci", "viewer", &future)
+	expired, _ := create("old", "admin", &past)
+	badRole, _ := create("broken", "root", nil)
+	revoked, revokedID := create("revoked", "admin", nil)
+	if ok, err := store.DeleteAPIToken(revokedID); !ok || err != nil {
+		t.Fatalf("DeleteAPIToken = %v, %v", ok, err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   *Principal
+		err    error
+	}{
+		{"no header", "", nil, nil},
+		{"basic auth", "Basic YWRtaW46c2VjcmV0", nil, nil},
+		{"valid", "Bearer " + valid, &Principal{Name: "token:deploy", Role: RoleOperator, Method: MethodToken}, nil},
+		{"scheme is case insensitive", "bearer " + valid, &Principal{Name: "token:deploy", Role: RoleOperator, Method: MethodToken}, nil},
+		{"not expired yet", "Bearer " + expiring, &Principal{Name: "token:ci", Role: RoleViewer, Method: MethodToken}, nil},
+		{"expired", "Bearer " + expired, nil, ErrInvalidCredentials},
+		{"revoked", "Bearer " + revoked, nil, ErrInvalidCredentials},
+		{"unknown role", "Bearer " + badRole, nil, ErrInvalidCredentials},
+		{"unknown token", "Bearer pvt_0000", nil, ErrInvalidCredentials},
+		{"empty token", "Bearer ", nil, ErrInvalidCredentials},
+	}
+
+	tokens := NewTokens(store)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/processes", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			got, err := tokens.Authenticate(r)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("principal = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	stored, err := store.GetAPITokenByHash(HashToken(valid))
+	if err != nil || stored == nil || stored.LastUsedAt == nil {
+		t.Errorf("last use of a valid token was not recorded: %+v, %v", stored, err)
+	}
+}
+
+func TestTokensWithoutStore(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/processes", nil)
+	r.Header.Set("Authorization", "Bearer pvt_0000")
+	if got, err := NewTokens(nil).Authenticate(r); got != nil || !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate = %+v, %v, want ErrInvalidCredentials", got, err)
+	}
+}
+
+// login creates a session for p and returns its cookie.
+func login(t *testing.T, s *Sessions, p *Principal) *http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	if err := s.Create(rec, httptest.NewRequest(http.MethodPost, "/login", nil), p); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == SessionCookie {
+			return c
+		}
+	}
+	t.Fatal("no session cookie set")
+	return nil
+}
+
+func TestSessions(t *testing.T) {
+	sessions := NewSessions(time.Hour)
+	admin := &Principal{Name: "admin", Role: RoleAdmin, Method: MethodBasic}
+	cookie := login(t, sessions, admin)
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+		t.Errorf("cookie = %+v, want HttpOnly, SameSite=Lax and Path=/", cookie)
+	}
+
+	authenticate := func(c *http.Cookie) *Principal {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c != nil {
+			r.AddCookie(c)
+		}
+		p, err := sessions.Authenticate(r)
+		if err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+		return p
+	}
+
+	want := Principal{Name: "admin", Role: RoleAdmin, Method: MethodSession}
+	if got := authenticate(cookie); got == nil || *got != want {
+		t.Errorf("session principal = %+v, want %+v", got, want)
+	}
+	if got := authenticate(nil); got != nil {
+		t.Errorf("no cookie: principal = %+v", got)
+	}
+	if got := authenticate(&http.Cookie{Name: SessionCookie, Value: "forged"}); got != nil {
+		t.Errorf("unknown session: principal = %+v", got)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	r.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	sessions.Destroy(rec, r)
+	if got := authenticate(cookie); got != nil {
+		t.Errorf("after logout: principal = %+v", got)
+	}
+	if c := rec.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+		t.Errorf("logout cookies = %+v, want the session cookie cleared", c)
+	}
+
+	expired := NewSessions(-time.Minute)
+	cookie = login(t, expired, admin)
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	if got, err := expired.Authenticate(r); got != nil || err != nil {
+		t.Errorf("expired session: principal = %+v, %v", got, err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewSessions(time.Hour)
+	chain := Chain{sessions, NewTokens(newStore(t)), NewUsers([]config.UserConfig{
+		{Username: "viewer", PasswordHash: string(hash), Role: "viewer"},
+	})}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got, err := chain.Authenticate(r); got != nil || err != nil {
+		t.Errorf("no credentials: %+v, %v", got, err)
+	}
+
+	r.SetBasicAuth("viewer", "secret")
+	if got, err := chain.Authenticate(r); got == nil || got.Method != MethodBasic || err != nil {
+		t.Errorf("basic auth: %+v, %v", got, err)
+	}
+
+	// A wrong token stops the chain instead of falling back to the next
+	// provider
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer pvt_0000")
+	if got, err := chain.Authenticate(r); got != nil || !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong token: %+v, %v", got, err)
+	}
+}
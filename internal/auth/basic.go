@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+
+	"pupervisor/internal/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// verifiedTTL is how long a successful password check is remembered, so
+// clients sending basic auth on every request don't pay for bcrypt each time.
+const verifiedTTL = time.Minute
+
+// Users checks usernames and passwords against the bcrypt hashes from the
+// configuration. It authenticates requests carrying HTTP basic auth.
+type Users struct {
+	users map[string]config.UserConfig
+
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]time.Time
+}
+
+func NewUsers(users []config.UserConfig) *Users {
+	u := &Users{
+		users:    make(map[string]config.UserConfig, len(users)),
+		verified: make(map[[sha256.Size]byte]time.Time),
+	}
+	for _, user := range users {
+		u.users[user.Username] = user
+	}
+	return u
+}
+
+func (u *Users) Len() int {
+	return len(u.users)
+}
+
+// Verify returns the principal for username if password matches.
+func (u *Users) Verify(username, password, method string) (*Principal, error) {
+	user, ok := u.users[username]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	key := sha256.Sum256([]byte(username + "\x00" + password + "\x00" + user.PasswordHash))
+	u.mu.Lock()
+	expires, cached := u.verified[key]
+	u.mu.Unlock()
+
+	if !cached || time.Now().After(expires) {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+			return nil, ErrInvalidCredentials
+		}
+
+		u.mu.Lock()
+		now := time.Now()
+		for k, exp := range u.verified {
+			if now.After(exp) {
+				delete(u.verified, k)
+			}
+		}
+		u.verified[key] = now.Add(verifiedTTL)
+		u.mu.Unlock()
+	}
+
+	return &Principal{Name: user.Username, Role: Role(user.Role), Method: method}, nil
+}
+
+func (u *Users) Authenticate(r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	return u.Verify(username, password, MethodBasic)
+}
+
+// HashPassword returns a bcrypt hash suitable for password_hash.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+
+	"pupervisor/internal/config"
+)
+
+// MethodPeer authenticates Unix socket clients by their peer credentials.
+const MethodPeer = "peer"
+
+// Peer holds the credentials of the process on the other end of a Unix
+// socket connection, as reported by the kernel.
+type Peer struct {
+	UID uint32
+	GID uint32
+	PID int32
+}
+
+type peerKey struct{}
+
+// WithPeer stores the peer credentials of a connection in ctx.
+func WithPeer(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// PeerFromContext returns the peer credentials of a Unix socket request, or
+// nil for requests over TCP.
+func PeerFromContext(ctx context.Context) *Peer {
+	p, _ := ctx.Value(peerKey{}).(*Peer)
+	return p
+}
+
+type peerRule struct {
+	id    uint32
+	group bool
+	role  Role
+}
+
+// Peers grants roles to Unix socket clients by user and group. Root and the
+// user pupervisor runs as are always admins.
+type Peers struct {
+	rules []peerRule
+	self  uint32
+}
+
+func NewPeers(peers []config.PeerConfig) (*Peers, error) {
+	p := &Peers{self: uint32(os.Geteuid())}
+	for _, peer := range peers {
+		id, err := peer.ID()
+		if err != nil {
+			return nil, err
+		}
+		role, err := ParseRole(peer.Role)
+		if err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, peerRule{id: id, group: peer.Group != "", role: role})
+	}
+	return p, nil
+}
+
+// Restricted reports whether rules are configured. Without rules, access to
+// the socket is controlled by its file mode alone.
+func (p *Peers) Restricted() bool {
+	return len(p.rules) > 0
+}
+
+// Match returns the principal for peer, with the highest role of all
+// matching rules, or nil if no rule matches. Groups match the peer's primary
+// group and the supplementary groups of its user.
+func (p *Peers) Match(peer *Peer) *Principal {
+	name := "uid " + strconv.FormatUint(uint64(peer.UID), 10)
+	groups := map[uint32]bool{peer.GID: true}
+	if u, err := user.LookupId(strconv.FormatUint(uint64(peer.UID), 10)); err == nil {
+		name = u.Username
+		ids, _ := u.GroupIds()
+		for _, id := range ids {
+			if n, err := strconv.ParseUint(id, 10, 32); err == nil {
+				groups[uint32(n)] = true
+			}
+		}
+	}
+
+	var role Role
+	if peer.UID == 0 || peer.UID == p.self {
+		role = RoleAdmin
+	}
+	for _, rule := range p.rules {
+		matches := rule.id == peer.UID
+		if rule.group {
+			matches = groups[rule.id]
+		}
+		if matches && (role == "" || !role.Allows(rule.role)) {
+			role = rule.role
+		}
+	}
+	if role == "" {
+		return nil
+	}
+	return &Principal{Name: name, Role: role, Method: MethodPeer}
+}
+
+func (p *Peer) String() string {
+	return fmt.Sprintf("pid %d, uid %d, gid %d", p.PID, p.UID, p.GID)
+}
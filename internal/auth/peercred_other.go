@@ -0,0 +1,13 @@
+//go:build !linux
+
+package auth
+
+import (
+	"errors"
+	"net"
+)
+
+// PeerCredentials is only available on Linux.
+func PeerCredentials(conn net.Conn) (*Peer, error) {
+	return nil, errors.New("peer credentials are only supported on linux")
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const SessionCookie = "pupervisor_session"
+
+type session struct {
+	principal Principal
+	expires   time.Time
+}
+
+// Sessions keeps logged-in browser sessions in memory. Sessions are lost on
+// restart and users have to log in again.
+type Sessions struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func NewSessions(ttl time.Duration) *Sessions {
+	return &Sessions{
+		ttl:      ttl,
+		sessions: make(map[string]*session),
+	}
+}
+
+// Create starts a session for p and sets its cookie on the response.
+func (s *Sessions) Create(w http.ResponseWriter, r *http.Request, p *Principal) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(b)
+
+	now := time.Now()
+	s.mu.Lock()
+	for k, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, k)
+		}
+	}
+	principal := *p
+	principal.Method = MethodSession
+	s.sessions[id] = &session{principal: principal, expires: now.Add(s.ttl)}
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(s.ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Destroy ends the request's session and clears its cookie.
+func (s *Sessions) Destroy(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, cookie.Value)
+		s.mu.Unlock()
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Authenticate looks up the session cookie. An unknown or expired session is
+// treated as no credentials so the user is sent to the login page.
+func (s *Sessions) Authenticate(r *http.Request) (*Principal, error) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[cookie.Value]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(sess.expires) {
+		delete(s.sessions, cookie.Value)
+		return nil, nil
+	}
+
+	principal := sess.principal
+	return &principal, nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"pupervisor/internal/storage"
+)
+
+// tokenPrefix marks pupervisor API tokens so they are easy to recognise in
+// logs and secret scanners.
+const tokenPrefix = "pvt_"
+
+// GenerateToken returns a new random API token and the hash to store for it.
+func GenerateToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = tokenPrefix + hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Tokens authenticates requests carrying "Authorization: Bearer <token>"
+// against the tokens stored in the database.
+type Tokens struct {
+	store *storage.Storage
+}
+
+func NewTokens(store *storage.Storage) *Tokens {
+	return &Tokens{store: store}
+}
+
+func (t *Tokens) Authenticate(r *http.Request) (*Principal, error) {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+	if t.store == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	stored, err := t.store.GetAPITokenByHash(HashToken(strings.TrimSpace(token)))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	if stored.ExpiresAt != nil && now.After(*stored.ExpiresAt) {
+		return nil, ErrInvalidCredentials
+	}
+	role, err := ParseRole(stored.Role)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	_ = t.store.TouchAPIToken(stored.ID, now)
+	return &Principal{Name: "token:" + stored.Name, Role: role, Method: MethodToken}, nil
+}
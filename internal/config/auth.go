@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DefaultSessionTimeout = 12 * 60 * 60
+
+// AuthConfig enables authentication for the web UI and API. Users log in
+// with a password checked against a bcrypt hash; API tokens are managed at
+// runtime and stored in the database.
+type AuthConfig struct {
+	Enabled        bool         `yaml:"enabled"`
+	Users          []UserConfig `yaml:"users,omitempty"`
+	SessionTimeout int          `yaml:"session_timeout,omitempty"`
+}
+
+type UserConfig struct {
+	Username     string `yaml:"username"`
+	PasswordHash string `yaml:"password_hash"`
+	Role         string `yaml:"role"`
+}
+
+var validRoles = map[string]bool{"viewer": true, "operator": true, "admin": true}
+
+func (ac *AuthConfig) SetDefaults() {
+	if ac.SessionTimeout == 0 {
+		ac.SessionTimeout = DefaultSessionTimeout
+	}
+	for i := range ac.Users {
+		if ac.Users[i].Role == "" {
+			ac.Users[i].Role = "viewer"
+		}
+	}
+}
+
+func (ac *AuthConfig) Validate() error {
+	if ac.SessionTimeout < 0 {
+		return fmt.Errorf("auth: session_timeout must not be negative")
+	}
+
+	seen := make(map[string]bool)
+	for _, u := range ac.Users {
+		if u.Username == "" {
+			return fmt.Errorf("auth: username is required")
+		}
+		if seen[u.Username] {
+			return fmt.Errorf("auth: duplicate user %q", u.Username)
+		}
+		seen[u.Username] = true
+
+		if !strings.HasPrefix(u.PasswordHash, "$2") {
+			return fmt.Errorf("auth: user %s: password_hash must be a bcrypt hash", u.Username)
+		}
+		if !validRoles[u.Role] {
+			return fmt.Errorf("auth: user %s: role must be viewer, operator or admin", u.Username)
+		}
+	}
+	return nil
+}
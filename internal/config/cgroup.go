@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+)
+
+const DefaultCgroupParent = "pupervisor"
+
+// CgroupsConfig places every program into its own cgroup v2 below Parent,
+// which is either absolute or relative to the cgroup2 mount point.
+type CgroupsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Parent  string `yaml:"parent,omitempty"`
+}
+
+func (cc *CgroupsConfig) SetDefaults() {
+	if cc.Parent == "" {
+		cc.Parent = DefaultCgroupParent
+	}
+}
+
+func (cc *CgroupsConfig) Validate() error {
+	if cc.Enabled && runtime.GOOS != "linux" {
+		return fmt.Errorf("cgroups: only supported on linux")
+	}
+	return nil
+}
+
+// CgroupConfig sets cgroup v2 limits shared by all instances of a program.
+// Zero values leave the limit unset.
+type CgroupConfig struct {
+	// CPUMax is the number of CPUs the program may use, e.g. 1.5
+	CPUMax     float64  `yaml:"cpu_max,omitempty"`
+	MemoryMax  ByteSize `yaml:"memory_max,omitempty"`
+	MemoryHigh ByteSize `yaml:"memory_high,omitempty"`
+	PidsMax    int      `yaml:"pids_max,omitempty"`
+}
+
+func (cc *CgroupConfig) Validate() error {
+	if cc.CPUMax < 0 || cc.MemoryMax < 0 || cc.MemoryHigh < 0 || cc.PidsMax < 0 {
+		return fmt.Errorf("cgroup: limits must not be negative")
+	}
+	if cc.MemoryMax > 0 && cc.MemoryHigh > cc.MemoryMax {
+		return fmt.Errorf("cgroup: memory_high must not exceed memory_max")
+	}
+	return nil
+}
+
+// Map returns the configured limits by cgroup file name, for display.
+func (cc *CgroupConfig) Map() map[string]string {
+	limits := make(map[string]string)
+	if cc.CPUMax > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%g CPUs", cc.CPUMax)
+	}
+	if cc.MemoryMax > 0 {
+		limits["memory.max"] = cc.MemoryMax.String()
+	}
+	if cc.MemoryHigh > 0 {
+		limits["memory.high"] = cc.MemoryHigh.String()
+	}
+	if cc.PidsMax > 0 {
+		limits["pids.max"] = fmt.Sprint(cc.PidsMax)
+	}
+	return limits
+}
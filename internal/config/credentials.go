@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Identity is the resolved user and groups a program runs as.
+type Identity struct {
+	Username string
+	UID      uint32
+	GID      uint32
+	Groups   []uint32
+}
+
+// LookupIdentity resolves a "user" setting of the form name[:group], where
+// both parts may also be numeric ids. Without a group the user's primary
+// group is used; supplementary groups are those of the user.
+func LookupIdentity(spec string) (*Identity, error) {
+	userPart, groupPart, hasGroup := strings.Cut(spec, ":")
+
+	u, err := user.Lookup(userPart)
+	if err != nil {
+		if u, err = user.LookupId(userPart); err != nil {
+			return nil, fmt.Errorf("unknown user %q", userPart)
+		}
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has no numeric uid", userPart)
+	}
+	gidStr := u.Gid
+	if hasGroup {
+		g, err := user.LookupGroup(groupPart)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupPart); err != nil {
+				return nil, fmt.Errorf("unknown group %q", groupPart)
+			}
+		}
+		gidStr = g.Gid
+	}
+	gid, err := strconv.ParseUint(gidStr, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("group of %q has no numeric gid", spec)
+	}
+
+	id := &Identity{Username: u.Username, UID: uint32(uid), GID: uint32(gid)}
+	groupIDs, _ := u.GroupIds()
+	for _, g := range groupIDs {
+		if n, err := strconv.ParseUint(g, 10, 32); err == nil {
+			id.Groups = append(id.Groups, uint32(n))
+		}
+	}
+	return id, nil
+}
+
+// ParseUmask parses an octal umask such as "022" or "0o027".
+func ParseUmask(s string) (int, error) {
+	mask, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || mask > 0o777 {
+		return 0, fmt.Errorf("invalid umask %q", s)
+	}
+	return int(mask), nil
+}
+
+// RlimitUnlimited removes a resource limit (RLIM_INFINITY).
+const RlimitUnlimited Rlimit = math.MaxUint64
+
+// Rlimit is a resource limit value. It is written as a number, a size with
+// a KB/MB/GB suffix, or "unlimited".
+type Rlimit uint64
+
+func (r *Rlimit) UnmarshalYAML(node *yaml.Node) error {
+	switch strings.ToLower(node.Value) {
+	case "unlimited", "infinity", "-1":
+		*r = RlimitUnlimited
+		return nil
+	}
+
+	size, err := ParseByteSize(node.Value)
+	if err != nil || size < 0 {
+		return fmt.Errorf("invalid resource limit %q", node.Value)
+	}
+	*r = Rlimit(size)
+	return nil
+}
+
+func (r Rlimit) MarshalYAML() (interface{}, error) {
+	if r == RlimitUnlimited {
+		return "unlimited", nil
+	}
+	return uint64(r), nil
+}
+
+func (r Rlimit) String() string {
+	if r == RlimitUnlimited {
+		return "unlimited"
+	}
+	return strconv.FormatUint(uint64(r), 10)
+}
+
+// RlimitsConfig sets resource limits for a program. Each limit is applied
+// as both the soft and hard limit before the program runs, so processes it
+// forks inherit them; unset limits are inherited from pupervisor.
+type RlimitsConfig struct {
+	NoFile *Rlimit `yaml:"nofile,omitempty"`
+	NProc  *Rlimit `yaml:"nproc,omitempty"`
+	Core   *Rlimit `yaml:"core,omitempty"`
+	AS     *Rlimit `yaml:"as,omitempty"`
+}
+
+// Map returns the configured limits by name, for display.
+func (rc *RlimitsConfig) Map() map[string]string {
+	limits := make(map[string]string)
+	for name, value := range map[string]*Rlimit{
+		"nofile": rc.NoFile,
+		"nproc":  rc.NProc,
+		"core":   rc.Core,
+		"as":     rc.AS,
+	} {
+		if value != nil {
+			limits[name] = value.String()
+		}
+	}
+	return limits
+}
+
+// validateCredentials checks user, umask and rlimits. Switching users needs
+// root, and rlimits are applied with prlimit, which only Linux has.
+func (pc *ProcessConfig) validateCredentials() error {
+	if pc.User != "" {
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("program %s: user is not supported on windows", pc.Name)
+		}
+		id, err := LookupIdentity(pc.User)
+		if err != nil {
+			return fmt.Errorf("program %s: user: %w", pc.Name, err)
+		}
+		if euid := os.Geteuid(); euid != 0 && uint32(euid) != id.UID {
+			return fmt.Errorf("program %s: running as user %s requires pupervisor to run as root", pc.Name, pc.User)
+		}
+	}
+
+	if pc.Umask != "" {
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("program %s: umask is not supported on windows", pc.Name)
+		}
+		if _, err := ParseUmask(pc.Umask); err != nil {
+			return fmt.Errorf("program %s: %w", pc.Name, err)
+		}
+	}
+
+	if pc.Rlimits != nil && runtime.GOOS != "linux" {
+		return fmt.Errorf("program %s: rlimits are only supported on linux", pc.Name)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrReadOnlyConfig = errors.New("supervisord configuration files cannot be edited, convert them with -convert first")
+
+// ConfigFile is a pupervisor YAML file opened for editing programs. Changes
+// are made to its YAML node tree, so comments, the key order of programs
+// and all other sections survive a save.
+type ConfigFile struct {
+	path string
+	doc  *yaml.Node
+}
+
+// OpenConfigFile reads the YAML file at path for editing.
+func OpenConfigFile(path string) (*ConfigFile, error) {
+	if IsSupervisordConfig(path) {
+		return nil, ErrReadOnlyConfig
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		// An empty file
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: top level is not a mapping", path)
+	}
+
+	return &ConfigFile{path: path, doc: doc}, nil
+}
+
+// processes returns the sequence node of the processes key, adding an empty
+// one if create is set.
+func (f *ConfigFile) processes(create bool) (*yaml.Node, error) {
+	root := f.doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "processes" {
+			continue
+		}
+		seq := root.Content[i+1]
+		// processes: with no value
+		if seq.Kind == yaml.ScalarNode && seq.Tag == "!!null" {
+			seq.Kind, seq.Tag, seq.Value = yaml.SequenceNode, "!!seq", ""
+		}
+		if seq.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("%s: processes is not a list", f.path)
+		}
+		return seq, nil
+	}
+
+	if !create {
+		return nil, nil
+	}
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "processes"}, seq)
+	return seq, nil
+}
+
+// program returns the processes list and the index of the definition of
+// name in it, or -1 if there is none.
+func (f *ConfigFile) program(name string) (*yaml.Node, int, error) {
+	seq, err := f.processes(false)
+	if err != nil || seq == nil {
+		return nil, -1, err
+	}
+	for i, item := range seq.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			if item.Content[j].Value == "name" && item.Content[j+1].Value == name {
+				return seq, i, nil
+			}
+		}
+	}
+	return seq, -1, nil
+}
+
+// Program returns the definition of program name as written in the file, or
+// nil if there is none.
+func (f *ConfigFile) Program(name string) (*yaml.Node, error) {
+	seq, i, err := f.program(name)
+	if err != nil || i < 0 {
+		return nil, err
+	}
+	return seq.Content[i], nil
+}
+
+// SetProgram replaces the definition of pc.Name, keeping the comments and
+// key order of the old one, or appends it if the program is new.
+func (f *ConfigFile) SetProgram(pc ProcessConfig) error {
+	node := &yaml.Node{}
+	if err := node.Encode(pc); err != nil {
+		return err
+	}
+
+	seq, i, err := f.program(pc.Name)
+	if err != nil {
+		return err
+	}
+	if i >= 0 {
+		keepLayout(seq.Content[i], node)
+		seq.Content[i] = node
+		return nil
+	}
+
+	if seq, err = f.processes(true); err != nil {
+		return err
+	}
+	seq.Content = append(seq.Content, node)
+	return nil
+}
+
+// RemoveProgram deletes the definition of program name and reports whether
+// there was one.
+func (f *ConfigFile) RemoveProgram(name string) (bool, error) {
+	seq, i, err := f.program(name)
+	if err != nil || i < 0 {
+		return false, err
+	}
+	seq.Content = append(seq.Content[:i], seq.Content[i+1:]...)
+	return true, nil
+}
+
+// Bytes encodes the file.
+func (f *ConfigFile) Bytes() ([]byte, error) {
+	data, err := EncodeNode(f.doc)
+	return []byte(data), err
+}
+
+// Save writes data to the file atomically: it is written to a temporary file
+// next to it, which then replaces the original. If the path is a symlink,
+// its target is replaced.
+func (f *ConfigFile) Save(data []byte) error {
+	path, err := filepath.EvalSymlinks(f.path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// EncodeNode returns node as YAML, e.g. a single program definition.
+func EncodeNode(node *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// keepLayout gives next the comments, key order and flow style of prev, so
+// that replacing a definition changes as few lines of the file as possible.
+// Keys only present in next are appended in their encoding order.
+func keepLayout(prev, next *yaml.Node) {
+	next.HeadComment = prev.HeadComment
+	next.LineComment = prev.LineComment
+	next.FootComment = prev.FootComment
+	if prev.Kind != next.Kind {
+		return
+	}
+	if next.Kind == yaml.SequenceNode || next.Kind == yaml.MappingNode {
+		next.Style = prev.Style
+	}
+	if next.Kind != yaml.MappingNode {
+		return
+	}
+
+	pos := make(map[string]int, len(next.Content)/2)
+	for i := 0; i+1 < len(next.Content); i += 2 {
+		pos[next.Content[i].Value] = i
+	}
+
+	content := make([]*yaml.Node, 0, len(next.Content))
+	used := make(map[string]bool, len(pos))
+	for i := 0; i+1 < len(prev.Content); i += 2 {
+		key := prev.Content[i]
+		j, ok := pos[key.Value]
+		if !ok {
+			continue
+		}
+		keepLayout(key, next.Content[j])
+		keepLayout(prev.Content[i+1], next.Content[j+1])
+		content = append(content, next.Content[j], next.Content[j+1])
+		used[key.Value] = true
+	}
+	for i := 0; i+1 < len(next.Content); i += 2 {
+		if !used[next.Content[i].Value] {
+			content = append(content, next.Content[i], next.Content[i+1])
+		}
+	}
+	next.Content = content
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// copyConfig copies testdata/edit/pupervisor.yaml to a temporary directory.
+func copyConfig(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "edit", "pupervisor.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "pupervisor.yaml")
+	if err := os.WriteFile(path, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestEditGolden applies program edits to a commented configuration file
+// and compares the saved file with testdata/edit/<name>.golden. Run with
+// -update to rewrite the golden files after an intended change.
+func TestEditGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(f *ConfigFile) error
+	}{
+		{
+			// yaml.v3 drops blank lines and aligns line comments, but keeps
+			// everything else as written; the other cases only differ from
+			// this one by their edit
+			name: "unchanged",
+			edit: func(f *ConfigFile) error { return nil },
+		},
+		{
+			// A new program is appended
+			name: "create",
+			edit: func(f *ConfigFile) error {
+				return f.SetProgram(ProcessConfig{
+					Name:         "scheduler",
+					Command:      "php",
+					Args:         []string{"artisan", "schedule:work"},
+					AutoStart:    true,
+					AutoRestart:  RestartAlways,
+					StartRetries: ptr(0),
+				})
+			},
+		},
+		{
+			// The changed program keeps its comments, key order and flow
+			// style; autorestart is removed, stoptimeout is appended
+			name: "update",
+			edit: func(f *ConfigFile) error {
+				return f.SetProgram(ProcessConfig{
+					Name:      "web",
+					Command:   "python3",
+					Args:      []string{"-m", "http.server", "8080"},
+					Directory: "/srv/web",
+					Environment: map[string]string{
+						"PYTHONUNBUFFERED": "1",
+						"PORT":             "8080",
+					},
+					AutoStart:   true,
+					StopTimeout: 30,
+				})
+			},
+		},
+		{
+			// Only the removed program and its own comments go away
+			name: "delete",
+			edit: func(f *ConfigFile) error {
+				removed, err := f.RemoveProgram("worker")
+				if err == nil && !removed {
+					t.Error("RemoveProgram(worker) found no program")
+				}
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := copyConfig(t)
+			f, err := OpenConfigFile(path)
+			if err != nil {
+				t.Fatalf("OpenConfigFile: %v", err)
+			}
+			if err := tt.edit(f); err != nil {
+				t.Fatalf("edit: %v", err)
+			}
+			data, err := f.Bytes()
+			if err != nil {
+				t.Fatalf("Bytes: %v", err)
+			}
+			if err := f.Save(data); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ParseConfig(got); err != nil {
+				t.Errorf("saved file does not load: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "edit", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("saved file differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestSaveKeepsModeAndSymlink(t *testing.T) {
+	path := copyConfig(t)
+	link := filepath.Join(filepath.Dir(path), "link.yaml")
+	if err := os.Symlink(path, link); err != nil {
+		t.Skipf("symlinks not available: %v", err)
+	}
+
+	f, err := OpenConfigFile(link)
+	if err != nil {
+		t.Fatalf("OpenConfigFile: %v", err)
+	}
+	if err := f.Save([]byte("processes: []\n")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("link was replaced: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "processes: []\n" {
+		t.Errorf("target content = %q", data)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 2 {
+		t.Errorf("directory has %d entries, want the file and the link only", len(entries))
+	}
+}
+
+func TestOpenConfigFileRejectsINI(t *testing.T) {
+	if _, err := OpenConfigFile("supervisord.conf"); err != ErrReadOnlyConfig {
+		t.Errorf("OpenConfigFile(supervisord.conf) error = %v, want ErrReadOnlyConfig", err)
+	}
+}
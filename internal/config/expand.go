@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// expansionPattern matches supervisord-style Python format expressions such
+// as %(program_name)s or %(process_num)02d.
+var expansionPattern = regexp.MustCompile(`%\(([A-Za-z0-9_]+)\)([-+ #0]*[0-9]*)([sd])`)
+
+// Expand replaces %(name)s / %(name)d expressions in s with values from vars.
+// Unknown names are left untouched.
+func Expand(s string, vars map[string]interface{}) string {
+	if s == "" {
+		return s
+	}
+
+	return expansionPattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := expansionPattern.FindStringSubmatch(match)
+		value, ok := vars[parts[1]]
+		if !ok {
+			return match
+		}
+
+		verb := "v"
+		if _, isInt := value.(int); isInt && parts[3] == "d" {
+			verb = "d"
+		}
+		return fmt.Sprintf("%"+parts[2]+verb, value)
+	})
+}
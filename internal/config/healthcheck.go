@@ -0,0 +1,88 @@
+package config
+
+import "fmt"
+
+const (
+	HealthCheckHTTP = "http"
+	HealthCheckTCP  = "tcp"
+	HealthCheckExec = "exec"
+
+	HealthActionRestart = "restart"
+	HealthActionIgnore  = "ignore"
+)
+
+// HealthCheckConfig describes how to probe a running process. Checks start
+// once the process is RUNNING; after FailureThreshold consecutive failures the
+// process is unhealthy and, with on_failure: restart, restarted.
+type HealthCheckConfig struct {
+	Type             string   `yaml:"type"`
+	URL              string   `yaml:"url,omitempty"`
+	ExpectedStatus   int      `yaml:"expected_status,omitempty"`
+	Address          string   `yaml:"address,omitempty"`
+	Command          string   `yaml:"command,omitempty"`
+	Args             []string `yaml:"args,omitempty"`
+	Interval         int      `yaml:"interval,omitempty"`
+	Timeout          int      `yaml:"timeout,omitempty"`
+	FailureThreshold int      `yaml:"failure_threshold,omitempty"`
+	OnFailure        string   `yaml:"on_failure,omitempty"`
+}
+
+func (hc *HealthCheckConfig) SetDefaults() {
+	if hc.ExpectedStatus == 0 {
+		hc.ExpectedStatus = 200
+	}
+	if hc.Interval == 0 {
+		hc.Interval = 10
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = 5
+	}
+	if hc.FailureThreshold == 0 {
+		hc.FailureThreshold = 3
+	}
+	if hc.OnFailure == "" {
+		hc.OnFailure = HealthActionRestart
+	}
+}
+
+func (hc *HealthCheckConfig) Validate() error {
+	switch hc.Type {
+	case HealthCheckHTTP:
+		if hc.URL == "" {
+			return fmt.Errorf("healthcheck: url is required for http checks")
+		}
+	case HealthCheckTCP:
+		if hc.Address == "" {
+			return fmt.Errorf("healthcheck: address is required for tcp checks")
+		}
+	case HealthCheckExec:
+		if hc.Command == "" {
+			return fmt.Errorf("healthcheck: command is required for exec checks")
+		}
+	default:
+		return fmt.Errorf("healthcheck: type must be http, tcp or exec")
+	}
+
+	if hc.Interval < 1 || hc.Timeout < 1 || hc.FailureThreshold < 1 {
+		return fmt.Errorf("healthcheck: interval, timeout and failure_threshold must be positive")
+	}
+	if hc.OnFailure != HealthActionRestart && hc.OnFailure != HealthActionIgnore {
+		return fmt.Errorf("healthcheck: on_failure must be restart or ignore")
+	}
+	return nil
+}
+
+// expand returns a copy with template variables expanded.
+func (hc *HealthCheckConfig) expand(vars map[string]interface{}) *HealthCheckConfig {
+	out := *hc
+	out.URL = Expand(hc.URL, vars)
+	out.Address = Expand(hc.Address, vars)
+	out.Command = Expand(hc.Command, vars)
+	if len(hc.Args) > 0 {
+		out.Args = make([]string, len(hc.Args))
+		for i, arg := range hc.Args {
+			out.Args[i] = Expand(arg, vars)
+		}
+	}
+	return &out
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"text/template"
+)
+
+const (
+	DefaultStormCrashes   = 5
+	DefaultStormWindow    = 10 * 60
+	DefaultRecoveryWindow = 60
+	DefaultDedupWindow    = 5 * 60
+	DefaultRateLimit      = 20
+	DefaultSMTPPort       = 587
+)
+
+// Notification events
+const (
+	EventCrash        = "crash"
+	EventFatal        = "fatal"
+	EventRestartStorm = "restart_storm"
+	EventRecovered    = "recovered"
+)
+
+var validEvents = map[string]bool{
+	EventCrash:        true,
+	EventFatal:        true,
+	EventRestartStorm: true,
+	EventRecovered:    true,
+}
+
+// Notification channel types
+const (
+	ChannelWebhook  = "webhook"
+	ChannelSlack    = "slack"
+	ChannelTelegram = "telegram"
+	ChannelEmail    = "email"
+)
+
+// NotificationsConfig sends process events to webhooks, chats and email.
+// A restart storm is StormCrashes crashes of one process within StormWindow
+// seconds. A process reported FATAL or in a storm has recovered once it has
+// been running for RecoveryWindow seconds without crashing. The same event of
+// the same process is sent at most once per DedupWindow seconds, and each
+// channel sends at most RateLimit messages a minute: DefaultRateLimit when
+// it is not set, any number when it is set to 0.
+type NotificationsConfig struct {
+	Events         []string              `yaml:"events,omitempty"`
+	StormCrashes   int                   `yaml:"storm_crashes,omitempty"`
+	StormWindow    int                   `yaml:"storm_window,omitempty"`
+	RecoveryWindow int                   `yaml:"recovery_window,omitempty"`
+	DedupWindow    int                   `yaml:"dedup_window,omitempty"`
+	RateLimit      *int                  `yaml:"rate_limit,omitempty"`
+	Templates      map[string]string     `yaml:"templates,omitempty"`
+	Channels       []NotifyChannelConfig `yaml:"channels,omitempty"`
+}
+
+// NotifyChannelConfig is one destination of notifications. Events and
+// Programs narrow down what it receives; Programs are glob patterns matched
+// against program and process names. Template replaces the message of every
+// event sent to it.
+type NotifyChannelConfig struct {
+	Name     string            `yaml:"name,omitempty"`
+	Type     string            `yaml:"type"`
+	URL      string            `yaml:"url,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	BotToken string            `yaml:"bot_token,omitempty"`
+	ChatID   string            `yaml:"chat_id,omitempty"`
+	SMTP     *SMTPConfig       `yaml:"smtp,omitempty"`
+	Events   []string          `yaml:"events,omitempty"`
+	Programs []string          `yaml:"programs,omitempty"`
+	Template string            `yaml:"template,omitempty"`
+	Subject  string            `yaml:"subject,omitempty"`
+}
+
+// SMTPConfig is the mail server of an email channel. Port 465 uses TLS from
+// the start; other ports upgrade with STARTTLS when the server offers it.
+type SMTPConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port,omitempty"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+func (nc *NotificationsConfig) SetDefaults() {
+	if len(nc.Events) == 0 {
+		nc.Events = []string{EventCrash, EventFatal, EventRestartStorm, EventRecovered}
+	}
+	if nc.StormCrashes == 0 {
+		nc.StormCrashes = DefaultStormCrashes
+	}
+	if nc.StormWindow == 0 {
+		nc.StormWindow = DefaultStormWindow
+	}
+	if nc.RecoveryWindow == 0 {
+		nc.RecoveryWindow = DefaultRecoveryWindow
+	}
+	if nc.DedupWindow == 0 {
+		nc.DedupWindow = DefaultDedupWindow
+	}
+	if nc.RateLimit == nil {
+		nc.RateLimit = ptr(DefaultRateLimit)
+	}
+	for i := range nc.Channels {
+		ch := &nc.Channels[i]
+		if ch.Name == "" {
+			ch.Name = fmt.Sprintf("%s-%d", ch.Type, i+1)
+		}
+		if ch.SMTP != nil && ch.SMTP.Port == 0 {
+			ch.SMTP.Port = DefaultSMTPPort
+		}
+	}
+}
+
+func (nc *NotificationsConfig) Validate() error {
+	if err := validateEvents(nc.Events); err != nil {
+		return fmt.Errorf("notifications: %w", err)
+	}
+	if nc.StormCrashes < 2 {
+		return fmt.Errorf("notifications: storm_crashes must be at least 2")
+	}
+	if nc.StormWindow < 0 || nc.RecoveryWindow < 0 || nc.DedupWindow < 0 || (nc.RateLimit != nil && *nc.RateLimit < 0) {
+		return fmt.Errorf("notifications: storm_window, recovery_window, dedup_window and rate_limit must not be negative")
+	}
+	for event, text := range nc.Templates {
+		if !validEvents[event] {
+			return fmt.Errorf("notifications: template for unknown event %q", event)
+		}
+		if _, err := template.New(event).Parse(text); err != nil {
+			return fmt.Errorf("notifications: template %s: %w", event, err)
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, ch := range nc.Channels {
+		if names[ch.Name] {
+			return fmt.Errorf("notifications: duplicate channel %q", ch.Name)
+		}
+		names[ch.Name] = true
+		if err := ch.Validate(); err != nil {
+			return fmt.Errorf("notifications: channel %s: %w", ch.Name, err)
+		}
+	}
+	return nil
+}
+
+func (ch *NotifyChannelConfig) Validate() error {
+	switch ch.Type {
+	case ChannelWebhook, ChannelSlack:
+		if ch.URL == "" {
+			return fmt.Errorf("url is required")
+		}
+	case ChannelTelegram:
+		if ch.BotToken == "" || ch.ChatID == "" {
+			return fmt.Errorf("bot_token and chat_id are required")
+		}
+	case ChannelEmail:
+		if ch.SMTP == nil || ch.SMTP.Host == "" || ch.SMTP.From == "" || len(ch.SMTP.To) == 0 {
+			return fmt.Errorf("smtp host, from and to are required")
+		}
+	default:
+		return fmt.Errorf("type must be webhook, slack, telegram or email")
+	}
+	if ch.Type != ChannelEmail && ch.SMTP != nil {
+		return fmt.Errorf("smtp is only used by email channels")
+	}
+
+	if err := validateEvents(ch.Events); err != nil {
+		return err
+	}
+	for _, pattern := range ch.Programs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid program pattern %q", pattern)
+		}
+	}
+	for name, text := range map[string]string{"template": ch.Template, "subject": ch.Subject} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func validateEvents(events []string) error {
+	for _, event := range events {
+		if !validEvents[event] {
+			return fmt.Errorf("unknown event %q, must be crash, fatal, restart_storm or recovered", event)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StartOrder returns program names in the order they should be started:
+// every program comes after the programs it depends on, and among programs
+// whose dependencies are satisfied the lowest priority (then name) goes
+// first. Stopping uses the reverse order. An error is returned when the
+// dependencies contain a cycle or name an unknown program.
+func StartOrder(programs []ProcessConfig) ([]string, error) {
+	byName := make(map[string]*ProcessConfig, len(programs))
+	for i := range programs {
+		byName[programs[i].Name] = &programs[i]
+	}
+
+	pending := make(map[string]int, len(programs))
+	dependents := make(map[string][]string)
+	for _, pc := range programs {
+		pending[pc.Name] = 0
+		for _, dep := range pc.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("program %s: depends_on references unknown program %q", pc.Name, dep)
+			}
+			if dep == pc.Name {
+				return nil, fmt.Errorf("program %s: cannot depend on itself", pc.Name)
+			}
+			pending[pc.Name]++
+			dependents[dep] = append(dependents[dep], pc.Name)
+		}
+	}
+
+	less := func(a, b string) bool {
+		pa, pb := byName[a].Priority, byName[b].Priority
+		if pa != pb {
+			return pa < pb
+		}
+		return a < b
+	}
+
+	var ready []string
+	for name, n := range pending {
+		if n == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	order := make([]string, 0, len(programs))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return less(ready[i], ready[j]) })
+		name := ready[0]
+		ready = ready[1:]
+		order = append(order, name)
+
+		for _, dependent := range dependents[name] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(order) < len(programs) {
+		return nil, fmt.Errorf("dependency cycle: %s", findCycle(byName, pending))
+	}
+
+	return order, nil
+}
+
+// findCycle returns a readable cycle ("a -> b -> a") among the programs that
+// could not be ordered.
+func findCycle(byName map[string]*ProcessConfig, pending map[string]int) string {
+	var names []string
+	for name, n := range pending {
+		if n > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	visiting := make(map[string]int)
+	var path []string
+	var walk func(name string) []string
+	walk = func(name string) []string {
+		if idx, ok := visiting[name]; ok {
+			return append(append([]string{}, path[idx:]...), name)
+		}
+		visiting[name] = len(path)
+		path = append(path, name)
+		for _, dep := range byName[name].DependsOn {
+			if pending[dep] > 0 {
+				if cycle := walk(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		delete(visiting, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if cycle := walk(name); cycle != nil {
+			return strings.Join(cycle, " -> ")
+		}
+	}
+	return strings.Join(names, ", ")
+}
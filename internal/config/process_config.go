@@ -1,53 +1,429 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	DefaultProcessName      = "%(program_name)s"
+	DefaultMultiProcessName = "%(program_name)s_%(process_num)02d"
+
+	DefaultLogMaxBytes ByteSize = 50 * 1024 * 1024
+	DefaultLogBackups           = 10
+
+	DefaultPriority     = 999
+	DefaultStartSecs    = 1
+	DefaultStartRetries = 3
+
+	DefaultMaxCPUWindow = 60
+)
+
+// namePattern restricts program and process names, which become paths below
+// the log and cgroup directories and parts of "group:name" selectors.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Program types. A simple program is expected to keep running; a oneshot
+// program runs to completion, and an expected exit leaves it SUCCEEDED.
+const (
+	TypeSimple  = "simple"
+	TypeOneshot = "oneshot"
+)
+
 type ProcessConfig struct {
-	Name        string            `yaml:"name"`
-	Command     string            `yaml:"command"`
-	Args        []string          `yaml:"args,omitempty"`
-	Directory   string            `yaml:"directory,omitempty"`
-	Environment map[string]string `yaml:"environment,omitempty"`
-	AutoStart   bool              `yaml:"autostart"`
-	AutoRestart bool              `yaml:"autorestart"`
-	StartSecs   int               `yaml:"startsecs,omitempty"`
-	StopSignal  string            `yaml:"stopsignal,omitempty"`
-	StopTimeout int               `yaml:"stoptimeout,omitempty"`
-	Stdout      string            `yaml:"stdout,omitempty"`
-	Stderr      string            `yaml:"stderr,omitempty"`
+	Name           string            `yaml:"name"`
+	Type           string            `yaml:"type,omitempty"`
+	Group          string            `yaml:"group,omitempty"`
+	NumProcs       int               `yaml:"numprocs,omitempty"`
+	NumProcsStart  int               `yaml:"numprocs_start,omitempty"`
+	ProcessName    string            `yaml:"process_name,omitempty"`
+	Command        string            `yaml:"command"`
+	Args           []string          `yaml:"args,omitempty"`
+	Directory      string            `yaml:"directory,omitempty"`
+	Environment    map[string]string `yaml:"environment,omitempty"`
+	User           string            `yaml:"user,omitempty"`
+	Umask          string            `yaml:"umask,omitempty"`
+	Priority       int               `yaml:"priority,omitempty"`
+	DependsOn      []string          `yaml:"depends_on,omitempty"`
+	AutoStart      bool              `yaml:"autostart"`
+	AutoRestart    AutoRestart       `yaml:"autorestart,omitempty"`
+	ExitCodes      []int             `yaml:"exitcodes,omitempty"`
+	StartSecs      *int              `yaml:"startsecs,omitempty"`
+	StartRetries   *int              `yaml:"startretries,omitempty"`
+	BackoffInitial int               `yaml:"backoff_initial,omitempty"`
+	BackoffMax     int               `yaml:"backoff_max,omitempty"`
+	StopSignal     string            `yaml:"stopsignal,omitempty"`
+	StopTimeout    int               `yaml:"stoptimeout,omitempty"`
+	StopAsGroup    bool              `yaml:"stopasgroup,omitempty"`
+	KillAsGroup    bool              `yaml:"killasgroup,omitempty"`
+	Stdout         string            `yaml:"stdout,omitempty"`
+	Stderr         string            `yaml:"stderr,omitempty"`
+	StdoutMaxBytes *ByteSize         `yaml:"stdout_logfile_maxbytes,omitempty"`
+	StdoutBackups  *int              `yaml:"stdout_logfile_backups,omitempty"`
+	StderrMaxBytes *ByteSize         `yaml:"stderr_logfile_maxbytes,omitempty"`
+	StderrBackups  *int              `yaml:"stderr_logfile_backups,omitempty"`
+	LogCompress    bool              `yaml:"logfile_compress,omitempty"`
+	RedirectStderr bool              `yaml:"redirect_stderr,omitempty"`
+	MaxMemory      ByteSize          `yaml:"max_memory,omitempty"`
+	MaxCPUPercent  float64           `yaml:"max_cpu_percent,omitempty"`
+	MaxCPUWindow   int               `yaml:"max_cpu_window,omitempty"`
+
+	HealthCheck *HealthCheckConfig `yaml:"healthcheck,omitempty"`
+	Rlimits     *RlimitsConfig     `yaml:"rlimits,omitempty"`
+	Cgroup      *CgroupConfig      `yaml:"cgroup,omitempty"`
+	Schedule    *ScheduleConfig    `yaml:"schedule,omitempty"`
 }
 
 type SupervisorConfig struct {
-	Processes []ProcessConfig `yaml:"processes"`
+	Processes []ProcessConfig  `yaml:"processes"`
+	Auth      AuthConfig       `yaml:"auth,omitempty"`
+	Cgroups   CgroupsConfig    `yaml:"cgroups,omitempty"`
+	Socket    UnixSocketConfig `yaml:"unix_socket,omitempty"`
+
+	Notifications NotificationsConfig `yaml:"notifications,omitempty"`
+
+	// Path is the file the configuration was loaded from, used for reloads
+	Path string `yaml:"-"`
+	// Warnings lists settings of a supervisord configuration that were
+	// ignored because pupervisor does not support them
+	Warnings []string `yaml:"-"`
 }
 
+// LoadProcessConfig loads a pupervisor YAML file, or a supervisord INI file
+// if the name ends in .conf or .ini.
 func LoadProcessConfig(path string) (*SupervisorConfig, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
+	var cfg *SupervisorConfig
+	if IsSupervisordConfig(path) {
+		var err error
+		if cfg, err = ReadSupervisordConfig(path); err != nil {
+			return nil, err
+		}
+		cfg.SetDefaults()
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if cfg, err = ParseConfig(data); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.Path = path
+	return cfg, nil
+}
+
+// ParseConfig parses a pupervisor YAML configuration, fills in defaults and
+// validates it.
+func ParseConfig(data []byte) (*SupervisorConfig, error) {
+	cfg := &SupervisorConfig{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
 
-	var cfg SupervisorConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	cfg.SetDefaults()
+	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
+	return cfg, nil
+}
+
+// SetDefaults fills in the defaults of every section.
+func (c *SupervisorConfig) SetDefaults() {
+	for i := range c.Processes {
+		c.Processes[i].SetDefaults()
+	}
+	c.Auth.SetDefaults()
+	c.Cgroups.SetDefaults()
+	c.Socket.SetDefaults()
+	c.Notifications.SetDefaults()
+}
 
-	// Set defaults
-	for i := range cfg.Processes {
-		if cfg.Processes[i].StopSignal == "" {
-			cfg.Processes[i].StopSignal = "SIGTERM"
+// SetDefaults fills in zero-valued fields with their defaults. Settings
+// where 0 has a meaning of its own, like startsecs, startretries or a log
+// size of 0 that disables rotation, are pointers and are only defaulted when they are
+// not set.
+func (pc *ProcessConfig) SetDefaults() {
+	if pc.Type == "" {
+		pc.Type = TypeSimple
+	}
+	if pc.AutoRestart == "" {
+		pc.AutoRestart = RestartNever
+	}
+	if len(pc.ExitCodes) == 0 {
+		pc.ExitCodes = []int{0}
+	}
+	if pc.StopSignal == "" {
+		pc.StopSignal = "SIGTERM"
+	}
+	if pc.StopTimeout == 0 {
+		pc.StopTimeout = 10
+	}
+	if pc.StartSecs == nil {
+		pc.StartSecs = ptr(DefaultStartSecs)
+	}
+	if pc.StartRetries == nil {
+		pc.StartRetries = ptr(DefaultStartRetries)
+	}
+	if pc.BackoffInitial == 0 {
+		pc.BackoffInitial = 1
+	}
+	if pc.BackoffMax == 0 {
+		pc.BackoffMax = 60
+	}
+	if pc.StdoutMaxBytes == nil {
+		pc.StdoutMaxBytes = ptr(DefaultLogMaxBytes)
+	}
+	if pc.StdoutBackups == nil {
+		pc.StdoutBackups = ptr(DefaultLogBackups)
+	}
+	if pc.StderrMaxBytes == nil {
+		pc.StderrMaxBytes = ptr(DefaultLogMaxBytes)
+	}
+	if pc.StderrBackups == nil {
+		pc.StderrBackups = ptr(DefaultLogBackups)
+	}
+	if pc.Priority == 0 {
+		pc.Priority = DefaultPriority
+	}
+	if pc.NumProcs == 0 {
+		pc.NumProcs = 1
+	}
+	if pc.Group == "" {
+		pc.Group = pc.Name
+	}
+	if pc.HealthCheck != nil {
+		pc.HealthCheck.SetDefaults()
+	}
+	if pc.Schedule != nil {
+		pc.Schedule.SetDefaults()
+	}
+	// Like supervisord, stopping the group implies killing it
+	if pc.StopAsGroup {
+		pc.KillAsGroup = true
+	}
+	if pc.MaxCPUPercent > 0 && pc.MaxCPUWindow == 0 {
+		pc.MaxCPUWindow = DefaultMaxCPUWindow
+	}
+	if pc.ProcessName == "" {
+		if pc.NumProcs > 1 {
+			pc.ProcessName = DefaultMultiProcessName
+		} else {
+			pc.ProcessName = DefaultProcessName
 		}
-		if cfg.Processes[i].StopTimeout == 0 {
-			cfg.Processes[i].StopTimeout = 10
+	}
+}
+
+// Validate checks a single program definition.
+func (pc *ProcessConfig) Validate() error {
+	if pc.Name == "" {
+		return fmt.Errorf("program name is required")
+	}
+	if !namePattern.MatchString(pc.Name) {
+		return fmt.Errorf("program name %q may only contain letters, digits, '_', '.' and '-', and must start with a letter or digit", pc.Name)
+	}
+	if pc.Command == "" {
+		return fmt.Errorf("program %s: command is required", pc.Name)
+	}
+	switch pc.Type {
+	case TypeSimple, TypeOneshot:
+	default:
+		return fmt.Errorf("program %s: type must be simple or oneshot", pc.Name)
+	}
+	if pc.Type == TypeOneshot && pc.AutoRestart == RestartAlways {
+		return fmt.Errorf("program %s: oneshot programs cannot use autorestart: true, use unexpected", pc.Name)
+	}
+	for _, code := range pc.ExitCodes {
+		if code < 0 || code > 255 {
+			return fmt.Errorf("program %s: exit code %d out of range 0-255", pc.Name, code)
 		}
-		if cfg.Processes[i].StartSecs == 0 {
-			cfg.Processes[i].StartSecs = 1
+	}
+	if pc.NumProcs < 1 {
+		return fmt.Errorf("program %s: numprocs must be at least 1", pc.Name)
+	}
+	if pc.NumProcsStart < 0 {
+		return fmt.Errorf("program %s: numprocs_start must not be negative", pc.Name)
+	}
+	if pc.Priority < 0 {
+		return fmt.Errorf("program %s: priority must not be negative", pc.Name)
+	}
+	if pc.StartSecs != nil && *pc.StartSecs < 0 {
+		return fmt.Errorf("program %s: startsecs must not be negative", pc.Name)
+	}
+	if pc.StartRetries != nil && *pc.StartRetries < 0 {
+		return fmt.Errorf("program %s: startretries must not be negative", pc.Name)
+	}
+	if pc.BackoffInitial < 0 || pc.BackoffMax < pc.BackoffInitial {
+		return fmt.Errorf("program %s: backoff_max must be greater than or equal to backoff_initial", pc.Name)
+	}
+	if pc.RedirectStderr && pc.Stderr != "" {
+		return fmt.Errorf("program %s: stderr cannot be set together with redirect_stderr", pc.Name)
+	}
+	if pc.MaxMemory < 0 {
+		return fmt.Errorf("program %s: max_memory must not be negative", pc.Name)
+	}
+	if pc.MaxCPUPercent < 0 || pc.MaxCPUWindow < 0 {
+		return fmt.Errorf("program %s: max_cpu_percent and max_cpu_window must not be negative", pc.Name)
+	}
+	if err := pc.validateCredentials(); err != nil {
+		return err
+	}
+	if pc.NumProcs > 1 && !pc.HasProcessNum() {
+		return fmt.Errorf("program %s: process_name must contain %%(process_num) when numprocs > 1", pc.Name)
+	}
+	for _, num := range pc.ProcessNums() {
+		if name := pc.InstanceName(num); !namePattern.MatchString(name) {
+			return fmt.Errorf("program %s: process name %q may only contain letters, digits, '_', '.' and '-', and must start with a letter or digit", pc.Name, name)
+		}
+	}
+	if pc.HealthCheck != nil {
+		if err := pc.HealthCheck.Validate(); err != nil {
+			return fmt.Errorf("program %s: %w", pc.Name, err)
+		}
+	}
+	if pc.Cgroup != nil {
+		if err := pc.Cgroup.Validate(); err != nil {
+			return fmt.Errorf("program %s: %w", pc.Name, err)
+		}
+	}
+	if pc.Schedule != nil {
+		if err := pc.Schedule.Validate(); err != nil {
+			return fmt.Errorf("program %s: %w", pc.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks every program, makes sure no two instances share a name and
+// rejects unknown or cyclic dependencies.
+func (c *SupervisorConfig) Validate() error {
+	programs := make(map[string]bool)
+	instances := make(map[string]string)
+
+	for i := range c.Processes {
+		pc := &c.Processes[i]
+		if err := pc.Validate(); err != nil {
+			return err
+		}
+		if programs[pc.Name] {
+			return fmt.Errorf("duplicate program name %q", pc.Name)
+		}
+		programs[pc.Name] = true
+
+		for _, num := range pc.ProcessNums() {
+			name := pc.InstanceName(num)
+			if owner, ok := instances[name]; ok {
+				return fmt.Errorf("program %s: process name %q already used by program %s", pc.Name, name, owner)
+			}
+			instances[name] = pc.Name
+		}
+	}
+
+	if _, err := StartOrder(c.Processes); err != nil {
+		return err
+	}
+
+	if err := c.Auth.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Cgroups.Validate(); err != nil {
+		return err
+	}
+	if err := c.Socket.Validate(); err != nil {
+		return err
+	}
+	if err := c.Notifications.Validate(); err != nil {
+		return err
+	}
+	for _, pc := range c.Processes {
+		if pc.Cgroup != nil && !c.Cgroups.Enabled {
+			return fmt.Errorf("program %s: cgroup limits need cgroups.enabled", pc.Name)
 		}
 	}
 
-	return &cfg, nil
+	return nil
+}
+
+// ExpectedExit reports whether code is listed in exitcodes.
+func (pc *ProcessConfig) ExpectedExit(code int) bool {
+	for _, c := range pc.ExitCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// HasProcessNum reports whether the process name template distinguishes instances.
+func (pc *ProcessConfig) HasProcessNum() bool {
+	return strings.Contains(pc.ProcessName, "%(process_num)")
+}
+
+// ProcessNums returns the process numbers of all instances of the program.
+func (pc *ProcessConfig) ProcessNums() []int {
+	nums := make([]int, 0, pc.NumProcs)
+	for i := 0; i < pc.NumProcs; i++ {
+		nums = append(nums, pc.NumProcsStart+i)
+	}
+	return nums
+}
+
+// InstanceName expands the process name template for the given process number.
+func (pc *ProcessConfig) InstanceName(num int) string {
+	return Expand(pc.ProcessName, pc.expandVars(num))
+}
+
+// Instance returns the configuration of a single program instance, with the
+// name set to the instance name and template variables expanded.
+func (pc *ProcessConfig) Instance(num int) ProcessConfig {
+	vars := pc.expandVars(num)
+
+	inst := *pc
+	inst.Name = pc.InstanceName(num)
+	vars["process_name"] = inst.Name
+	inst.Command = Expand(pc.Command, vars)
+	inst.Directory = Expand(pc.Directory, vars)
+	inst.Stdout = Expand(pc.Stdout, vars)
+	inst.Stderr = Expand(pc.Stderr, vars)
+
+	if len(pc.Args) > 0 {
+		inst.Args = make([]string, len(pc.Args))
+		for i, arg := range pc.Args {
+			inst.Args[i] = Expand(arg, vars)
+		}
+	}
+
+	if pc.HealthCheck != nil {
+		inst.HealthCheck = pc.HealthCheck.expand(vars)
+	}
+
+	if len(pc.Environment) > 0 {
+		inst.Environment = make(map[string]string, len(pc.Environment))
+		for k, v := range pc.Environment {
+			inst.Environment[k] = Expand(v, vars)
+		}
+	}
+
+	return inst
+}
+
+func (pc *ProcessConfig) expandVars(num int) map[string]interface{} {
+	return map[string]interface{}{
+		"program_name": pc.Name,
+		"group_name":   pc.Group,
+		"process_num":  num,
+	}
+}
+
+// ptr returns a pointer to a copy of v, for defaults of optional settings.
+func ptr[T any](v T) *T {
+	return &v
 }
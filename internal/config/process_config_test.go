@@ -0,0 +1,74 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateNames(t *testing.T) {
+	tests := []struct {
+		name        string
+		processName string
+		err         string
+	}{
+		{"web", "", ""},
+		{"queue-worker_2.x", "", ""},
+		{"9lives", "", ""},
+		{"web", "%(program_name)s-%(process_num)d", ""},
+		{"..", "", `program name ".."`},
+		{".", "", `program name "."`},
+		{".hidden", "", `program name ".hidden"`},
+		{"a/b", "", `program name "a/b"`},
+		{`a\b`, "", `program name "a\\b"`},
+		{"a b", "", `program name "a b"`},
+		{"a:b", "", `program name "a:b"`},
+		{"a\nb", "", `program name "a\nb"`},
+		{"-web", "", `program name "-web"`},
+		{"web", "../%(program_name)s", `process name "../web"`},
+		{"web", "%(program_name)s/x", `process name "web/x"`},
+	}
+
+	for _, tt := range tests {
+		pc := ProcessConfig{Name: tt.name, Command: "sleep", ProcessName: tt.processName}
+		pc.SetDefaults()
+		err := pc.Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("Validate(name %q, process_name %q): %v", tt.name, tt.processName, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Validate(name %q, process_name %q) error = %v, want one containing %q", tt.name, tt.processName, err, tt.err)
+		}
+	}
+}
+
+func TestParseConfigRejectsPathNames(t *testing.T) {
+	for _, name := range []string{"..", "a/b"} {
+		_, err := ParseConfig([]byte("processes:\n  - name: \"" + name + "\"\n    command: sleep\n"))
+		if err == nil {
+			t.Errorf("ParseConfig accepted program name %q", name)
+		}
+	}
+}
+
+func TestSetDefaultsKeepsZero(t *testing.T) {
+	pc := ProcessConfig{Name: "web", Command: "sleep"}
+	pc.SetDefaults()
+	if *pc.StartSecs != DefaultStartSecs || *pc.StartRetries != DefaultStartRetries {
+		t.Errorf("defaults: startsecs %d, startretries %d", *pc.StartSecs, *pc.StartRetries)
+	}
+
+	cfg, err := ParseConfig([]byte("processes:\n  - name: web\n    command: sleep\n    startsecs: 0\n    startretries: 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc := cfg.Processes[0]; *pc.StartSecs != 0 || *pc.StartRetries != 0 {
+		t.Errorf("explicit 0: startsecs %d, startretries %d", *pc.StartSecs, *pc.StartRetries)
+	}
+
+	if _, err := ParseConfig([]byte("processes:\n  - name: web\n    command: sleep\n    startsecs: -1\n")); err == nil {
+		t.Error("ParseConfig accepted startsecs: -1")
+	}
+}
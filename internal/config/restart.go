@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AutoRestart tells when an exited program is started again. It is written
+// in YAML as true, false or "unexpected", which restarts the program only
+// when it exits with a code not listed in exitcodes.
+type AutoRestart string
+
+const (
+	RestartNever      AutoRestart = "false"
+	RestartAlways     AutoRestart = "true"
+	RestartUnexpected AutoRestart = "unexpected"
+)
+
+// ParseAutoRestart parses an autorestart value as written in pupervisor or
+// supervisord configuration files.
+func ParseAutoRestart(s string) (AutoRestart, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "yes", "on", "1":
+		return RestartAlways, nil
+	case "false", "no", "off", "0", "":
+		return RestartNever, nil
+	case "unexpected":
+		return RestartUnexpected, nil
+	}
+	return "", fmt.Errorf("invalid autorestart %q, must be true, false or unexpected", s)
+}
+
+func (r *AutoRestart) UnmarshalYAML(node *yaml.Node) error {
+	value, err := ParseAutoRestart(node.Value)
+	if err != nil {
+		return err
+	}
+	*r = value
+	return nil
+}
+
+// MarshalYAML writes true and false as booleans.
+func (r AutoRestart) MarshalYAML() (interface{}, error) {
+	if r == RestartUnexpected {
+		return string(r), nil
+	}
+	return r == RestartAlways, nil
+}
+
+// Restarts reports whether a program that exited is started again. expected
+// tells whether the exit code was listed in exitcodes.
+func (r AutoRestart) Restarts(expected bool) bool {
+	return r == RestartAlways || (r == RestartUnexpected && !expected)
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"pupervisor/internal/cron"
+)
+
+const (
+	OverlapSkip    = "skip"
+	OverlapQueue   = "queue"
+	OverlapReplace = "replace"
+)
+
+// ScheduleConfig starts a program on a cron schedule. Overlap decides what
+// happens when a run is due while the previous one is still going: skip it,
+// queue it to start once the previous run exits, or stop the previous run
+// and start a new one.
+type ScheduleConfig struct {
+	Cron     string `yaml:"cron"`
+	Timezone string `yaml:"timezone,omitempty"`
+	Overlap  string `yaml:"overlap,omitempty"`
+}
+
+func (sc *ScheduleConfig) SetDefaults() {
+	if sc.Overlap == "" {
+		sc.Overlap = OverlapSkip
+	}
+}
+
+func (sc *ScheduleConfig) Validate() error {
+	s, err := sc.Parse()
+	if err != nil {
+		return fmt.Errorf("schedule: %w", err)
+	}
+	if s.Next(time.Now()).IsZero() {
+		return fmt.Errorf("schedule: %q never matches", sc.Cron)
+	}
+	switch sc.Overlap {
+	case OverlapSkip, OverlapQueue, OverlapReplace:
+	default:
+		return fmt.Errorf("schedule: overlap must be skip, queue or replace")
+	}
+	return nil
+}
+
+// Parse parses the cron expression in the configured time zone, which
+// defaults to the local time zone of pupervisor.
+func (sc *ScheduleConfig) Parse() (*cron.Schedule, error) {
+	loc := time.Local
+	if sc.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(sc.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", sc.Timezone)
+		}
+	}
+	return cron.Parse(sc.Cron, loc)
+}
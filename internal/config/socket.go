@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const DefaultSocketMode = "0700"
+
+// UnixSocketConfig serves the API on a Unix domain socket, in addition to
+// the TCP address or instead of it. Clients on the socket are identified by
+// their peer credentials and matched against Peers.
+type UnixSocketConfig struct {
+	Path       string       `yaml:"path,omitempty"`
+	Mode       string       `yaml:"mode,omitempty"`
+	Owner      string       `yaml:"owner,omitempty"`
+	DisableTCP bool         `yaml:"disable_tcp,omitempty"`
+	Peers      []PeerConfig `yaml:"peers,omitempty"`
+}
+
+// PeerConfig grants a role to socket clients running as User, or as a member
+// of Group.
+type PeerConfig struct {
+	User  string `yaml:"user,omitempty"`
+	Group string `yaml:"group,omitempty"`
+	Role  string `yaml:"role"`
+}
+
+func (sc *UnixSocketConfig) SetDefaults() {
+	if sc.Path != "" && sc.Mode == "" {
+		sc.Mode = DefaultSocketMode
+	}
+	for i := range sc.Peers {
+		if sc.Peers[i].Role == "" {
+			sc.Peers[i].Role = "viewer"
+		}
+	}
+}
+
+func (sc *UnixSocketConfig) Validate() error {
+	if sc.Path == "" {
+		if sc.DisableTCP || sc.Owner != "" || len(sc.Peers) > 0 {
+			return fmt.Errorf("unix_socket: path is required")
+		}
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("unix_socket: not supported on windows")
+	}
+
+	if _, err := ParseFileMode(sc.Mode); err != nil {
+		return fmt.Errorf("unix_socket: %w", err)
+	}
+	if sc.Owner != "" {
+		id, err := LookupIdentity(sc.Owner)
+		if err != nil {
+			return fmt.Errorf("unix_socket: owner: %w", err)
+		}
+		if euid := os.Geteuid(); euid != 0 && uint32(euid) != id.UID {
+			return fmt.Errorf("unix_socket: changing the owner to %s requires pupervisor to run as root", sc.Owner)
+		}
+	}
+
+	if len(sc.Peers) > 0 && runtime.GOOS != "linux" {
+		return fmt.Errorf("unix_socket: peers are only supported on linux")
+	}
+	for _, p := range sc.Peers {
+		if (p.User == "") == (p.Group == "") {
+			return fmt.Errorf("unix_socket: each peer needs either user or group")
+		}
+		if !validRoles[p.Role] {
+			return fmt.Errorf("unix_socket: peer %s%s: role must be viewer, operator or admin", p.User, p.Group)
+		}
+		if _, err := p.ID(); err != nil {
+			return fmt.Errorf("unix_socket: peer: %w", err)
+		}
+	}
+	return nil
+}
+
+// ID resolves the peer's user or group to its numeric id.
+func (p PeerConfig) ID() (uint32, error) {
+	var id string
+	if p.User != "" {
+		u, err := user.Lookup(p.User)
+		if err != nil {
+			if u, err = user.LookupId(p.User); err != nil {
+				return 0, fmt.Errorf("unknown user %q", p.User)
+			}
+		}
+		id = u.Uid
+	} else {
+		g, err := user.LookupGroup(p.Group)
+		if err != nil {
+			if g, err = user.LookupGroupId(p.Group); err != nil {
+				return 0, fmt.Errorf("unknown group %q", p.Group)
+			}
+		}
+		id = g.Gid
+	}
+
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s%s has no numeric id", p.User, p.Group)
+	}
+	return uint32(n), nil
+}
+
+// ParseFileMode parses octal file permissions such as "0770" or "0o660".
+func ParseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,635 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IsSupervisordConfig reports whether path names a supervisord INI file
+// rather than a pupervisor YAML file, judging by its extension.
+func IsSupervisordConfig(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".conf", ".ini":
+		return true
+	}
+	return false
+}
+
+type iniSection struct {
+	name string
+	file string
+	line int
+	keys []iniKey
+}
+
+type iniKey struct {
+	name  string
+	value string
+	line  int
+}
+
+func (s *iniSection) where(k iniKey) string {
+	return fmt.Sprintf("%s:%d: [%s] %s", s.file, k.line, s.name, k.name)
+}
+
+// readINI parses a file in Python's ConfigParser syntax: "key = value" or
+// "key: value" lines in [sections], ";" and "#" comments, and indented
+// continuation lines. Key names are case-insensitive.
+func readINI(path string) ([]*iniSection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sections []*iniSection
+	var current *iniSection
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if raw[0] == ' ' || raw[0] == '\t' {
+			if current == nil || len(current.keys) == 0 {
+				return nil, fmt.Errorf("%s:%d: unexpected indented line", path, n)
+			}
+			k := &current.keys[len(current.keys)-1]
+			k.value = strings.TrimSpace(k.value + "\n" + stripComment(line))
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%s:%d: invalid section header %q", path, n, line)
+			}
+			current = &iniSection{name: strings.TrimSpace(line[1 : len(line)-1]), file: path, line: n}
+			sections = append(sections, current)
+			continue
+		}
+
+		i := strings.IndexAny(line, "=:")
+		if i <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected key = value, got %q", path, n, line)
+		}
+		if current == nil {
+			return nil, fmt.Errorf("%s:%d: key outside of a section", path, n)
+		}
+		current.keys = append(current.keys, iniKey{
+			name:  strings.ToLower(strings.TrimSpace(line[:i])),
+			value: stripComment(strings.TrimSpace(line[i+1:])),
+			line:  n,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+// stripComment removes an inline comment, which starts with ";" or "#"
+// after whitespace.
+func stripComment(s string) string {
+	for i := 1; i < len(s); i++ {
+		if (s[i] == ';' || s[i] == '#') && (s[i-1] == ' ' || s[i-1] == '\t') {
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return s
+}
+
+// readSupervisordFiles reads path and, recursively, the files matched by
+// the globs of its [include] sections, which are relative to the including
+// file.
+func readSupervisordFiles(path string, seen map[string]bool) ([]*iniSection, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if seen[abs] {
+		return nil, nil
+	}
+	seen[abs] = true
+
+	sections, err := readINI(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	all := sections
+	for _, s := range sections {
+		if s.name != "include" {
+			continue
+		}
+		for _, k := range s.keys {
+			if k.name != "files" {
+				continue
+			}
+			vars := iniVars(filepath.Dir(abs))
+			for _, pattern := range strings.Fields(expandINI(k.value, vars, nil)) {
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(filepath.Dir(abs), pattern)
+				}
+				matches, err := filepath.Glob(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid include pattern %q", s.where(k), pattern)
+				}
+				sort.Strings(matches)
+				for _, match := range matches {
+					included, err := readSupervisordFiles(match, seen)
+					if err != nil {
+						return nil, err
+					}
+					all = append(all, included...)
+				}
+			}
+		}
+	}
+	return all, nil
+}
+
+// iniPattern matches %(name)s expressions and the %% escape.
+var iniPattern = regexp.MustCompile(`%%|%\(([A-Za-z0-9_]+)\)[-+ #0]*[0-9]*[sd]`)
+
+// iniVars returns the variables available in every section: the
+// environment as ENV_X, here (the directory of the file) and host_node_name.
+func iniVars(here string) map[string]interface{} {
+	vars := map[string]interface{}{"here": here}
+	if host, err := os.Hostname(); err == nil {
+		vars["host_node_name"] = host
+	}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars["ENV_"+k] = v
+		}
+	}
+	return vars
+}
+
+// expandINI expands %(name)s expressions like supervisord. %(process_num)
+// is kept for Expand to fill in per instance; unknown names are kept and
+// reported to unknown.
+func expandINI(s string, vars map[string]interface{}, unknown func(name string)) string {
+	return iniPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "%%" {
+			return "%"
+		}
+		name := iniPattern.FindStringSubmatch(match)[1]
+		if name == "process_num" {
+			return match
+		}
+		if _, ok := vars[name]; !ok {
+			if unknown != nil {
+				unknown(name)
+			}
+			return match
+		}
+		return Expand(match, vars)
+	})
+}
+
+// supervisordReader converts the sections of a supervisord configuration,
+// collecting warnings about settings pupervisor does not support.
+type supervisordReader struct {
+	cfg      *SupervisorConfig
+	warnings []string
+}
+
+func (r *supervisordReader) warn(format string, args ...interface{}) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+// ReadSupervisordConfig reads a supervisord configuration file, including
+// the files named in [include], and converts its [program:x], [group:x] and
+// [unix_http_server] sections. %(ENV_X)s, %(here)s, %(program_name)s,
+// %(group_name)s, %(host_node_name)s and %(numprocs)d are expanded;
+// %(process_num)d is left for each instance. Settings without a pupervisor
+// equivalent are skipped and listed in Warnings. Defaults are not applied.
+func ReadSupervisordConfig(path string) (*SupervisorConfig, error) {
+	sections, err := readSupervisordFiles(path, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &supervisordReader{cfg: &SupervisorConfig{Processes: []ProcessConfig{}}}
+	seen := make(map[string]*iniSection)
+	programs := make(map[string]*iniSection)
+	var programOrder []string
+	for _, s := range sections {
+		if prev, ok := seen[s.name]; ok && s.name != "include" {
+			return nil, fmt.Errorf("%s:%d: duplicate section [%s], first defined at %s:%d", s.file, s.line, s.name, prev.file, prev.line)
+		}
+		seen[s.name] = s
+
+		kind, name, _ := strings.Cut(s.name, ":")
+		switch kind {
+		case "program":
+			if name == "" {
+				return nil, fmt.Errorf("%s:%d: program name is required", s.file, s.line)
+			}
+			programs[name] = s
+			programOrder = append(programOrder, name)
+		case "group", "include", "unix_http_server":
+		case "supervisorctl", "rpcinterface":
+			// Client and XML-RPC settings, pupervisor serves both natively
+		case "eventlistener", "fcgi-program":
+			r.warn("%s:%d: [%s] is not supported, section ignored", s.file, s.line, s.name)
+		default:
+			names := make([]string, len(s.keys))
+			for i, k := range s.keys {
+				names[i] = k.name
+			}
+			r.warn("%s:%d: [%s] is not supported, section ignored (%s)", s.file, s.line, s.name, strings.Join(names, ", "))
+		}
+	}
+
+	groups, groupPriority, err := r.readGroups(sections, programs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range programOrder {
+		pc, err := r.readProgram(programs[name], name, groups[name], groupPriority[groups[name]])
+		if err != nil {
+			return nil, err
+		}
+		r.cfg.Processes = append(r.cfg.Processes, pc)
+	}
+
+	for _, s := range sections {
+		if s.name == "unix_http_server" {
+			r.readUnixHTTPServer(s)
+		}
+	}
+
+	r.cfg.Warnings = r.warnings
+	return r.cfg, nil
+}
+
+// readGroups maps programs to the [group:x] section listing them, and
+// groups to their priority.
+func (r *supervisordReader) readGroups(sections []*iniSection, programs map[string]*iniSection) (map[string]string, map[string]int, error) {
+	groups := make(map[string]string)
+	priorities := make(map[string]int)
+	for _, s := range sections {
+		kind, group, _ := strings.Cut(s.name, ":")
+		if kind != "group" {
+			continue
+		}
+		vars := iniVars(filepath.Dir(s.file))
+		vars["group_name"] = group
+
+		for _, k := range s.keys {
+			value := expandINI(k.value, vars, nil)
+			switch k.name {
+			case "programs":
+				for _, program := range strings.Split(value, ",") {
+					program = strings.TrimSpace(program)
+					if program == "" {
+						continue
+					}
+					if _, ok := programs[program]; !ok {
+						return nil, nil, fmt.Errorf("%s: no [program:%s] section", s.where(k), program)
+					}
+					if other, ok := groups[program]; ok {
+						r.warn("%s: program %s is already in group %s, only one group is supported", s.where(k), program, other)
+						continue
+					}
+					groups[program] = group
+				}
+			case "priority":
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s: invalid number %q", s.where(k), value)
+				}
+				priorities[group] = n
+			default:
+				r.warn("%s is not supported", s.where(k))
+			}
+		}
+	}
+	return groups, priorities, nil
+}
+
+// unsupportedProgramKeys are supervisord program settings without a
+// pupervisor equivalent.
+var unsupportedProgramKeys = map[string]bool{
+	"stdout_capture_maxbytes": true,
+	"stderr_capture_maxbytes": true,
+	"stdout_events_enabled":   true,
+	"stderr_events_enabled":   true,
+	"stdout_syslog":           true,
+	"stderr_syslog":           true,
+	"serverurl":               true,
+}
+
+// readProgram converts a [program:x] section. Programs listed in a
+// [group:x] section use the group's priority unless they set their own.
+func (r *supervisordReader) readProgram(s *iniSection, name, group string, groupPriority int) (ProcessConfig, error) {
+	pc := ProcessConfig{
+		Name:  name,
+		Group: group,
+		// supervisord's defaults differ from pupervisor's
+		AutoStart:   true,
+		AutoRestart: RestartUnexpected,
+		Priority:    groupPriority,
+	}
+
+	values := make(map[string]string)
+	for _, k := range s.keys {
+		values[k.name] = k.value
+	}
+
+	vars := iniVars(filepath.Dir(s.file))
+	vars["program_name"] = name
+	vars["group_name"] = name
+	if group != "" {
+		vars["group_name"] = group
+	}
+	vars["numprocs"] = 1
+	if n, err := strconv.Atoi(strings.TrimSpace(values["numprocs"])); err == nil {
+		vars["numprocs"] = n
+	}
+
+	for _, k := range s.keys {
+		where := s.where(k)
+		value := expandINI(k.value, vars, func(v string) {
+			r.warn("%s: %%(%s)s cannot be expanded", where, v)
+		})
+
+		var err error
+		switch k.name {
+		case "command":
+			var args []string
+			if args, err = splitCommand(value); err == nil {
+				if len(args) == 0 {
+					err = fmt.Errorf("command is empty")
+				} else {
+					pc.Command, pc.Args = args[0], args[1:]
+				}
+			}
+		case "process_name":
+			pc.ProcessName = value
+		case "numprocs":
+			pc.NumProcs, err = strconv.Atoi(value)
+		case "numprocs_start":
+			pc.NumProcsStart, err = strconv.Atoi(value)
+		case "priority":
+			pc.Priority, err = strconv.Atoi(value)
+		case "autostart":
+			pc.AutoStart, err = parseINIBool(value)
+		case "autorestart":
+			pc.AutoRestart, err = ParseAutoRestart(value)
+		case "exitcodes":
+			pc.ExitCodes, err = parseExitCodes(value)
+		case "startsecs":
+			var n int
+			if n, err = strconv.Atoi(value); err == nil {
+				pc.StartSecs = &n
+			}
+		case "startretries":
+			var n int
+			if n, err = strconv.Atoi(value); err == nil {
+				pc.StartRetries = &n
+			}
+		case "stopsignal":
+			pc.StopSignal = strings.ToUpper(value)
+			if !strings.HasPrefix(pc.StopSignal, "SIG") {
+				pc.StopSignal = "SIG" + pc.StopSignal
+			}
+			switch pc.StopSignal {
+			case "SIGTERM", "SIGINT", "SIGKILL":
+			default:
+				r.warn("%s: %s is not supported, using SIGTERM", where, pc.StopSignal)
+				pc.StopSignal = "SIGTERM"
+			}
+		case "stopwaitsecs":
+			pc.StopTimeout, err = r.positive(where, value)
+		case "stopasgroup":
+			pc.StopAsGroup, err = parseINIBool(value)
+		case "killasgroup":
+			pc.KillAsGroup, err = parseINIBool(value)
+		case "user":
+			pc.User = value
+		case "umask":
+			pc.Umask = value
+		case "directory":
+			pc.Directory = value
+		case "environment":
+			pc.Environment, err = parseEnvironment(value)
+		case "redirect_stderr":
+			pc.RedirectStderr, err = parseINIBool(value)
+		case "stdout_logfile":
+			pc.Stdout = r.logfile(where, value)
+		case "stderr_logfile":
+			pc.Stderr = r.logfile(where, value)
+		case "stdout_logfile_maxbytes":
+			pc.StdoutMaxBytes, err = parseINILogMaxBytes(value)
+		case "stderr_logfile_maxbytes":
+			pc.StderrMaxBytes, err = parseINILogMaxBytes(value)
+		case "stdout_logfile_backups":
+			pc.StdoutBackups, err = parseINILogBackups(value)
+		case "stderr_logfile_backups":
+			pc.StderrBackups, err = parseINILogBackups(value)
+		default:
+			if unsupportedProgramKeys[k.name] {
+				r.warn("%s is not supported", where)
+			} else {
+				r.warn("%s is an unknown setting", where)
+			}
+		}
+		if err != nil {
+			return pc, fmt.Errorf("%s: %v", where, err)
+		}
+	}
+
+	// supervisord ignores stderr_logfile when stderr is redirected
+	if pc.RedirectStderr && pc.Stderr != "" {
+		r.warn("%s:%d: [%s] stderr_logfile is ignored because of redirect_stderr", s.file, s.line, s.name)
+		pc.Stderr = ""
+	}
+	return pc, nil
+}
+
+// positive parses a number of seconds. pupervisor replaces 0 by
+// its default, so 0 cannot be converted.
+func (r *supervisordReader) positive(where, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	if n == 0 {
+		r.warn("%s: 0 is not supported, using the default", where)
+	}
+	return n, nil
+}
+
+// logfile converts stdout_logfile and stderr_logfile. Without a file,
+// pupervisor keeps the output in memory only.
+func (r *supervisordReader) logfile(where, value string) string {
+	switch strings.ToUpper(value) {
+	case "", "NONE":
+		return ""
+	case "AUTO":
+		r.warn("%s: AUTO is not supported, output is only kept in memory", where)
+		return ""
+	case "SYSLOG":
+		r.warn("%s: syslog is not supported, output is only kept in memory", where)
+		return ""
+	}
+	return value
+}
+
+// readUnixHTTPServer converts [unix_http_server] to the unix_socket section.
+func (r *supervisordReader) readUnixHTTPServer(s *iniSection) {
+	vars := iniVars(filepath.Dir(s.file))
+	for _, k := range s.keys {
+		value := expandINI(k.value, vars, nil)
+		switch k.name {
+		case "file":
+			r.cfg.Socket.Path = value
+		case "chmod":
+			r.cfg.Socket.Mode = value
+		case "chown":
+			r.cfg.Socket.Owner = value
+		case "username", "password":
+			r.warn("%s is not supported, use auth.users or unix_socket.peers", s.where(k))
+		default:
+			r.warn("%s is an unknown setting", s.where(k))
+		}
+	}
+}
+
+func parseINIBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+// parseExitCodes parses a comma separated list of exit codes.
+func parseExitCodes(s string) ([]int, error) {
+	var codes []int
+	for _, part := range strings.Split(s, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid exit code %q", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// parseINILogMaxBytes converts a log size, where 0 disables rotation as in
+// supervisord.
+func parseINILogMaxBytes(s string) (*ByteSize, error) {
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return nil, err
+	}
+	return &size, nil
+}
+
+// parseINILogBackups converts a number of backups, where 0 keeps none.
+func parseINILogBackups(s string) (*int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return &n, nil
+}
+
+// splitCommand splits a command line like a POSIX shell, honouring single
+// and double quotes and backslash escapes, but without any expansion.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]):
+				i++
+				cur.WriteRune(runes[i])
+			default:
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == '\\':
+			if i+1 < len(runes) {
+				i++
+				cur.WriteRune(runes[i])
+			}
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// parseEnvironment parses supervisord's KEY="value",KEY2=value2 list.
+func parseEnvironment(s string) (map[string]string, error) {
+	env := make(map[string]string)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", \t\n") {
+		key, rest, ok := strings.Cut(s, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid environment %q, expected KEY=value", s)
+		}
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			end := strings.IndexByte(rest[1:], rest[0])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in environment variable %s", key)
+			}
+			value, s = rest[1:end+1], rest[end+2:]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
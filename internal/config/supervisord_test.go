@@ -0,0 +1,314 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"php artisan queue:work", []string{"php", "artisan", "queue:work"}},
+		{"  a \t b\nc  ", []string{"a", "b", "c"}},
+		{`sh -c 'echo "$HOME"; exit 1'`, []string{"sh", "-c", `echo "$HOME"; exit 1`}},
+		{`echo "a b" 'c d'`, []string{"echo", "a b", "c d"}},
+		{`echo "say \"hi\" \$x \\ \n"`, []string{"echo", `say "hi" $x \ \n`}},
+		{`echo 'no \escapes'`, []string{"echo", `no \escapes`}},
+		{`echo a\ b \"c`, []string{"echo", "a b", `"c`}},
+		{`echo "" ''`, []string{"echo", "", ""}},
+		{`--opt="a b"c`, []string{"--opt=a bc"}},
+		{`echo héllo`, []string{"echo", "héllo"}},
+	}
+
+	for _, tt := range tests {
+		got, err := splitCommand(tt.in)
+		if err != nil {
+			t.Errorf("splitCommand(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitCommandErrors(t *testing.T) {
+	for _, in := range []string{`echo "a`, `echo 'a`, `echo "a\"`} {
+		if got, err := splitCommand(in); err == nil {
+			t.Errorf("splitCommand(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestParseEnvironment(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]string
+	}{
+		{"", map[string]string{}},
+		{"A=1", map[string]string{"A": "1"}},
+		{"A=1,B=2", map[string]string{"A": "1", "B": "2"}},
+		{` A = 1 , B=two words `, map[string]string{"A": "1", "B": "two words"}},
+		{`A="x,y",B='q "z"'`, map[string]string{"A": "x,y", "B": `q "z"`}},
+		{"A=\"1\",\nB=2", map[string]string{"A": "1", "B": "2"}},
+		{"A=,B=", map[string]string{"A": "", "B": ""}},
+		{`URL=http://h/?a=b`, map[string]string{"URL": "http://h/?a=b"}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseEnvironment(tt.in)
+		if err != nil {
+			t.Errorf("parseEnvironment(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseEnvironment(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseEnvironmentErrors(t *testing.T) {
+	for _, in := range []string{"A", "=1", `A="1`, "A=1,B", `A="x,y",B='it''s'`} {
+		if got, err := parseEnvironment(in); err == nil {
+			t.Errorf("parseEnvironment(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestReadINI(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "supervisord.conf", `; leading comment
+# another comment
+[program:web]
+Command = python app.py ; inline comment
+directory: /srv/app
+environment = A="1",
+	B="2"   ; comment on a continuation
+  C="a;b"
+url = http://h/#anchor
+
+[group:all]
+programs=web
+`)
+
+	sections, err := readINI(path)
+	if err != nil {
+		t.Fatalf("readINI: %v", err)
+	}
+	if len(sections) != 2 {
+		t.Fatalf("got %d sections, want 2", len(sections))
+	}
+
+	web := sections[0]
+	if web.name != "program:web" || web.line != 3 {
+		t.Errorf("section = %q at line %d, want program:web at line 3", web.name, web.line)
+	}
+	want := []iniKey{
+		{name: "command", value: "python app.py", line: 4},
+		{name: "directory", value: "/srv/app", line: 5},
+		{name: "environment", value: "A=\"1\",\nB=\"2\"\nC=\"a;b\"", line: 6},
+		{name: "url", value: "http://h/#anchor", line: 9},
+	}
+	if !reflect.DeepEqual(web.keys, want) {
+		t.Errorf("keys = %q, want %q", web.keys, want)
+	}
+
+	if group := sections[1]; group.name != "group:all" || len(group.keys) != 1 || group.keys[0].value != "web" {
+		t.Errorf("group section = %+v", group)
+	}
+}
+
+func TestReadINIErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"key outside of a section", "command=x\n", ":1: key outside of a section"},
+		{"indented first line", "  command=x\n", ":1: unexpected indented line"},
+		{"unterminated section", "[program:x\n", ":1: invalid section header"},
+		{"no separator", "[program:x]\ncommand\n", ":2: expected key = value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), "s.conf", tt.content)
+			_, err := readINI(path)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("readINI error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExpandINI(t *testing.T) {
+	vars := map[string]interface{}{
+		"here":         "/etc/supervisor",
+		"program_name": "worker",
+		"numprocs":     4,
+		"ENV_HOME":     "/home/app",
+	}
+
+	tests := []struct {
+		in      string
+		want    string
+		unknown []string
+	}{
+		{"plain", "plain", nil},
+		{"100%%", "100%", nil},
+		{"%(here)s/conf.d/*.conf", "/etc/supervisor/conf.d/*.conf", nil},
+		{"%(ENV_HOME)s/bin/%(program_name)s", "/home/app/bin/worker", nil},
+		{"--workers=%(numprocs)d", "--workers=4", nil},
+		{"%(program_name)s_%(process_num)02d", "worker_%(process_num)02d", nil},
+		{"%(missing)s and %(ENV_NOPE)s", "%(missing)s and %(ENV_NOPE)s", []string{"missing", "ENV_NOPE"}},
+	}
+
+	for _, tt := range tests {
+		var unknown []string
+		got := expandINI(tt.in, vars, func(name string) { unknown = append(unknown, name) })
+		if got != tt.want {
+			t.Errorf("expandINI(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if !reflect.DeepEqual(unknown, tt.unknown) {
+			t.Errorf("expandINI(%q) reported unknown %q, want %q", tt.in, unknown, tt.unknown)
+		}
+	}
+}
+
+func TestReadSupervisordConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "conf.d/queue.conf", `[program:queue]
+command = php artisan queue:work --name=%(program_name)s_%(process_num)d
+process_name = %(program_name)s_%(process_num)02d
+numprocs = 3
+numprocs_start = 1
+stdout_logfile = %(here)s/%(process_num)d.log
+stdout_logfile_maxbytes = 0
+startsecs = 0
+startretries = 0
+stdout_events_enabled = true
+`)
+	path := writeFile(t, dir, "supervisord.conf", `[unix_http_server]
+file = /run/supervisor.sock
+chmod = 0770
+
+[program:web]
+command = sh -c "exec python -m http.server 8000"
+environment = PORT="8000",
+	NAME='web app'
+autorestart = true
+stopsignal = INT
+priority = 5
+
+[group:apps]
+programs = web,queue
+priority = 10
+
+[include]
+files = conf.d/*.conf
+`)
+
+	cfg, err := ReadSupervisordConfig(path)
+	if err != nil {
+		t.Fatalf("ReadSupervisordConfig: %v", err)
+	}
+	if len(cfg.Processes) != 2 {
+		t.Fatalf("got %d programs, want 2", len(cfg.Processes))
+	}
+
+	web := cfg.Processes[0]
+	if web.Name != "web" || web.Group != "apps" || web.Priority != 5 {
+		t.Errorf("web: name %q, group %q, priority %d", web.Name, web.Group, web.Priority)
+	}
+	if web.Command != "sh" || !reflect.DeepEqual(web.Args, []string{"-c", "exec python -m http.server 8000"}) {
+		t.Errorf("web command = %q %q", web.Command, web.Args)
+	}
+	if !reflect.DeepEqual(web.Environment, map[string]string{"PORT": "8000", "NAME": "web app"}) {
+		t.Errorf("web environment = %v", web.Environment)
+	}
+	if web.AutoRestart != RestartAlways || web.StopSignal != "SIGINT" {
+		t.Errorf("web autorestart %q, stopsignal %q", web.AutoRestart, web.StopSignal)
+	}
+
+	queue := cfg.Processes[1]
+	if queue.Group != "apps" || queue.Priority != 10 {
+		t.Errorf("queue: group %q, priority %d, want the group's", queue.Group, queue.Priority)
+	}
+	if queue.StartSecs == nil || *queue.StartSecs != 0 {
+		t.Errorf("queue startsecs = %v, want 0", queue.StartSecs)
+	}
+	if queue.StartRetries == nil || *queue.StartRetries != 0 {
+		t.Errorf("queue startretries = %v, want 0", queue.StartRetries)
+	}
+	if queue.StdoutMaxBytes == nil || *queue.StdoutMaxBytes != 0 {
+		t.Errorf("queue stdout_logfile_maxbytes = %v, want 0", queue.StdoutMaxBytes)
+	}
+
+	queue.SetDefaults()
+	var names, args, logs []string
+	for _, num := range queue.ProcessNums() {
+		inst := queue.Instance(num)
+		names = append(names, inst.Name)
+		args = append(args, inst.Args[len(inst.Args)-1])
+		logs = append(logs, inst.Stdout)
+	}
+	if want := []string{"queue_01", "queue_02", "queue_03"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("instances = %q, want %q", names, want)
+	}
+	if want := []string{"--name=queue_1", "--name=queue_2", "--name=queue_3"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("instance args = %q, want %q", args, want)
+	}
+	confd := filepath.Join(dir, "conf.d")
+	if want := []string{confd + "/1.log", confd + "/2.log", confd + "/3.log"}; !reflect.DeepEqual(logs, want) {
+		t.Errorf("instance logs = %q, want %q", logs, want)
+	}
+
+	if cfg.Socket.Path != "/run/supervisor.sock" || cfg.Socket.Mode != "0770" {
+		t.Errorf("socket = %+v", cfg.Socket)
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], "stdout_events_enabled is not supported") {
+		t.Errorf("warnings = %q", cfg.Warnings)
+	}
+}
+
+func TestReadSupervisordConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"duplicate section", "[program:a]\ncommand=a\n[program:a]\ncommand=b\n", "duplicate section [program:a]"},
+		{"unknown group member", "[group:g]\nprograms=nope\n", "no [program:nope] section"},
+		{"unterminated quote", "[program:a]\ncommand=echo \"x\n", "unterminated \" quote"},
+		{"empty command", "[program:a]\ncommand=\n", "command is empty"},
+		{"invalid number", "[program:a]\ncommand=a\nnumprocs=many\n", "numprocs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), "supervisord.conf", tt.content)
+			_, err := ReadSupervisordConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ReadSupervisordConfig error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
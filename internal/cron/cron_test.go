@@ -0,0 +1,179 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "must have 5 fields, got 0"},
+		{"* * * *", "must have 5 fields, got 4"},
+		{"* * * * * *", "must have 5 fields, got 6"},
+		{"@reboot", "unknown cron macro"},
+		{"60 * * * *", `invalid value "60" in minute field`},
+		{"* 24 * * *", `invalid value "24" in hour field`},
+		{"* * 0 * *", `invalid value "0" in day of month field`},
+		{"* * 32 * *", `invalid value "32" in day of month field`},
+		{"* * * 13 *", `invalid value "13" in month field`},
+		{"* * * * 8", `invalid value "8" in day of week field`},
+		{"* * * foo *", `invalid value "foo" in month field`},
+		{"* * * * monday", `invalid value "monday" in day of week field`},
+		{"*/0 * * * *", `invalid step "0" in minute field`},
+		{"*/x * * * *", `invalid step "x" in minute field`},
+		{"30-10 * * * *", `invalid range "30-10" in minute field`},
+		{"1-x * * * *", `invalid value "x" in minute field`},
+		{"1,,2 * * * *", `invalid value "" in minute field`},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.expr, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%q) error = %v, want one containing %q", tt.expr, err, tt.err)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := func(s string) time.Time {
+		t, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string
+	}{
+		{"every minute", "* * * * *", "2024-01-01 10:00:30", "2024-01-01 10:01:00"},
+		{"strictly after", "0 10 * * *", "2024-01-01 10:00:00", "2024-01-02 10:00:00"},
+		{"step", "*/15 * * * *", "2024-01-01 10:07:00", "2024-01-01 10:15:00"},
+		{"step over a range", "0-30/10 * * * *", "2024-01-01 10:31:00", "2024-01-01 11:00:00"},
+		{"step from a value", "5/20 * * * *", "2024-01-01 10:06:00", "2024-01-01 10:25:00"},
+		{"list", "0 8,12,18 * * *", "2024-01-01 12:00:00", "2024-01-01 18:00:00"},
+		{"range of hours", "0 9-17 * * *", "2024-01-01 17:30:00", "2024-01-02 09:00:00"},
+		{"weekday names", "0 9 * * mon-fri", "2024-01-06 12:00:00", "2024-01-08 09:00:00"},
+		{"sunday as 7", "0 0 * * 7", "2024-01-01 00:00:00", "2024-01-07 00:00:00"},
+		{"sunday as 0", "0 0 * * 0", "2024-01-01 00:00:00", "2024-01-07 00:00:00"},
+		{"month names", "0 0 1 JAN,Jul *", "2024-02-01 00:00:00", "2024-07-01 00:00:00"},
+		{"next year", "0 0 1 jan *", "2024-03-01 00:00:00", "2025-01-01 00:00:00"},
+		{"end of month", "0 0 31 * *", "2024-04-01 00:00:00", "2024-05-31 00:00:00"},
+		{"leap day", "0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"macro", "@hourly", "2024-01-01 10:00:00", "2024-01-01 11:00:00"},
+		{"macro case", "@Weekly", "2024-01-01 00:00:00", "2024-01-07 00:00:00"},
+		{"macro daily", "@midnight", "2024-01-01 23:59:59", "2024-01-02 00:00:00"},
+
+		// When both day fields are restricted, either one matches
+		{"day of month or week: friday", "0 0 13 * fri", "2024-01-05 00:00:00", "2024-01-12 00:00:00"},
+		{"day of month or week: 13th", "0 0 13 * fri", "2024-01-12 00:00:00", "2024-01-13 00:00:00"},
+		// A stepped "*" still counts as unrestricted, so both must match
+		{"day of month step and week", "0 0 */2 * mon", "2024-01-01 00:00:00", "2024-01-15 00:00:00"},
+		{"day of week step and month", "0 0 1 * */2", "2024-01-01 00:00:00", "2024-02-01 00:00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr, nil)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			got := s.Next(utc(tt.from))
+			if want := utc(tt.want); !got.Equal(want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, want)
+			}
+		})
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next = %s, want the zero time for February 30th", got)
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	tokyo := mustLocation(t, "Asia/Tokyo")
+	s, err := Parse("0 9 * * *", tokyo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Location() != tokyo || s.String() != "0 9 * * *" {
+		t.Errorf("Location() = %s, String() = %q", s.Location(), s.String())
+	}
+
+	// 09:00 in Tokyo is midnight UTC
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := time.Date(2024, 1, 2, 9, 0, 0, 0, tokyo)
+	if got := s.Next(from); !got.Equal(want) || got.Location() != tokyo {
+		t.Errorf("Next(%s) = %s, want %s", from, got, want)
+	}
+}
+
+func TestNextDaylightSaving(t *testing.T) {
+	ny := mustLocation(t, "America/New_York")
+
+	// Spring forward: 02:00 EST jumps to 03:00 EDT on March 10th, so 02:30
+	// does not exist that day and is skipped
+	s, err := Parse("30 2 * * *", ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 3, 9, 12, 0, 0, 0, ny)
+	if got, want := s.Next(from), time.Date(2024, 3, 11, 2, 30, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("spring forward: Next(%s) = %s, want %s", from, got, want)
+	}
+
+	// Spring forward: times after the gap keep their wall clock time
+	s, err = Parse("30 3 * * *", ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Next(from), time.Date(2024, 3, 10, 3, 30, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("spring forward: Next(%s) = %s, want %s", from, got, want)
+	}
+
+	// Fall back: 01:30 happens twice on November 3rd but matches once
+	s, err = Parse("30 1 * * *", ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from = time.Date(2024, 11, 3, 0, 0, 0, 0, ny)
+	first := s.Next(from)
+	if want := time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC); !first.Equal(want) {
+		t.Errorf("fall back: Next(%s) = %s, want %s (EDT)", from, first, want)
+	}
+	if got, want := s.Next(first), time.Date(2024, 11, 4, 1, 30, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("fall back: Next(%s) = %s, want %s", first, got, want)
+	}
+
+	// Fall back: a frequent job does not run again in the repeated hour
+	s, err = Parse("*/30 * * * *", ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Next(first), time.Date(2024, 11, 3, 7, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("fall back: Next(%s) = %s, want %s (02:00 EST)", first, got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pupervisor/internal/storage"
+)
+
+const (
+	defaultAuditEntries = 50
+	maxAuditEntries     = 500
+)
+
+// AuditPage is a page of audit entries and the number of entries matching
+// the filter.
+type AuditPage struct {
+	Entries []storage.AuditEntry `json:"entries"`
+	Total   int                  `json:"total"`
+	Limit   int                  `json:"limit"`
+	Offset  int                  `json:"offset"`
+}
+
+// GetAudit returns audit entries, newest first. They can be filtered by
+// actor, action, target, result and a since/until time range (RFC 3339), and
+// paged with limit and offset.
+func (h *ProcessHandler) GetAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid audit filter")
+		return
+	}
+
+	page := AuditPage{Entries: []storage.AuditEntry{}, Limit: filter.Limit, Offset: filter.Offset}
+	store := h.pm.GetStorage()
+	if store == nil {
+		h.writeJSON(w, http.StatusOK, page)
+		return
+	}
+
+	page.Entries, page.Total, err = store.GetAuditEntries(filter)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get audit log")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, page)
+}
+
+func parseAuditFilter(r *http.Request) (storage.AuditFilter, error) {
+	q := r.URL.Query()
+	filter := storage.AuditFilter{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+		Result: q.Get("result"),
+		Limit:  defaultAuditEntries,
+	}
+
+	switch filter.Result {
+	case "", storage.AuditSuccess, storage.AuditFailure:
+	default:
+		return filter, fmt.Errorf("invalid result %q, must be %s or %s", filter.Result, storage.AuditSuccess, storage.AuditFailure)
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %q, must be an RFC 3339 time", p.name, v)
+		}
+		*p.dst = t
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return filter, fmt.Errorf("invalid limit %q", v)
+		}
+		filter.Limit = min(n, maxAuditEntries)
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return filter, fmt.Errorf("invalid offset %q", v)
+		}
+		filter.Offset = n
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"pupervisor/internal/storage"
+)
+
+func TestAuditRecordsActor(t *testing.T) {
+	pm, _ := newTestManager(t, programsConfig)
+
+	serve(newAPI(pm, "alice"), http.MethodPost, "/api/programs/worker", `{"command": "sleep"}`)
+	serve(newAPI(pm, "bob"), http.MethodPost, "/api/programs/worker", `{"command": "sleep"}`)
+	serve(newAPI(pm, "bob"), http.MethodDelete, "/api/programs/worker", "")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{
+			"bob DELETE /api/programs/{name} worker success",
+			"bob POST /api/programs/{name} worker failure",
+			"alice POST /api/programs/{name} worker success",
+		}},
+		{"?actor=alice", []string{"alice POST /api/programs/{name} worker success"}},
+		{"?actor=bob&result=failure", []string{"bob POST /api/programs/{name} worker failure"}},
+		{"?limit=1&offset=2", []string{"alice POST /api/programs/{name} worker success"}},
+		{"?actor=carol", nil},
+	}
+
+	api := newAPI(pm, "alice")
+	for _, tt := range tests {
+		rec := serve(api, http.MethodGet, "/api/audit"+tt.query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/audit%s: status %d (body %s)", tt.query, rec.Code, rec.Body)
+		}
+		var page AuditPage
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, e := range page.Entries {
+			got = append(got, strings.Join([]string{e.Actor, e.Method, e.Action, e.Target, e.Result}, " "))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("GET /api/audit%s entries:\n%s\nwant:\n%s", tt.query, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestAuditFailureKeepsError(t *testing.T) {
+	pm, _ := newTestManager(t, programsConfig)
+	serve(newAPI(pm, "alice"), http.MethodPost, "/api/programs/web", `{"command": "sleep"}`)
+
+	entries, _, err := pm.GetStorage().GetAuditEntries(storage.AuditFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(entries))
+	}
+	if e := entries[0]; e.Status != http.StatusConflict || !strings.Contains(e.Error, "Program already exists: web") {
+		t.Errorf("entry status %d, error %q", e.Status, e.Error)
+	}
+}
+
+func TestAuditFilterErrors(t *testing.T) {
+	pm, _ := newTestManager(t, programsConfig)
+	api := newAPI(pm, "alice")
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"result=ok", `invalid result \"ok\"`},
+		{"since=yesterday", `invalid since \"yesterday\"`},
+		{"until=2026-01-01", `invalid until \"2026-01-01\"`},
+		{"limit=0", `invalid limit \"0\"`},
+		{"limit=x", `invalid limit \"x\"`},
+		{"offset=-1", `invalid offset \"-1\"`},
+	}
+
+	for _, tt := range tests {
+		rec := serve(api, http.MethodGet, "/api/audit?"+tt.query, "")
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("GET /api/audit?%s: status %d, body %s; want 400 containing %s", tt.query, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pupervisor/internal/auth"
+	"pupervisor/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+type LoginPage struct {
+	Next  string
+	Error string
+}
+
+type CreateTokenRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// ExpiresIn is the token lifetime in days; 0 means it never expires
+	ExpiresIn int `json:"expires_in"`
+}
+
+type CreateTokenResponse struct {
+	storage.APIToken
+	Token string `json:"token"`
+}
+
+// AuthHandler serves the login page, sessions and API token management.
+type AuthHandler struct {
+	users    *auth.Users
+	sessions *auth.Sessions
+	store    *storage.Storage
+	tmpl     *TemplateHandler
+}
+
+func NewAuthHandler(users *auth.Users, sessions *auth.Sessions, store *storage.Storage, tmpl *TemplateHandler) *AuthHandler {
+	return &AuthHandler{
+		users:    users,
+		sessions: sessions,
+		store:    store,
+		tmpl:     tmpl,
+	}
+}
+
+func (h *AuthHandler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+func (h *AuthHandler) writeError(w http.ResponseWriter, status int, err error, message string) {
+	h.writeJSON(w, status, ErrorResponse{
+		Error:   err.Error(),
+		Message: message,
+	})
+}
+
+// safeNext only allows redirects to local paths after login.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func (h *AuthHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
+	next := safeNext(r.URL.Query().Get("next"))
+	if h.sessions == nil || auth.FromContext(r.Context()) != nil {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+	h.tmpl.render(w, "login", http.StatusOK, LoginPage{Next: next})
+}
+
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if h.sessions == nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.tmpl.render(w, "login", http.StatusBadRequest, LoginPage{Next: "/", Error: "Invalid form"})
+		return
+	}
+	next := safeNext(r.PostForm.Get("next"))
+
+	principal, err := h.users.Verify(r.PostForm.Get("username"), r.PostForm.Get("password"), auth.MethodSession)
+	if err != nil {
+		log.Printf("Failed login for %q from %s", r.PostForm.Get("username"), r.RemoteAddr)
+		h.tmpl.render(w, "login", http.StatusUnauthorized, LoginPage{Next: next, Error: "Invalid username or password"})
+		return
+	}
+
+	if err := h.sessions.Create(w, r, principal); err != nil {
+		log.Printf("Error creating session: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if h.sessions != nil {
+		h.sessions.Destroy(w, r)
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, auth.FromContext(r.Context()))
+}
+
+// API token endpoints
+
+func (h *AuthHandler) GetTokens(w http.ResponseWriter, r *http.Request) {
+	if h.store == nil {
+		h.writeJSON(w, http.StatusOK, []interface{}{})
+		return
+	}
+
+	tokens, err := h.store.GetAPITokens()
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get API tokens")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	if h.store == nil {
+		h.writeError(w, http.StatusInternalServerError, errors.New("storage not available"), "Storage not initialized")
+		return
+	}
+
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		h.writeError(w, http.StatusBadRequest, errors.New("name is required"), "Token name is required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = string(auth.RoleViewer)
+	}
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Role must be viewer, operator or admin")
+		return
+	}
+	if req.ExpiresIn < 0 {
+		h.writeError(w, http.StatusBadRequest, errors.New("expires_in must not be negative"), "Invalid expiry")
+		return
+	}
+
+	// Nobody can mint a token with more access than they have
+	if principal := auth.FromContext(r.Context()); principal == nil || !principal.Role.Allows(role) {
+		h.writeError(w, http.StatusForbidden, errors.New("forbidden"), "Cannot create a token with a higher role than your own")
+		return
+	}
+
+	value, hash, err := auth.GenerateToken()
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to generate token")
+		return
+	}
+
+	token := storage.APIToken{Name: req.Name, Role: string(role)}
+	if req.ExpiresIn > 0 {
+		expires := time.Now().AddDate(0, 0, req.ExpiresIn)
+		token.ExpiresAt = &expires
+	}
+	if err := h.store.CreateAPIToken(&token, hash); err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to save token")
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, CreateTokenResponse{APIToken: token, Token: value})
+}
+
+func (h *AuthHandler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid token id")
+		return
+	}
+	if h.store == nil {
+		h.writeError(w, http.StatusInternalServerError, errors.New("storage not available"), "Storage not initialized")
+		return
+	}
+
+	deleted, err := h.store.DeleteAPIToken(id)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to delete token")
+		return
+	}
+	if !deleted {
+		h.writeError(w, http.StatusNotFound, errors.New("token not found"), "Token not found")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, SuccessResponse{
+		Status:  "deleted",
+		Message: "Token deleted",
+	})
+}
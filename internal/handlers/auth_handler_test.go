@@ -0,0 +1,31 @@
+package handlers
+
+import "testing"
+
+func TestSafeNext(t *testing.T) {
+	tests := []struct {
+		next string
+		want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/processes", "/processes"},
+		{"/logs?process=web&tail=1", "/logs?process=web&tail=1"},
+		{"/a//b", "/a//b"},
+		{"//evil", "/"},
+		{"//evil.example/path", "/"},
+		{"/\\evil", "/"},
+		{"/\\/evil", "/"},
+		{"https://evil", "/"},
+		{"http://evil.example/", "/"},
+		{"javascript:alert(1)", "/"},
+		{"evil", "/"},
+		{"\\\\evil", "/"},
+	}
+
+	for _, tt := range tests {
+		if got := safeNext(tt.next); got != tt.want {
+			t.Errorf("safeNext(%q) = %q, want %q", tt.next, got, tt.want)
+		}
+	}
+}
@@ -4,11 +4,22 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
+
+	"pupervisor/internal/service"
 )
 
 type HealthResponse struct {
-	Status    string `json:"status"`
-	Timestamp string `json:"timestamp"`
+	Status    string   `json:"status"`
+	Timestamp string   `json:"timestamp"`
+	Unhealthy []string `json:"unhealthy,omitempty"`
+}
+
+type HealthHandler struct {
+	pm *service.ProcessManager
+}
+
+func NewHealthHandler(pm *service.ProcessManager) *HealthHandler {
+	return &HealthHandler{pm: pm}
 }
 
 func HealthCheck(w http.ResponseWriter, r *http.Request) {
@@ -20,11 +31,21 @@ func HealthCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func ReadyCheck(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(HealthResponse{
+// ReadyCheck reports 503 while any running process fails its health check.
+func (h *HealthHandler) ReadyCheck(w http.ResponseWriter, r *http.Request) {
+	resp := HealthResponse{
 		Status:    "ready",
 		Timestamp: time.Now().Format(time.RFC3339),
-	})
+	}
+	status := http.StatusOK
+
+	if unhealthy := h.pm.Unhealthy(); len(unhealthy) > 0 {
+		resp.Status = "unhealthy"
+		resp.Unhealthy = unhealthy
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
 }
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pupervisor/internal/service"
+	"pupervisor/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultMetricsRange  = time.Hour
+	defaultMetricsPoints = 120
+	maxMetricsPoints     = 2000
+
+	defaultJobRuns = 20
+	maxJobRuns     = 100
+)
+
+type ProcessMetricsResponse struct {
+	Process string                `json:"process"`
+	From    time.Time             `json:"from"`
+	To      time.Time             `json:"to"`
+	Step    int                   `json:"step"`
+	Points  []storage.MetricPoint `json:"points"`
+}
+
+// GetProcessMetrics returns the resource history of a process. from and to
+// accept RFC 3339 times or Unix seconds and default to the last hour; step
+// accepts a duration ("30s", "5m") or seconds and defaults to about 120
+// points over the range.
+func (h *ProcessHandler) GetProcessMetrics(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	query := r.URL.Query()
+
+	to := time.Now()
+	if v := query.Get("to"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err, "Invalid to")
+			return
+		}
+		to = t
+	}
+
+	from := to.Add(-defaultMetricsRange)
+	if v := query.Get("from"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err, "Invalid from")
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		h.writeError(w, http.StatusBadRequest, errors.New("from must be before to"), "Invalid time range")
+		return
+	}
+
+	step := to.Sub(from) / defaultMetricsPoints
+	if v := query.Get("step"); v != "" {
+		d, err := parseStep(v)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err, "Invalid step")
+			return
+		}
+		step = d
+	}
+	step = step.Round(time.Second)
+	if step < time.Second {
+		step = time.Second
+	}
+	if points := to.Sub(from) / step; points > maxMetricsPoints {
+		h.writeError(w, http.StatusBadRequest, fmt.Errorf("range would return %d points, max is %d", points, maxMetricsPoints), "Step too small for time range")
+		return
+	}
+
+	points, err := h.pm.ProcessMetrics(name, from, to, step)
+	if err != nil {
+		if errors.Is(err, service.ErrProcessNotFound) {
+			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get metrics history")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, ProcessMetricsResponse{
+		Process: name,
+		From:    from,
+		To:      to,
+		Step:    int(step.Seconds()),
+		Points:  points,
+	})
+}
+
+// GetJobRuns returns the latest runs of a scheduled process, newest first.
+// limit defaults to 20.
+func (h *ProcessHandler) GetJobRuns(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	limit := defaultJobRuns
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v), "Invalid limit")
+			return
+		}
+		limit = min(n, maxJobRuns)
+	}
+
+	runs, err := h.pm.JobRuns(name, limit)
+	if err != nil {
+		if errors.Is(err, service.ErrProcessNotFound) {
+			h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get runs")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, runs)
+}
+
+func parseTime(v string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func parseStep(v string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs <= 0 {
+			return 0, errors.New("step must be positive")
+		}
+		return time.Duration(secs) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, errors.New("step must be positive")
+	}
+	return d, nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"runtime"
+	"sort"
+
+	"pupervisor/internal/metrics"
+	"pupervisor/internal/models"
+	"pupervisor/internal/service"
+)
+
+type MetricsHandler struct {
+	pm *service.ProcessManager
+}
+
+func NewMetricsHandler(pm *service.ProcessManager) *MetricsHandler {
+	return &MetricsHandler{pm: pm}
+}
+
+// ServeMetrics writes process and supervisor metrics in the Prometheus text
+// format.
+func (h *MetricsHandler) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	stats := h.pm.ProcessStats()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	mw := metrics.NewWriter(w)
+
+	mw.Family("pupervisor_process_up", "Whether the process is running (1) or not (0).", metrics.TypeGauge)
+	for _, s := range stats {
+		up := 0.0
+		if s.Status == models.StateRunning {
+			up = 1
+		}
+		mw.Sample("pupervisor_process_up", up, "process", s.Name, "program", s.Program, "group", s.Group)
+	}
+
+	mw.Family("pupervisor_process_state", "Current state of the process; 1 for the active state, 0 otherwise.", metrics.TypeGauge)
+	for _, s := range stats {
+		for _, state := range models.States {
+			value := 0.0
+			if s.Status == state {
+				value = 1
+			}
+			mw.Sample("pupervisor_process_state", value, "process", s.Name, "state", string(state))
+		}
+	}
+
+	mw.Family("pupervisor_process_restarts_total", "Times the process was started again since pupervisor loaded it.", metrics.TypeCounter)
+	for _, s := range stats {
+		mw.Sample("pupervisor_process_restarts_total", float64(s.Restarts), "process", s.Name)
+	}
+
+	mw.Family("pupervisor_process_uptime_seconds", "Seconds since the process was started, 0 when it is not running.", metrics.TypeGauge)
+	for _, s := range stats {
+		mw.Sample("pupervisor_process_uptime_seconds", s.UptimeSeconds, "process", s.Name)
+	}
+
+	mw.Family("pupervisor_process_healthy", "Whether the process passes its health check (1) or not (0); absent until the first check.", metrics.TypeGauge)
+	for _, s := range stats {
+		if s.Healthy != nil {
+			healthy := 0.0
+			if *s.Healthy {
+				healthy = 1
+			}
+			mw.Sample("pupervisor_process_healthy", healthy, "process", s.Name)
+		}
+	}
+
+	mw.Family("pupervisor_process_resident_memory_bytes", "Resident set size of the process and its descendants in bytes.", metrics.TypeGauge)
+	for _, s := range stats {
+		if s.Resources != nil {
+			mw.Sample("pupervisor_process_resident_memory_bytes", float64(s.Resources.RSSBytes), "process", s.Name)
+		}
+	}
+
+	mw.Family("pupervisor_process_cpu_seconds_total", "User and system CPU time consumed by the process and its descendants in seconds.", metrics.TypeCounter)
+	for _, s := range stats {
+		if s.Resources != nil {
+			mw.Sample("pupervisor_process_cpu_seconds_total", s.Resources.CPUSeconds, "process", s.Name)
+		}
+	}
+
+	mw.Family("pupervisor_process_virtual_memory_bytes", "Virtual memory size of the process and its descendants in bytes.", metrics.TypeGauge)
+	for _, s := range stats {
+		if s.Resources != nil {
+			mw.Sample("pupervisor_process_virtual_memory_bytes", float64(s.Resources.VMSBytes), "process", s.Name)
+		}
+	}
+
+	mw.Family("pupervisor_process_open_fds", "Open file descriptors of the process and its descendants.", metrics.TypeGauge)
+	for _, s := range stats {
+		if s.Resources != nil {
+			mw.Sample("pupervisor_process_open_fds", float64(s.Resources.OpenFDs), "process", s.Name)
+		}
+	}
+
+	mw.Family("pupervisor_process_threads", "Threads of the process and its descendants.", metrics.TypeGauge)
+	for _, s := range stats {
+		if s.Resources != nil {
+			mw.Sample("pupervisor_process_threads", float64(s.Resources.Threads), "process", s.Name)
+		}
+	}
+
+	mw.Family("pupervisor_process_io_read_bytes_total", "Bytes the process and its descendants read from storage.", metrics.TypeCounter)
+	for _, s := range stats {
+		if s.Resources != nil {
+			mw.Sample("pupervisor_process_io_read_bytes_total", float64(s.Resources.ReadBytes), "process", s.Name)
+		}
+	}
+
+	mw.Family("pupervisor_process_io_write_bytes_total", "Bytes the process and its descendants wrote to storage.", metrics.TypeCounter)
+	for _, s := range stats {
+		if s.Resources != nil {
+			mw.Sample("pupervisor_process_io_write_bytes_total", float64(s.Resources.WriteBytes), "process", s.Name)
+		}
+	}
+
+	if store := h.pm.GetStorage(); store != nil {
+		crashes, err := store.GetCrashStats()
+		if err != nil {
+			log.Printf("Error reading crash stats for metrics: %v", err)
+		}
+		names := make([]string, 0, len(crashes))
+		for name := range crashes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		mw.Family("pupervisor_process_crashes_total", "Crashes recorded in the crash history.", metrics.TypeCounter)
+		for _, name := range names {
+			mw.Sample("pupervisor_process_crashes_total", float64(crashes[name]), "process", name)
+		}
+	}
+
+	mw.Family("pupervisor_log_entries_dropped_total", "System log entries evicted from the in-memory log buffer.", metrics.TypeCounter)
+	mw.Sample("pupervisor_log_entries_dropped_total", float64(h.pm.DroppedLogEntries()))
+
+	mw.Family("pupervisor_output_lines_dropped_total", "Output lines dropped because a live log subscriber did not keep up.", metrics.TypeCounter)
+	mw.Sample("pupervisor_output_lines_dropped_total", float64(h.pm.DroppedOutputLines()))
+
+	metrics.HTTPRequests.Write(mw)
+
+	mw.Family("go_goroutines", "Number of goroutines that currently exist.", metrics.TypeGauge)
+	mw.Sample("go_goroutines", float64(runtime.NumGoroutine()))
+
+	if err := mw.Err(); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"pupervisor/internal/notify"
+	"pupervisor/internal/service"
+)
+
+// TestNotification sends a test notification to the channel named in the
+// body, {"channel": "ops"}, or to every channel without a body. Delivery
+// errors are reported per channel.
+func (h *ProcessHandler) TestNotification(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	results, err := h.pm.TestNotification(req.Channel)
+	switch {
+	case errors.Is(err, notify.ErrUnknownChannel):
+		h.writeError(w, http.StatusNotFound, err, "Notification channel not found: "+req.Channel)
+		return
+	case errors.Is(err, service.ErrNotificationsDisabled):
+		h.writeError(w, http.StatusConflict, err, "Notifications are not configured")
+		return
+	case err != nil:
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to send test notification")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, results)
+}
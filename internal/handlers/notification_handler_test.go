@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/notify"
+)
+
+func TestTestNotification(t *testing.T) {
+	var received atomic.Int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer webhook.Close()
+
+	disabled, _ := newTestManager(t, programsConfig)
+	enabled, _ := newTestManager(t, programsConfig)
+	notifier, err := notify.New(config.NotificationsConfig{Channels: []config.NotifyChannelConfig{
+		{Name: "ops", Type: config.ChannelWebhook, URL: webhook.URL},
+		{Name: "oncall", Type: config.ChannelWebhook, URL: webhook.URL},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled.UseNotifier(notifier)
+
+	tests := []struct {
+		name     string
+		api      http.Handler
+		body     string
+		status   int
+		want     string
+		received int32
+	}{
+		{"notifications disabled", newAPI(disabled, "alice"), `{"channel": "ops"}`, http.StatusConflict, "Notifications are not configured", 0},
+		{"unknown channel", newAPI(enabled, "alice"), `{"channel": "nope"}`, http.StatusNotFound, "Notification channel not found: nope", 0},
+		{"invalid body", newAPI(enabled, "alice"), `{"channel": `, http.StatusBadRequest, "Invalid request body", 0},
+		{"one channel", newAPI(enabled, "alice"), `{"channel": "ops"}`, http.StatusOK, `[{"channel":"ops","type":"webhook"}]`, 1},
+		{"every channel", newAPI(enabled, "alice"), "", http.StatusOK, `"channel":"oncall"`, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received.Store(0)
+			rec := serve(tt.api, http.MethodPost, "/api/notifications/test", tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("body %s does not contain %s", rec.Body, tt.want)
+			}
+			if got := received.Load(); got != tt.received {
+				t.Errorf("webhook received %d notifications, want %d", got, tt.received)
+			}
+		})
+	}
+}
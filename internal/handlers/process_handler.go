@@ -51,6 +51,18 @@ func (h *ProcessHandler) GetProcesses(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, processes)
 }
 
+func (h *ProcessHandler) GetProcess(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	process, ok := h.pm.GetProcess(name)
+	if !ok {
+		h.writeError(w, http.StatusNotFound, service.ErrProcessNotFound, "Process not found: "+name)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, process)
+}
+
 func (h *ProcessHandler) StartProcess(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["name"]
@@ -160,6 +172,111 @@ func (h *ProcessHandler) RestartSelectedProcesses(w http.ResponseWriter, r *http
 	})
 }
 
+// Group endpoints
+
+type GroupActionResponse struct {
+	Status    string `json:"status"`
+	Group     string `json:"group"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Message   string `json:"message"`
+}
+
+type ScaleRequest struct {
+	NumProcs int `json:"numprocs"`
+}
+
+func (h *ProcessHandler) GetGroups(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.pm.GetGroups())
+}
+
+func (h *ProcessHandler) StartGroup(w http.ResponseWriter, r *http.Request) {
+	h.groupAction(w, r, "started", h.pm.StartGroup)
+}
+
+func (h *ProcessHandler) StopGroup(w http.ResponseWriter, r *http.Request) {
+	h.groupAction(w, r, "stopped", h.pm.StopGroup)
+}
+
+func (h *ProcessHandler) RestartGroup(w http.ResponseWriter, r *http.Request) {
+	h.groupAction(w, r, "restarted", h.pm.RestartGroup)
+}
+
+func (h *ProcessHandler) groupAction(w http.ResponseWriter, r *http.Request, verb string, action func(string) (int, int, error)) {
+	group := mux.Vars(r)["group"]
+
+	succeeded, failed, err := action(group)
+	if err != nil {
+		if errors.Is(err, service.ErrGroupNotFound) {
+			h.writeError(w, http.StatusNotFound, err, "Group not found: "+group)
+			return
+		}
+		h.writeError(w, http.StatusInternalServerError, err, "Group action failed")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, GroupActionResponse{
+		Status:    "completed",
+		Group:     group,
+		Succeeded: succeeded,
+		Failed:    failed,
+		Message:   fmt.Sprintf("Group %s: %d %s, %d failed", group, succeeded, verb, failed),
+	})
+}
+
+func (h *ProcessHandler) ScaleProgram(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var req ScaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid JSON")
+		return
+	}
+
+	result, err := h.pm.ScaleProgram(name, req.NumProcs)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrProgramNotFound):
+			h.writeError(w, http.StatusNotFound, err, "Program not found: "+name)
+		case errors.Is(err, service.ErrInvalidNumProcs), errors.Is(err, service.ErrProcessNameTemplate):
+			h.writeError(w, http.StatusBadRequest, err, "Cannot scale program "+name)
+		default:
+			h.writeError(w, http.StatusConflict, err, "Cannot scale program "+name)
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+// RereadConfig reports how the configuration file differs from the running
+// configuration without applying it.
+func (h *ProcessHandler) RereadConfig(w http.ResponseWriter, r *http.Request) {
+	h.configAction(w, h.pm.Reread)
+}
+
+// ReloadConfig applies the configuration file to the running programs.
+func (h *ProcessHandler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	h.configAction(w, h.pm.Reload)
+}
+
+func (h *ProcessHandler) configAction(w http.ResponseWriter, action func() (*models.ReloadResult, error)) {
+	result, err := action()
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidConfig):
+			h.writeError(w, http.StatusBadRequest, err, "Configuration file is invalid")
+		case errors.Is(err, service.ErrNoConfigPath):
+			h.writeError(w, http.StatusConflict, err, "Configuration was not loaded from a file")
+		default:
+			h.writeError(w, http.StatusInternalServerError, err, "Failed to reload configuration")
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, result)
+}
+
 func (h *ProcessHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
 	logs := h.pm.GetLogs(100)
 	h.writeJSON(w, http.StatusOK, logs)
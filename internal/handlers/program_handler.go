@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"pupervisor/internal/auth"
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+	"pupervisor/internal/service"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultProgramChanges = 20
+	maxProgramChanges     = 200
+)
+
+// GetProgram returns the definition of a program as written in the
+// configuration file.
+func (h *ProcessHandler) GetProgram(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	def, err := h.pm.ProgramDefinition(name)
+	if err != nil {
+		h.writeProgramError(w, name, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, def)
+}
+
+// CreateProgram adds a program to the configuration file and starts it if
+// autostart is set.
+func (h *ProcessHandler) CreateProgram(w http.ResponseWriter, r *http.Request) {
+	h.programAction(w, r, http.StatusCreated, h.pm.CreateProgram)
+}
+
+// UpdateProgram replaces the definition of a program. Its processes are
+// restarted if they were running.
+func (h *ProcessHandler) UpdateProgram(w http.ResponseWriter, r *http.Request) {
+	h.programAction(w, r, http.StatusOK, h.pm.UpdateProgram)
+}
+
+// DeleteProgram stops a program and removes it from the configuration file.
+func (h *ProcessHandler) DeleteProgram(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	result, err := h.pm.DeleteProgram(name, actorName(r))
+	if err != nil {
+		h.writeProgramError(w, name, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+func (h *ProcessHandler) programAction(w http.ResponseWriter, r *http.Request, status int, action func(config.ProcessConfig, string) (*models.ReloadResult, error)) {
+	name := mux.Vars(r)["name"]
+
+	pc, err := decodeProgram(r, name)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid program definition")
+		return
+	}
+
+	result, err := action(pc, actorName(r))
+	if err != nil {
+		h.writeProgramError(w, name, err)
+		return
+	}
+
+	h.writeJSON(w, status, result)
+}
+
+func (h *ProcessHandler) writeProgramError(w http.ResponseWriter, name string, err error) {
+	switch {
+	case errors.Is(err, service.ErrProgramNotFound):
+		h.writeError(w, http.StatusNotFound, err, "Program not found: "+name)
+	case errors.Is(err, service.ErrProgramExists):
+		h.writeError(w, http.StatusConflict, err, "Program already exists: "+name)
+	case errors.Is(err, service.ErrInvalidConfig):
+		h.writeError(w, http.StatusBadRequest, err, "Invalid program definition")
+	case errors.Is(err, service.ErrNoConfigPath):
+		h.writeError(w, http.StatusConflict, err, "Configuration was not loaded from a file")
+	case errors.Is(err, config.ErrReadOnlyConfig):
+		h.writeError(w, http.StatusConflict, err, "Configuration file cannot be edited")
+	default:
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to change program "+name)
+	}
+}
+
+// GetProgramChanges returns the recorded changes of a program, newest
+// first. limit defaults to 20.
+func (h *ProcessHandler) GetProgramChanges(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	limit := defaultProgramChanges
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			h.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v), "Invalid limit")
+			return
+		}
+		limit = min(n, maxProgramChanges)
+	}
+
+	changes, err := h.pm.ProgramChanges(name, limit)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err, "Failed to get program changes")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, changes)
+}
+
+// decodeProgram reads a program definition from a JSON request body. The
+// JSON is converted to YAML first, so that it is parsed exactly like a
+// definition in the configuration file; unknown keys are rejected. The name
+// defaults to the one in the URL and may not differ from it.
+func decodeProgram(r *http.Request, name string) (config.ProcessConfig, error) {
+	var pc config.ProcessConfig
+
+	var def map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		return pc, fmt.Errorf("invalid JSON: %w", err)
+	}
+	data, err := yaml.Marshal(def)
+	if err != nil {
+		return pc, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&pc); err != nil {
+		return pc, err
+	}
+
+	if pc.Name == "" {
+		pc.Name = name
+	}
+	if pc.Name != name {
+		return pc, fmt.Errorf("name %q does not match the URL", pc.Name)
+	}
+	return pc, nil
+}
+
+// actorName returns the name of the caller of a request for change records.
+func actorName(r *http.Request) string {
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		return principal.Name
+	}
+	return "unknown"
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"pupervisor/internal/audit"
+	"pupervisor/internal/auth"
+	"pupervisor/internal/service"
+	"pupervisor/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// newAPI routes the handlers under test like the API router does, with
+// every request made by an admin called actor.
+func newAPI(pm *service.ProcessManager, actor string) http.Handler {
+	h := NewProcessHandler(pm)
+
+	r := mux.NewRouter()
+	api := r.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/programs/{name}", h.GetProgram).Methods(http.MethodGet)
+	api.HandleFunc("/programs/{name}", h.CreateProgram).Methods(http.MethodPost)
+	api.HandleFunc("/programs/{name}", h.UpdateProgram).Methods(http.MethodPut)
+	api.HandleFunc("/programs/{name}", h.DeleteProgram).Methods(http.MethodDelete)
+	api.HandleFunc("/programs/{name}/changes", h.GetProgramChanges).Methods(http.MethodGet)
+	api.HandleFunc("/audit", h.GetAudit).Methods(http.MethodGet)
+	api.HandleFunc("/notifications/test", h.TestNotification).Methods(http.MethodPost)
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, as(r, actor, auth.RoleAdmin))
+		})
+	})
+	r.Use(audit.Middleware(pm.GetStorage()))
+	return r
+}
+
+func serve(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, path, nil)
+	} else {
+		r = httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+const programsConfig = `processes:
+  - name: web
+    command: sleep
+    args: ["30"]
+`
+
+func TestProgramHandlers(t *testing.T) {
+	pm, path := newTestManager(t, programsConfig)
+	api := newAPI(pm, "alice")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		// Invalid definitions never reach the configuration file
+		{"name differs from the URL", http.MethodPost, "/api/programs/worker", `{"name": "other", "command": "sleep"}`, http.StatusBadRequest, `name \"other\" does not match the URL`},
+		{"unknown key", http.MethodPost, "/api/programs/worker", `{"command": "sleep", "comand": "sleep"}`, http.StatusBadRequest, "field comand not found"},
+		{"wrong type", http.MethodPost, "/api/programs/worker", `{"command": "sleep", "numprocs": "two"}`, http.StatusBadRequest, "Invalid program definition"},
+		{"invalid JSON", http.MethodPost, "/api/programs/worker", `{"command": `, http.StatusBadRequest, "invalid JSON"},
+		{"not an object", http.MethodPost, "/api/programs/worker", `["sleep"]`, http.StatusBadRequest, "invalid JSON"},
+		{"missing command", http.MethodPost, "/api/programs/worker", `{"args": ["1"]}`, http.StatusBadRequest, "command is required"},
+		{"invalid name", http.MethodPost, "/api/programs/.hidden", `{"command": "sleep"}`, http.StatusBadRequest, `program name \".hidden\"`},
+		{"name with a control character", http.MethodPost, "/api/programs/a%09b", `{"command": "sleep"}`, http.StatusBadRequest, `program name \"a\\tb\"`},
+		{"process name outside the program", http.MethodPost, "/api/programs/worker", `{"command": "sleep", "process_name": "../%(program_name)s"}`, http.StatusBadRequest, `process name \"../worker\"`},
+		{"existing program", http.MethodPost, "/api/programs/web", `{"command": "sleep"}`, http.StatusConflict, "Program already exists: web"},
+		{"update unknown program", http.MethodPut, "/api/programs/nope", `{"command": "sleep"}`, http.StatusNotFound, "Program not found: nope"},
+		{"update name differs from the URL", http.MethodPut, "/api/programs/web", `{"name": "worker", "command": "sleep"}`, http.StatusBadRequest, "does not match the URL"},
+		{"get unknown program", http.MethodGet, "/api/programs/nope", "", http.StatusNotFound, "Program not found: nope"},
+		{"delete unknown program", http.MethodDelete, "/api/programs/nope", "", http.StatusNotFound, "Program not found: nope"},
+		{"invalid limit", http.MethodGet, "/api/programs/web/changes?limit=0", "", http.StatusBadRequest, "Invalid limit"},
+
+		// A program's life cycle; the name defaults to the one in the URL
+		{"create", http.MethodPost, "/api/programs/worker", `{"command": "sleep", "args": ["60"]}`, http.StatusCreated, `"added":["worker"]`},
+		{"get", http.MethodGet, "/api/programs/worker", "", http.StatusOK, `"args":["60"]`},
+		{"update", http.MethodPut, "/api/programs/worker", `{"name": "worker", "command": "sleep", "args": ["90"]}`, http.StatusOK, `"changed":["worker"]`},
+		{"get updated", http.MethodGet, "/api/programs/worker", "", http.StatusOK, `"args":["90"]`},
+		{"delete", http.MethodDelete, "/api/programs/worker", "", http.StatusOK, `"removed":["worker"]`},
+		{"get deleted", http.MethodGet, "/api/programs/worker", "", http.StatusNotFound, "Program not found: worker"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(api, tt.method, tt.path, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("body %s does not contain %s", rec.Body, tt.want)
+			}
+		})
+	}
+
+	// Only the valid edits were written, and the file is back as it was
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "worker") || !strings.Contains(string(data), "name: web") {
+		t.Errorf("configuration file after the edits:\n%s", data)
+	}
+
+	// Every change is recorded with the caller as its actor
+	rec := serve(api, http.MethodGet, "/api/programs/worker/changes", "")
+	var changes []storage.ProgramChange
+	if err := json.Unmarshal(rec.Body.Bytes(), &changes); err != nil {
+		t.Fatalf("changes: %v (body %s)", err, rec.Body)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.Action+" by "+c.Actor)
+	}
+	if want := "delete by alice,update by alice,create by alice"; strings.Join(got, ",") != want {
+		t.Errorf("changes = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"pupervisor/internal/audit"
+	"pupervisor/internal/auth"
+	"pupervisor/internal/models"
+	"pupervisor/internal/service"
+	"pupervisor/internal/xmlrpc"
+)
+
+// rpcAPIVersion is the supervisord XML-RPC API version implemented.
+const rpcAPIVersion = "3.0"
+
+// Supervisord fault codes
+const (
+	faultUnknownMethod       = 1
+	faultIncorrectParameters = 2
+	faultBadArguments        = 3
+	faultBadName             = 10
+	faultFailed              = 30
+	faultAbnormalTermination = 40
+	faultSpawnError          = 50
+	faultAlreadyStarted      = 60
+	faultNotRunning          = 70
+)
+
+// rpcStateCodes are supervisord's numeric process states.
+var rpcStateCodes = map[models.State]int{
+	models.StateStopped:  0,
+	models.StateStarting: 10,
+	models.StateRunning:  20,
+	models.StateBackoff:  30,
+	models.StateStopping: 40,
+	models.StateExited:   100,
+	models.StateFatal:    200,
+	models.StateUnknown:  1000,
+}
+
+type rpcMethod struct {
+	role auth.Role
+	call func(ctx context.Context, params []interface{}) (interface{}, error)
+}
+
+// RPCHandler serves the core of supervisord's XML-RPC interface, so that
+// tools written for supervisord can manage pupervisor. Process names may be
+// given as name or group:name, and group:* selects a whole group.
+type RPCHandler struct {
+	pm      *service.ProcessManager
+	methods map[string]rpcMethod
+}
+
+func NewRPCHandler(pm *service.ProcessManager) *RPCHandler {
+	h := &RPCHandler{pm: pm}
+	h.methods = map[string]rpcMethod{
+		"supervisor.getAPIVersion":        {auth.RoleViewer, h.getAPIVersion},
+		"supervisor.getIdentification":    {auth.RoleViewer, h.getIdentification},
+		"supervisor.getState":             {auth.RoleViewer, h.getState},
+		"supervisor.getPID":               {auth.RoleViewer, h.getPID},
+		"supervisor.getAllProcessInfo":    {auth.RoleViewer, h.getAllProcessInfo},
+		"supervisor.getProcessInfo":       {auth.RoleViewer, h.getProcessInfo},
+		"supervisor.startProcess":         {auth.RoleOperator, h.startProcess},
+		"supervisor.stopProcess":          {auth.RoleOperator, h.stopProcess},
+		"supervisor.readProcessStdoutLog": {auth.RoleViewer, h.readLog(service.StreamStdout)},
+		"supervisor.readProcessStderrLog": {auth.RoleViewer, h.readLog(service.StreamStderr)},
+		"supervisor.tailProcessStdoutLog": {auth.RoleViewer, h.tailLog(service.StreamStdout)},
+		"supervisor.tailProcessStderrLog": {auth.RoleViewer, h.tailLog(service.StreamStderr)},
+		"supervisor.reloadConfig":         {auth.RoleAdmin, h.reloadConfig},
+		"system.listMethods":              {auth.RoleViewer, h.listMethods},
+	}
+	// readProcessLog is supervisord's older name for readProcessStdoutLog
+	h.methods["supervisor.readProcessLog"] = h.methods["supervisor.readProcessStdoutLog"]
+	return h
+}
+
+func (h *RPCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method, params, err := xmlrpc.DecodeCall(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid XML-RPC request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only calls that need more than read access are audited
+	m, ok := h.methods[method]
+	if !ok || m.role == auth.RoleViewer {
+		audit.Skip(r.Context())
+	} else {
+		target, _ := stringParam(params, 0)
+		audit.Describe(r.Context(), method, target, params)
+	}
+	if !ok {
+		h.writeFault(w, &xmlrpc.Fault{Code: faultUnknownMethod, String: "UNKNOWN_METHOD"})
+		return
+	}
+	// Like supervisord, a call without credentials gets 401 so that clients
+	// ask for them; a call above the caller's role is a fault
+	principal := auth.FromContext(r.Context())
+	if principal == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="pupervisor"`)
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if !principal.Role.Allows(m.role) {
+		denied := &xmlrpc.Fault{Code: faultFailed, String: "FAILED: " + method + " requires the " + string(m.role) + " role"}
+		audit.Fail(r.Context(), denied.String)
+		h.writeFault(w, denied)
+		return
+	}
+
+	result, err := m.call(r.Context(), params)
+	if err != nil {
+		var fault *xmlrpc.Fault
+		if !errors.As(err, &fault) {
+			fault = &xmlrpc.Fault{Code: faultFailed, String: "FAILED: " + err.Error()}
+		}
+		audit.Fail(r.Context(), fault.String)
+		h.writeFault(w, fault)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	if err := xmlrpc.EncodeResponse(w, result); err != nil {
+		log.Printf("Error encoding XML-RPC response: %v", err)
+	}
+}
+
+func (h *RPCHandler) writeFault(w http.ResponseWriter, fault *xmlrpc.Fault) {
+	w.Header().Set("Content-Type", "text/xml")
+	if err := xmlrpc.EncodeFault(w, fault); err != nil {
+		log.Printf("Error encoding XML-RPC fault: %v", err)
+	}
+}
+
+func fault(code int, name, detail string) error {
+	if detail != "" {
+		name += ": " + detail
+	}
+	return &xmlrpc.Fault{Code: code, String: name}
+}
+
+// stringParam returns parameter i, which must be a string.
+func stringParam(params []interface{}, i int) (string, error) {
+	if i < len(params) {
+		if s, ok := params[i].(string); ok {
+			return s, nil
+		}
+	}
+	return "", fault(faultIncorrectParameters, "INCORRECT_PARAMETERS", "")
+}
+
+// intParam returns parameter i, which must be an int.
+func intParam(params []interface{}, i int) (int64, error) {
+	if i < len(params) {
+		if n, ok := params[i].(int); ok {
+			return int64(n), nil
+		}
+	}
+	return 0, fault(faultIncorrectParameters, "INCORRECT_PARAMETERS", "")
+}
+
+// boolParam returns the optional parameter i, or fallback if it is absent.
+func boolParam(params []interface{}, i int, fallback bool) (bool, error) {
+	if i >= len(params) {
+		return fallback, nil
+	}
+	if b, ok := params[i].(bool); ok {
+		return b, nil
+	}
+	return false, fault(faultIncorrectParameters, "INCORRECT_PARAMETERS", "")
+}
+
+// resolve maps a supervisord name to a process, or to a group for group:*.
+func (h *RPCHandler) resolve(name string) (process models.Process, group string, err error) {
+	if p, ok := h.pm.GetProcess(name); ok {
+		return p, "", nil
+	}
+
+	groupName, processName, ok := strings.Cut(name, ":")
+	if ok && processName == "*" {
+		for _, g := range h.pm.GetGroups() {
+			if g.Name == groupName {
+				return models.Process{}, groupName, nil
+			}
+		}
+	} else if ok {
+		if p, found := h.pm.GetProcess(processName); found && p.Group == groupName {
+			return p, "", nil
+		}
+	}
+	return models.Process{}, "", fault(faultBadName, "BAD_NAME", name)
+}
+
+func (h *RPCHandler) getAPIVersion(ctx context.Context, params []interface{}) (interface{}, error) {
+	return rpcAPIVersion, nil
+}
+
+func (h *RPCHandler) getIdentification(ctx context.Context, params []interface{}) (interface{}, error) {
+	return "pupervisor", nil
+}
+
+func (h *RPCHandler) getState(ctx context.Context, params []interface{}) (interface{}, error) {
+	return map[string]interface{}{"statecode": 1, "statename": "RUNNING"}, nil
+}
+
+func (h *RPCHandler) getPID(ctx context.Context, params []interface{}) (interface{}, error) {
+	return os.Getpid(), nil
+}
+
+func (h *RPCHandler) getAllProcessInfo(ctx context.Context, params []interface{}) (interface{}, error) {
+	now := time.Now()
+	processes := h.pm.GetProcesses()
+	infos := make([]map[string]interface{}, 0, len(processes))
+	for _, p := range processes {
+		infos = append(infos, rpcProcessInfo(p, now))
+	}
+	return infos, nil
+}
+
+func (h *RPCHandler) getProcessInfo(ctx context.Context, params []interface{}) (interface{}, error) {
+	name, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	p, group, err := h.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if group != "" {
+		return nil, fault(faultBadName, "BAD_NAME", name)
+	}
+	return rpcProcessInfo(p, time.Now()), nil
+}
+
+// startProcess starts a process or group. With wait, the default, it returns
+// once the process left the starting state, failing if it did not reach
+// running.
+func (h *RPCHandler) startProcess(ctx context.Context, params []interface{}) (interface{}, error) {
+	name, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	wait, err := boolParam(params, 1, true)
+	if err != nil {
+		return nil, err
+	}
+	p, group, err := h.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if group != "" {
+		if _, failed, err := h.pm.StartGroup(group); err != nil || failed > 0 {
+			return nil, fault(faultFailed, "FAILED", fmt.Sprintf("%d process(es) of %s failed to start", failed, group))
+		}
+		return true, nil
+	}
+
+	if err := h.pm.StartProcess(p.Name); err != nil {
+		if errors.Is(err, service.ErrProcessAlreadyRunning) {
+			return nil, fault(faultAlreadyStarted, "ALREADY_STARTED", name)
+		}
+		return nil, fault(faultSpawnError, "SPAWN_ERROR", fmt.Sprintf("%s: %v", name, err))
+	}
+	if !wait {
+		return true, nil
+	}
+
+	for {
+		p, ok := h.pm.GetProcess(p.Name)
+		if !ok {
+			return nil, fault(faultBadName, "BAD_NAME", name)
+		}
+		switch p.Status {
+		case models.StateRunning, models.StateSucceeded:
+			// A oneshot job may finish before it counts as running
+			return true, nil
+		case models.StateStarting:
+		default:
+			return nil, fault(faultAbnormalTermination, "ABNORMAL_TERMINATION", name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (h *RPCHandler) stopProcess(ctx context.Context, params []interface{}) (interface{}, error) {
+	name, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := boolParam(params, 1, true); err != nil {
+		return nil, err
+	}
+	p, group, err := h.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if group != "" {
+		if _, failed, err := h.pm.StopGroup(group); err != nil || failed > 0 {
+			return nil, fault(faultFailed, "FAILED", fmt.Sprintf("%d process(es) of %s failed to stop", failed, group))
+		}
+		return true, nil
+	}
+
+	// Stopping always waits for the process to exit
+	if err := h.pm.StopProcess(p.Name); err != nil {
+		if errors.Is(err, service.ErrProcessNotRunning) {
+			return nil, fault(faultNotRunning, "NOT_RUNNING", name)
+		}
+		return nil, fault(faultFailed, "FAILED", err.Error())
+	}
+	return true, nil
+}
+
+// logParams reads the name, offset and length parameters of the log methods.
+func (h *RPCHandler) logParams(params []interface{}) (name string, offset, length int64, err error) {
+	if name, err = stringParam(params, 0); err != nil {
+		return "", 0, 0, err
+	}
+	if offset, err = intParam(params, 1); err != nil {
+		return "", 0, 0, err
+	}
+	if length, err = intParam(params, 2); err != nil {
+		return "", 0, 0, err
+	}
+
+	p, group, err := h.resolve(name)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if group != "" {
+		return "", 0, 0, fault(faultBadName, "BAD_NAME", name)
+	}
+	return p.Name, offset, length, nil
+}
+
+func logFault(err error) error {
+	if errors.Is(err, service.ErrBadArguments) {
+		return fault(faultBadArguments, "BAD_ARGUMENTS", "")
+	}
+	return fault(faultFailed, "FAILED", err.Error())
+}
+
+func (h *RPCHandler) readLog(stream string) func(ctx context.Context, params []interface{}) (interface{}, error) {
+	return func(ctx context.Context, params []interface{}) (interface{}, error) {
+		name, offset, length, err := h.logParams(params)
+		if err != nil {
+			return nil, err
+		}
+		data, err := h.pm.ReadLog(name, stream, offset, length)
+		if err != nil {
+			return nil, logFault(err)
+		}
+		return data, nil
+	}
+}
+
+func (h *RPCHandler) tailLog(stream string) func(ctx context.Context, params []interface{}) (interface{}, error) {
+	return func(ctx context.Context, params []interface{}) (interface{}, error) {
+		name, offset, length, err := h.logParams(params)
+		if err != nil {
+			return nil, err
+		}
+		data, next, overflow, err := h.pm.TailLog(name, stream, offset, length)
+		if err != nil {
+			return nil, logFault(err)
+		}
+		return []interface{}{data, next, overflow}, nil
+	}
+}
+
+// reloadConfig applies the configuration file, like POST /api/config/reload.
+// Unlike supervisord, which only rereads the file here, the changes take
+// effect right away; the result has the same [[added, changed, removed]]
+// shape.
+func (h *RPCHandler) reloadConfig(ctx context.Context, params []interface{}) (interface{}, error) {
+	result, err := h.pm.Reload()
+	if err != nil {
+		return nil, fault(faultFailed, "FAILED", err.Error())
+	}
+	changes := []interface{}{
+		nonNil(result.Added),
+		nonNil(result.Changed),
+		nonNil(result.Removed),
+	}
+	return []interface{}{changes}, nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func (h *RPCHandler) listMethods(ctx context.Context, params []interface{}) (interface{}, error) {
+	names := make([]string, 0, len(h.methods))
+	for name := range h.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// rpcProcessInfo converts a process to supervisord's process info struct.
+func rpcProcessInfo(p models.Process, now time.Time) map[string]interface{} {
+	var start, stop int64
+	if t, err := time.Parse(time.RFC3339, p.StartedAt); err == nil {
+		start = t.Unix()
+	}
+	if !p.Status.IsActive() && start > 0 {
+		if t, err := time.Parse(time.RFC3339, p.StateChangedAt); err == nil {
+			stop = t.Unix()
+		}
+	}
+
+	var description string
+	switch p.Status {
+	case models.StateRunning:
+		description = fmt.Sprintf("pid %d, uptime %s", p.Pid, rpcUptime(now.Sub(time.Unix(start, 0))))
+	case models.StateFatal, models.StateBackoff:
+		description = "Exited too quickly (process log may have details)"
+	case models.StateStopped, models.StateExited, models.StateSucceeded:
+		description = "Not started"
+		if start > 0 {
+			description = time.Unix(stop, 0).Format("Jan 02 03:04 PM")
+		}
+	}
+
+	// supervisord has no SUCCEEDED state; a completed oneshot is EXITED
+	status := p.Status
+	if status == models.StateSucceeded {
+		status = models.StateExited
+	}
+	code, ok := rpcStateCodes[status]
+	if !ok {
+		status = models.StateUnknown
+		code = rpcStateCodes[status]
+	}
+
+	return map[string]interface{}{
+		"name":           p.Name,
+		"group":          p.Group,
+		"description":    description,
+		"start":          start,
+		"stop":           stop,
+		"now":            now.Unix(),
+		"state":          code,
+		"statename":      strings.ToUpper(string(status)),
+		"spawnerr":       "",
+		"exitstatus":     p.ExitCode,
+		"logfile":        "",
+		"stdout_logfile": "",
+		"stderr_logfile": "",
+		"pid":            p.Pid,
+	}
+}
+
+// rpcUptime formats d like Python's timedelta: "1 day, 2:03:04".
+func rpcUptime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	secs := int64(d / time.Second)
+	days := secs / 86400
+	secs %= 86400
+	clock := fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	switch days {
+	case 0:
+		return clock
+	case 1:
+		return "1 day, " + clock
+	}
+	return fmt.Sprintf("%d days, %s", days, clock)
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pupervisor/internal/auth"
+	"pupervisor/internal/config"
+	"pupervisor/internal/service"
+	"pupervisor/internal/storage"
+)
+
+// newTestManager loads a process manager from a pupervisor.yaml with the
+// given content, in a temporary directory with its own database.
+func newTestManager(t *testing.T, yaml string) (*service.ProcessManager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pupervisor.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadProcessConfig(path)
+	if err != nil {
+		t.Fatalf("LoadProcessConfig: %v", err)
+	}
+	store, err := storage.New(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm := service.NewProcessManager(cfg, store)
+	t.Cleanup(func() {
+		pm.StopAll()
+		store.Close()
+	})
+	return pm, path
+}
+
+// as returns r with principal name and role, as set by the auth middleware.
+func as(r *http.Request, name string, role auth.Role) *http.Request {
+	return r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{Name: name, Role: role, Method: auth.MethodBasic}))
+}
+
+func rpcCall(method string, params ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><methodCall><methodName>` + method + `</methodName><params>`)
+	for _, p := range params {
+		b.WriteString(`<param><value>` + p + `</value></param>`)
+	}
+	b.WriteString(`</params></methodCall>`)
+	return b.String()
+}
+
+func TestRPCStartProcess(t *testing.T) {
+	pm, _ := newTestManager(t, `processes:
+  - name: job
+    type: oneshot
+    command: "true"
+    startsecs: 5
+  - name: missing
+    command: /nonexistent/pupervisor-test
+  - name: sleeper
+    command: sleep
+    args: ["30"]
+    startsecs: 0
+`)
+	h := NewRPCHandler(pm)
+
+	tests := []struct {
+		name   string
+		body   string
+		role   auth.Role
+		status int
+		want   []string
+	}{
+		{
+			name:   "viewer",
+			body:   rpcCall("supervisor.startProcess", "sleeper"),
+			role:   auth.RoleViewer,
+			status: http.StatusOK,
+			want:   []string{"<fault>", "<int>30</int>", "FAILED: supervisor.startProcess requires the operator role"},
+		},
+		{
+			name:   "without credentials",
+			body:   rpcCall("supervisor.getState"),
+			status: http.StatusUnauthorized,
+		},
+		{
+			// The job exits successfully long before startsecs
+			name:   "oneshot job succeeds",
+			body:   rpcCall("supervisor.startProcess", "job"),
+			role:   auth.RoleOperator,
+			status: http.StatusOK,
+			want:   []string{"<params>", "<boolean>1</boolean>"},
+		},
+		{
+			name:   "spawn error",
+			body:   rpcCall("supervisor.startProcess", "missing"),
+			role:   auth.RoleOperator,
+			status: http.StatusOK,
+			want:   []string{"<fault>", "<int>50</int>", "SPAWN_ERROR: missing: ", "no such file or directory"},
+		},
+		{
+			name:   "running",
+			body:   rpcCall("supervisor.startProcess", "sleeper"),
+			role:   auth.RoleOperator,
+			status: http.StatusOK,
+			want:   []string{"<params>", "<boolean>1</boolean>"},
+		},
+		{
+			name:   "already started",
+			body:   rpcCall("supervisor.startProcess", "sleeper", "<boolean>0</boolean>"),
+			role:   auth.RoleOperator,
+			status: http.StatusOK,
+			want:   []string{"<int>60</int>", "ALREADY_STARTED: sleeper"},
+		},
+		{
+			name:   "unknown process",
+			body:   rpcCall("supervisor.startProcess", "nope"),
+			role:   auth.RoleOperator,
+			status: http.StatusOK,
+			want:   []string{"<int>10</int>", "BAD_NAME: nope"},
+		},
+		{
+			name:   "unknown method",
+			body:   rpcCall("supervisor.shutdown"),
+			role:   auth.RoleAdmin,
+			status: http.StatusOK,
+			want:   []string{"<int>1</int>", "UNKNOWN_METHOD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/RPC2", strings.NewReader(tt.body))
+			if tt.role != "" {
+				r = as(r, "tester", tt.role)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+			}
+			if rec.Code == http.StatusUnauthorized && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic ") {
+				t.Errorf("WWW-Authenticate = %q, want a basic auth challenge", rec.Header().Get("WWW-Authenticate"))
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("response does not contain %q:\n%s", want, rec.Body)
+				}
+			}
+		})
+	}
+}
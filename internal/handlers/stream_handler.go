@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pupervisor/internal/models"
+	"pupervisor/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultStreamBacklog = 100
+	maxStreamBacklog     = 500
+
+	streamHeartbeat = 15 * time.Second
+	wsWriteTimeout  = 10 * time.Second
+	wsPongTimeout   = 60 * time.Second
+)
+
+var errInvalidStream = errors.New("invalid stream")
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// streamParams reads the stream filter and backlog size from the query:
+// ?stream=stdout|stderr (repeatable or comma-separated) and ?backlog=N.
+func streamParams(r *http.Request) (streams []string, backlog int, err error) {
+	for _, value := range r.URL.Query()["stream"] {
+		for _, s := range strings.Split(value, ",") {
+			s = strings.TrimSpace(s)
+			switch s {
+			case "", "all":
+			case service.StreamStdout, service.StreamStderr:
+				streams = append(streams, s)
+			default:
+				return nil, 0, fmt.Errorf("%w: %q", errInvalidStream, s)
+			}
+		}
+	}
+
+	backlog = defaultStreamBacklog
+	if value := r.URL.Query().Get("backlog"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("invalid backlog %q", value)
+		}
+		backlog = n
+	}
+	if backlog > maxStreamBacklog {
+		backlog = maxStreamBacklog
+	}
+
+	return streams, backlog, nil
+}
+
+func (h *ProcessHandler) subscribe(w http.ResponseWriter, r *http.Request, after uint64) (*service.Subscription, []models.OutputLine, bool) {
+	name := mux.Vars(r)["name"]
+
+	streams, backlog, err := streamParams(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err, "Invalid stream parameters")
+		return nil, nil, false
+	}
+	if after > 0 {
+		backlog = maxStreamBacklog
+	}
+
+	sub, lines, err := h.pm.SubscribeOutput(name, streams, backlog, after)
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, err, "Process not found: "+name)
+		return nil, nil, false
+	}
+
+	return sub, lines, true
+}
+
+// StreamLogs streams process output as Server-Sent Events. Each event carries
+// the line's sequence number as its id, so a reconnecting EventSource resumes
+// from Last-Event-ID without gaps.
+func (h *ProcessHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
+	var after uint64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		after, _ = strconv.ParseUint(id, 10, 64)
+	}
+
+	sub, backlog, ok := h.subscribe(w, r, after)
+	if !ok {
+		return
+	}
+	defer h.pm.UnsubscribeOutput(sub)
+
+	rc := http.NewResponseController(w)
+	// The server's write timeout would otherwise cut the stream
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(line models.OutputLine) error {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", line.Seq, data)
+		return err
+	}
+
+	for _, line := range backlog {
+		if err := send(line); err != nil {
+			return
+		}
+	}
+	// ?follow=false only returns the backlog, like tail without -f
+	if follow, err := strconv.ParseBool(r.URL.Query().Get("follow")); err == nil && !follow {
+		fmt.Fprint(w, "event: end\ndata: {}\n\n")
+		_ = rc.Flush()
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, ok := <-sub.C:
+			if !ok {
+				fmt.Fprint(w, "event: end\ndata: {}\n\n")
+				_ = rc.Flush()
+				return
+			}
+			if err := send(line); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// StreamLogsWS streams process output over a WebSocket as JSON text messages.
+func (h *ProcessHandler) StreamLogsWS(w http.ResponseWriter, r *http.Request) {
+	sub, backlog, ok := h.subscribe(w, r, 0)
+	if !ok {
+		return
+	}
+	defer h.pm.UnsubscribeOutput(sub)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response
+		return
+	}
+	defer conn.Close()
+
+	// Clients only send control frames; reading them detects disconnects
+	closed := make(chan struct{})
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(line models.OutputLine) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(line)
+	}
+
+	for _, line := range backlog {
+		if err := send(line); err != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(streamHeartbeat)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case line, ok := <-sub.C:
+			if !ok {
+				msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "process removed")
+				_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if err := send(line); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
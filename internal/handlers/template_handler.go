@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"bytes"
 	"html/template"
 	"io/fs"
 	"log"
 	"net/http"
+
+	"pupervisor/internal/auth"
 )
 
+// PageData is passed to every page template.
+type PageData struct {
+	// User is the logged-in user, or nil when authentication is disabled
+	User *auth.Principal
+}
+
 type TemplateHandler struct {
 	templates *template.Template
 }
@@ -24,12 +33,23 @@ func NewTemplateHandler(templatesFS fs.FS) (*TemplateHandler, error) {
 
 func (th *TemplateHandler) ServeTemplate(templateName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-
-		if err := th.templates.ExecuteTemplate(w, templateName+".html", nil); err != nil {
-			log.Printf("Error executing template %s: %v", templateName, err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
+		var data PageData
+		if principal := auth.FromContext(r.Context()); principal != nil && principal.Method != auth.MethodNone {
+			data.User = principal
 		}
+		th.render(w, templateName, http.StatusOK, data)
 	}
 }
+
+func (th *TemplateHandler) render(w http.ResponseWriter, templateName string, status int, data interface{}) {
+	var buf bytes.Buffer
+	if err := th.templates.ExecuteTemplate(&buf, templateName+".html", data); err != nil {
+		log.Printf("Error executing template %s: %v", templateName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
@@ -0,0 +1,194 @@
+// Package metrics writes metrics in the Prometheus text exposition format and
+// keeps the few supervisor-internal metrics that are not derived from process
+// state.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Writer emits metric families. Labels are passed as alternating name and
+// value pairs.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Err returns the first write error.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+// Family writes the HELP and TYPE lines that precede a metric's samples.
+func (w *Writer) Family(name, help, typ string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+}
+
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// DefaultBuckets are the latency buckets in seconds used for HTTP requests.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Histogram counts observations into fixed buckets, one series per distinct
+// set of label values.
+type Histogram struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	return &Histogram{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*histogramSeries),
+	}
+}
+
+// Observe records v for the given label values, in the order of the label
+// names passed to NewHistogram.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\x00")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		for i, name := range h.labelNames {
+			s.labels = append(s.labels, name, labelValues[i])
+		}
+		h.series[key] = s
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) Write(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w.Family(h.name, h.help, TypeHistogram)
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			w.Sample(h.name+"_bucket", float64(s.counts[i]), append(s.labels[:len(s.labels):len(s.labels)], "le", formatValue(upper))...)
+		}
+		w.Sample(h.name+"_bucket", float64(s.count), append(s.labels[:len(s.labels):len(s.labels)], "le", "+Inf")...)
+		w.Sample(h.name+"_sum", s.sum, s.labels...)
+		w.Sample(h.name+"_count", float64(s.count), s.labels...)
+	}
+}
+
+// HTTPRequests holds the latency of HTTP requests served by pupervisor,
+// recorded by the logging middleware.
+var HTTPRequests = NewHistogram(
+	"pupervisor_http_request_duration_seconds",
+	"Latency of HTTP requests served by pupervisor.",
+	DefaultBuckets,
+	"method", "route", "code",
+)
+
+// ObserveHTTP records a served request. route is the matched route template
+// so that path parameters don't create a series per process.
+func ObserveHTTP(method, route string, status int, d time.Duration) {
+	HTTPRequests.Observe(d.Seconds(), method, route, strconv.Itoa(status))
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pupervisor/internal/auth"
+)
+
+// publicPaths are served without authentication.
+var publicPaths = []string{"/health", "/ready", "/login", "/static/"}
+
+func isPublic(path string) bool {
+	for _, p := range publicPaths {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// anonymous is the principal of every request when authentication is
+// disabled.
+var anonymous = &auth.Principal{Name: "anonymous", Role: auth.RoleAdmin, Method: auth.MethodNone}
+
+// Auth authenticates every request with provider and stores the principal in
+// the request context. A nil provider disables authentication. Unauthenticated
+// API calls get 401; browsers asking for a page are redirected to /login.
+//
+// Requests over the Unix socket are first matched against peers by their
+// peer credentials. Peers that match no rule authenticate like everyone
+// else; without authentication they are let in only if no rules are set.
+func Auth(provider auth.Provider, peers *auth.Peers) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if peer := auth.PeerFromContext(r.Context()); peer != nil && peers != nil {
+				if principal := peers.Match(peer); principal != nil {
+					next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+					return
+				}
+				if provider == nil && peers.Restricted() {
+					log.Printf("Rejected socket request from %s: no matching peer rule", peer)
+					writeAuthError(w, http.StatusForbidden, "forbidden", "Peer is not allowed to use this socket")
+					return
+				}
+			}
+
+			if provider == nil {
+				next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), anonymous)))
+				return
+			}
+
+			principal, err := provider.Authenticate(r)
+			if err != nil && !errors.Is(err, auth.ErrInvalidCredentials) {
+				log.Printf("Authentication error: %v", err)
+			}
+
+			if principal == nil {
+				if isPublic(r.URL.Path) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") && strings.Contains(r.Header.Get("Accept"), "text/html") {
+					http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer realm="pupervisor"`)
+				if r.URL.Path == "/RPC2" {
+					// XML-RPC clients written for supervisord only know basic auth
+					w.Header().Add("WWW-Authenticate", `Basic realm="pupervisor"`)
+				}
+				writeAuthError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+				return
+			}
+
+			if principal.Method == auth.MethodSession && !safeMethod(r.Method) && !sameOrigin(r) {
+				writeAuthError(w, http.StatusForbidden, "forbidden", "Cross-origin request rejected")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// RequireRole rejects requests whose principal lacks role with 403.
+func RequireRole(role auth.Role) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.FromContext(r.Context())
+			if principal == nil {
+				writeAuthError(w, http.StatusUnauthorized, "unauthorized", "Authentication required")
+				return
+			}
+			if !principal.Role.Allows(role) {
+				writeAuthError(w, http.StatusForbidden, "forbidden", "This action requires the "+string(role)+" role")
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// sameOrigin guards cookie-authenticated requests against CSRF by checking
+// that the Origin (or Referer) header names this host.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return false
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+func writeAuthError(w http.ResponseWriter, status int, err, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error":   err,
+		"message": message,
+	})
+}
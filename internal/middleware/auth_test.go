@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"pupervisor/internal/auth"
+	"pupervisor/internal/config"
+	"pupervisor/internal/storage"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testServer wires the auth middleware like the API router does, with one
+// route per role, and returns it with credentials for every kind of caller.
+type testServer struct {
+	handler  http.Handler
+	sessions *auth.Sessions
+	store    *storage.Storage
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	store, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := auth.NewUsers([]config.UserConfig{
+		{Username: "viewer", PasswordHash: string(hash), Role: "viewer"},
+		{Username: "operator", PasswordHash: string(hash), Role: "operator"},
+		{Username: "admin", PasswordHash: string(hash), Role: "admin"},
+	})
+	sessions := auth.NewSessions(time.Hour)
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(auth.FromContext(r.Context()).Name))
+	}
+	public := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("public"))
+	}
+	operator := RequireRole(auth.RoleOperator)
+	admin := RequireRole(auth.RoleAdmin)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/health", public).Methods(http.MethodGet)
+	r.HandleFunc("/ready", public).Methods(http.MethodGet)
+	r.HandleFunc("/login", public).Methods(http.MethodGet, http.MethodPost)
+	r.PathPrefix("/static/").HandlerFunc(public)
+	r.HandleFunc("/", ok).Methods(http.MethodGet)
+	r.HandleFunc("/api/processes", ok).Methods(http.MethodGet)
+	r.HandleFunc("/api/processes/{name}/stop", operator(ok)).Methods(http.MethodPost)
+	r.HandleFunc("/api/config/reload", admin(ok)).Methods(http.MethodPost)
+	r.HandleFunc("/api/programs/{name}", admin(ok)).Methods(http.MethodDelete)
+	r.HandleFunc("/api/tokens", admin(ok)).Methods(http.MethodPost)
+	r.HandleFunc("/RPC2", ok).Methods(http.MethodPost)
+	r.Use(Auth(auth.Chain{sessions, auth.NewTokens(store), users}, nil))
+
+	return &testServer{handler: r, sessions: sessions, store: store}
+}
+
+// token stores an API token and returns it.
+func (s *testServer) token(t *testing.T, role string, expires *time.Time) (string, int64) {
+	t.Helper()
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := &storage.APIToken{Name: role, Role: role, ExpiresAt: expires}
+	if err := s.store.CreateAPIToken(stored, hash); err != nil {
+		t.Fatal(err)
+	}
+	return token, stored.ID
+}
+
+// session logs in as name and returns the session cookie.
+func (s *testServer) session(t *testing.T, name string, role auth.Role) *http.Cookie {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	p := &auth.Principal{Name: name, Role: role, Method: auth.MethodBasic}
+	if err := s.sessions.Create(rec, httptest.NewRequest(http.MethodPost, "/login", nil), p); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Result().Cookies()[0]
+}
+
+type credentials func(r *http.Request)
+
+func basic(user string) credentials {
+	return func(r *http.Request) { r.SetBasicAuth(user, "secret") }
+}
+
+func bearer(token string) credentials {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+}
+
+func cookie(c *http.Cookie, header, value string) credentials {
+	return func(r *http.Request) {
+		r.AddCookie(c)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	s := newTestServer(t)
+
+	past := time.Now().Add(-time.Minute)
+	viewerToken, _ := s.token(t, "viewer", nil)
+	operatorToken, _ := s.token(t, "operator", nil)
+	expiredToken, _ := s.token(t, "admin", &past)
+	revokedToken, revokedID := s.token(t, "admin", nil)
+	if _, err := s.store.DeleteAPIToken(revokedID); err != nil {
+		t.Fatal(err)
+	}
+	adminSession := s.session(t, "admin", auth.RoleAdmin)
+	viewerSession := s.session(t, "viewer", auth.RoleViewer)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		creds  credentials
+		accept string
+		status int
+		body   string
+	}{
+		// Public paths stay reachable without credentials, and with wrong ones
+		{"health", http.MethodGet, "/health", nil, "", http.StatusOK, "public"},
+		{"ready", http.MethodGet, "/ready", nil, "", http.StatusOK, "public"},
+		{"login page", http.MethodGet, "/login", nil, "text/html", http.StatusOK, "public"},
+		{"login form", http.MethodPost, "/login", nil, "", http.StatusOK, "public"},
+		{"static file", http.MethodGet, "/static/js/app.js", nil, "", http.StatusOK, "public"},
+		{"health with a revoked token", http.MethodGet, "/health", bearer(revokedToken), "", http.StatusOK, "public"},
+
+		// Everything else needs credentials
+		{"api without credentials", http.MethodGet, "/api/processes", nil, "", http.StatusUnauthorized, ""},
+		{"api from a browser", http.MethodGet, "/api/processes", nil, "text/html", http.StatusUnauthorized, ""},
+		{"page from a browser", http.MethodGet, "/", nil, "text/html", http.StatusSeeOther, ""},
+		{"page from a script", http.MethodGet, "/", nil, "", http.StatusUnauthorized, ""},
+		{"wrong password", http.MethodGet, "/api/processes", func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }, "", http.StatusUnauthorized, ""},
+		{"expired token", http.MethodGet, "/api/processes", bearer(expiredToken), "", http.StatusUnauthorized, ""},
+		{"revoked token", http.MethodGet, "/api/processes", bearer(revokedToken), "", http.StatusUnauthorized, ""},
+		{"unknown token", http.MethodGet, "/api/processes", bearer("pvt_0000"), "", http.StatusUnauthorized, ""},
+		{"forged session", http.MethodGet, "/api/processes", cookie(&http.Cookie{Name: auth.SessionCookie, Value: "forged"}, "", ""), "", http.StatusUnauthorized, ""},
+
+		// Roles
+		{"viewer reads", http.MethodGet, "/api/processes", basic("viewer"), "", http.StatusOK, "viewer"},
+		{"viewer stops a process", http.MethodPost, "/api/processes/web/stop", basic("viewer"), "", http.StatusForbidden, ""},
+		{"viewer reloads", http.MethodPost, "/api/config/reload", basic("viewer"), "", http.StatusForbidden, ""},
+		{"viewer deletes a program", http.MethodDelete, "/api/programs/web", basic("viewer"), "", http.StatusForbidden, ""},
+		{"viewer token stops a process", http.MethodPost, "/api/processes/web/stop", bearer(viewerToken), "", http.StatusForbidden, ""},
+		{"viewer session stops a process", http.MethodPost, "/api/processes/web/stop", cookie(viewerSession, "Origin", "http://example.com"), "", http.StatusForbidden, ""},
+		{"operator stops a process", http.MethodPost, "/api/processes/web/stop", basic("operator"), "", http.StatusOK, "operator"},
+		{"operator reloads", http.MethodPost, "/api/config/reload", basic("operator"), "", http.StatusForbidden, ""},
+		{"operator token creates a token", http.MethodPost, "/api/tokens", bearer(operatorToken), "", http.StatusForbidden, ""},
+		{"operator token stops a process", http.MethodPost, "/api/processes/web/stop", bearer(operatorToken), "", http.StatusOK, "token:operator"},
+		{"admin reloads", http.MethodPost, "/api/config/reload", basic("admin"), "", http.StatusOK, "admin"},
+		{"admin deletes a program", http.MethodDelete, "/api/programs/web", basic("admin"), "", http.StatusOK, "admin"},
+
+		// Session cookies are only accepted on changes from this origin
+		{"session read", http.MethodGet, "/api/processes", cookie(adminSession, "", ""), "", http.StatusOK, "admin"},
+		{"session post from this origin", http.MethodPost, "/api/config/reload", cookie(adminSession, "Origin", "http://example.com"), "", http.StatusOK, "admin"},
+		{"session post with a referer", http.MethodPost, "/api/config/reload", cookie(adminSession, "Referer", "http://example.com/settings"), "", http.StatusOK, "admin"},
+		{"session post from another origin", http.MethodPost, "/api/config/reload", cookie(adminSession, "Origin", "https://evil.example"), "", http.StatusForbidden, ""},
+		{"session post from another port", http.MethodPost, "/api/config/reload", cookie(adminSession, "Origin", "http://example.com:8080"), "", http.StatusForbidden, ""},
+		{"session post from a null origin", http.MethodPost, "/api/config/reload", cookie(adminSession, "Origin", "null"), "", http.StatusForbidden, ""},
+		{"session post without an origin", http.MethodPost, "/api/config/reload", cookie(adminSession, "", ""), "", http.StatusForbidden, ""},
+		{"session delete from another origin", http.MethodDelete, "/api/programs/web", cookie(adminSession, "Referer", "https://evil.example/"), "", http.StatusForbidden, ""},
+		// Basic auth and tokens are not sent by browsers on their own
+		{"basic post without an origin", http.MethodPost, "/api/config/reload", basic("admin"), "", http.StatusOK, "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://example.com"+tt.path, nil)
+			if tt.creds != nil {
+				tt.creds(r)
+			}
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			s.handler.ServeHTTP(rec, r)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.status, rec.Body)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", rec.Body, tt.body)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestAuthRedirectsToLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/?tab=logs", nil)
+	r.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, r)
+
+	if want := "/login?next=%2F%3Ftab%3Dlogs"; rec.Header().Get("Location") != want {
+		t.Errorf("Location = %q, want %q", rec.Header().Get("Location"), want)
+	}
+}
+
+func TestAuthChallenges(t *testing.T) {
+	s := newTestServer(t)
+
+	for path, want := range map[string][]string{
+		"/api/processes": {`Bearer realm="pupervisor"`},
+		"/RPC2":          {`Bearer realm="pupervisor"`, `Basic realm="pupervisor"`},
+	} {
+		rec := httptest.NewRecorder()
+		method := http.MethodGet
+		if path == "/RPC2" {
+			method = http.MethodPost
+		}
+		s.handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		if got := rec.Header().Values("WWW-Authenticate"); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: WWW-Authenticate = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestAuthDisabled(t *testing.T) {
+	var got *auth.Principal
+	handler := Auth(nil, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = auth.FromContext(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/config/reload", nil))
+	if rec.Code != http.StatusOK || got == nil || got.Role != auth.RoleAdmin || got.Method != auth.MethodNone {
+		t.Errorf("status %d, principal %+v, want the anonymous admin", rec.Code, got)
+	}
+}
+
+func TestRequireRoleWithoutPrincipal(t *testing.T) {
+	handler := RequireRole(auth.RoleViewer)(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called without a principal")
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/processes", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}
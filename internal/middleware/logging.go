@@ -1,9 +1,16 @@
 package middleware
 
 import (
+	"bufio"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"time"
+
+	"pupervisor/internal/metrics"
+
+	"github.com/gorilla/mux"
 )
 
 type responseWriter struct {
@@ -23,6 +30,27 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
+// Flush and Hijack pass through to the underlying writer so streaming
+// responses (SSE, WebSocket) work behind the middleware.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	rw.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -33,18 +61,43 @@ func Logging(next http.Handler) http.Handler {
 		}
 
 		next.ServeHTTP(wrapped, r)
+		elapsed := time.Since(start)
 
 		log.Printf(
 			"%s %s %d %s %d bytes",
 			r.Method,
 			r.URL.Path,
 			wrapped.status,
-			time.Since(start),
+			elapsed,
 			wrapped.size,
 		)
+
+		metrics.ObserveHTTP(metricsMethod(r.Method), metricsRoute(r), wrapped.status, elapsed)
 	})
 }
 
+// metricsRoute returns the route template of a request for the metrics
+// labels. Requests no route matched share one label, so that clients cannot
+// create a series per path.
+func metricsRoute(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unmatched"
+}
+
+// metricsMethod keeps the method label to the standard methods.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
 func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMetricsLabels(t *testing.T) {
+	var route string
+	record := func(w http.ResponseWriter, r *http.Request) {
+		route = metricsRoute(r)
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/api/processes/{name}/start", record)
+	r.PathPrefix("/static/").HandlerFunc(record)
+	r.NotFoundHandler = http.HandlerFunc(record)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/processes/web/start", "/api/processes/{name}/start"},
+		{"/api/processes/other/start", "/api/processes/{name}/start"},
+		{"/static/js/app.js", "/static/"},
+		{"/random-1234", "unmatched"},
+		{"/api/processes/web/explode", "unmatched"},
+	}
+	for _, tt := range tests {
+		route = ""
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if route != tt.want {
+			t.Errorf("route of %s = %q, want %q", tt.path, route, tt.want)
+		}
+	}
+
+	for method, want := range map[string]string{
+		"GET":    "GET",
+		"DELETE": "DELETE",
+		"get":    "other",
+		"PURGE":  "other",
+	} {
+		if got := metricsMethod(method); got != want {
+			t.Errorf("metricsMethod(%q) = %q, want %q", method, got, want)
+		}
+	}
+}
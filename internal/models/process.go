@@ -1,16 +1,143 @@
 package models
 
+// State is the lifecycle state of a supervised process
+type State string
+
+const (
+	StateStopped  State = "stopped"
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateBackoff  State = "backoff"
+	StateStopping State = "stopping"
+	StateExited   State = "exited"
+	// StateSucceeded is reached by a oneshot program that exited with an
+	// expected exit code
+	StateSucceeded State = "succeeded"
+	StateFatal     State = "fatal"
+	StateUnknown   State = "unknown"
+)
+
+// States lists every process state
+var States = []State{
+	StateStopped, StateStarting, StateRunning, StateBackoff,
+	StateStopping, StateExited, StateSucceeded, StateFatal, StateUnknown,
+}
+
+// IsActive reports whether an OS process exists in this state
+func (s State) IsActive() bool {
+	return s == StateStarting || s == StateRunning || s == StateStopping
+}
+
+// Health check results
+const (
+	HealthUnknown   = "unknown"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Health is the health check status of a process
+type Health struct {
+	Status    string `json:"status"`
+	Type      string `json:"type"`
+	Failures  int    `json:"failures"`
+	LastCheck string `json:"last_check,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// StateTransition records a single state change of a process
+type StateTransition struct {
+	From   State  `json:"from"`
+	To     State  `json:"to"`
+	At     string `json:"at"`
+	Reason string `json:"reason,omitempty"`
+}
+
 // Process represents a supervised process
 type Process struct {
+	Name           string            `json:"name"`
+	Program        string            `json:"program"`
+	Group          string            `json:"group"`
+	ProcessNum     int               `json:"process_num"`
+	Type           string            `json:"type"`
+	Status         State             `json:"status"`
+	StateChangedAt string            `json:"state_changed_at,omitempty"`
+	StartedAt      string            `json:"started_at,omitempty"`
+	Pid            int               `json:"pid"`
+	ExitCode       int               `json:"exit_code"`
+	Uptime         string            `json:"uptime"`
+	Memory         string            `json:"memory"`
+	CPU            string            `json:"cpu"`
+	Command        string            `json:"command"`
+	Args           []string          `json:"args"`
+	Directory      string            `json:"directory"`
+	User           string            `json:"user,omitempty"`
+	Umask          string            `json:"umask,omitempty"`
+	Rlimits        map[string]string `json:"rlimits,omitempty"`
+	Cgroup         string            `json:"cgroup,omitempty"`
+	CgroupLimits   map[string]string `json:"cgroup_limits,omitempty"`
+	AutoStart      bool              `json:"autostart"`
+	Priority       int               `json:"priority"`
+	DependsOn      []string          `json:"depends_on,omitempty"`
+	Schedule       string            `json:"schedule,omitempty"`
+	NextRun        string            `json:"next_run,omitempty"`
+	Health         *Health           `json:"health,omitempty"`
+	Resources      *ResourceUsage    `json:"resources,omitempty"`
+	LeftoverPIDs   []int             `json:"leftover_pids,omitempty"`
+	Transitions    []StateTransition `json:"transitions,omitempty"`
+}
+
+// ResourceUsage is the sampled resource consumption of a running process and
+// all of its descendants
+type ResourceUsage struct {
+	CPUPercent float64 `json:"cpu_percent"`
+	CPUSeconds float64 `json:"cpu_seconds"`
+	RSSBytes   uint64  `json:"rss_bytes"`
+	VMSBytes   uint64  `json:"vms_bytes"`
+	ReadBytes  uint64  `json:"read_bytes"`
+	WriteBytes uint64  `json:"write_bytes"`
+	Threads    int     `json:"threads"`
+	OpenFDs    int     `json:"open_fds"`
+	Processes  int     `json:"processes"`
+	SampledAt  string  `json:"sampled_at"`
+}
+
+// ProcessStats is the numeric state of a process, used for metrics
+type ProcessStats struct {
+	Name          string         `json:"name"`
+	Program       string         `json:"program"`
+	Group         string         `json:"group"`
+	Status        State          `json:"status"`
+	Pid           int            `json:"pid"`
+	Restarts      int            `json:"restarts"`
+	UptimeSeconds float64        `json:"uptime_seconds"`
+	Healthy       *bool          `json:"healthy,omitempty"`
+	Resources     *ResourceUsage `json:"resources,omitempty"`
+}
+
+// Group represents a named set of processes that are controlled together
+type Group struct {
 	Name      string   `json:"name"`
-	Status    string   `json:"status"`
-	Pid       int      `json:"pid"`
-	Uptime    string   `json:"uptime"`
-	Memory    string   `json:"memory"`
-	CPU       string   `json:"cpu"`
-	Command   string   `json:"command"`
-	Args      []string `json:"args"`
-	Directory string   `json:"directory"`
+	Programs  []string `json:"programs"`
+	Processes []string `json:"processes"`
+	Running   int      `json:"running"`
+	Total     int      `json:"total"`
+}
+
+// ScaleResult describes the outcome of changing a program's numprocs
+type ScaleResult struct {
+	Program  string   `json:"program"`
+	NumProcs int      `json:"numprocs"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+}
+
+// ReloadResult lists the programs affected by a configuration reload
+type ReloadResult struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Changed   []string `json:"changed"`
+	Unchanged []string `json:"unchanged"`
+	Applied   bool     `json:"applied"`
 }
 
 // LogEntry represents a log entry
@@ -20,3 +147,12 @@ type LogEntry struct {
 	Level     string `json:"level"`
 	Worker    string `json:"worker,omitempty"`
 }
+
+// OutputLine is a single line of process output
+type OutputLine struct {
+	Seq       uint64 `json:"seq"`
+	Timestamp string `json:"timestamp"`
+	Process   string `json:"process"`
+	Stream    string `json:"stream"`
+	Line      string `json:"line"`
+}
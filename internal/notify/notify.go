@@ -0,0 +1,395 @@
+// Package notify sends process events — crashes, FATAL states, restart
+// storms and recoveries — to webhooks, Slack and Telegram chats and email.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"text/template"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+var ErrUnknownChannel = errors.New("unknown notification channel")
+
+// Events
+const (
+	EventCrash        = config.EventCrash
+	EventFatal        = config.EventFatal
+	EventRestartStorm = config.EventRestartStorm
+	EventRecovered    = config.EventRecovered
+	EventTest         = "test"
+	// EventRunning is reported when a process reaches RUNNING or SUCCEEDED.
+	// It is never sent; it turns an open alert into a recovered event.
+	EventRunning = "running"
+)
+
+// queueSize is the number of events waiting to be sent before new ones are
+// dropped
+const queueSize = 256
+
+var defaultTemplates = map[string]string{
+	EventCrash:        `{{.Process}} on {{.Host}} crashed ({{.Reason}}): {{.Message}}`,
+	EventFatal:        `{{.Process}} on {{.Host}} entered FATAL: {{.Message}}`,
+	EventRestartStorm: `{{.Process}} on {{.Host}} crashed {{.Crashes}} times within {{.Window}}`,
+	EventRecovered:    `{{.Process}} on {{.Host}} has been running again for {{.Window}}`,
+	EventTest:         `Test notification from pupervisor on {{.Host}}`,
+}
+
+const defaultSubject = `[pupervisor] {{.Event}}{{with .Process}} {{.}}{{end}}`
+
+// Event is something that happened to a process. Templates see its fields,
+// e.g. {{.Process}} or {{.ExitCode}}; webhooks receive it as JSON.
+type Event struct {
+	Event      string        `json:"event"`
+	Process    string        `json:"process,omitempty"`
+	Program    string        `json:"program,omitempty"`
+	Group      string        `json:"group,omitempty"`
+	Host       string        `json:"host"`
+	Time       time.Time     `json:"time"`
+	Message    string        `json:"message,omitempty"`
+	Reason     string        `json:"reason,omitempty"`
+	ExitCode   int           `json:"exit_code"`
+	Signal     string        `json:"signal,omitempty"`
+	Stderr     string        `json:"stderr,omitempty"`
+	Crashes    int           `json:"crashes,omitempty"`
+	Window     time.Duration `json:"-"` // storm or recovery window
+	Suppressed int           `json:"suppressed,omitempty"`
+}
+
+// TestResult is the outcome of a test notification on one channel.
+type TestResult struct {
+	Channel string `json:"channel"`
+	Type    string `json:"type"`
+	Error   string `json:"error,omitempty"`
+}
+
+type channel struct {
+	cfg     config.NotifyChannelConfig
+	events  map[string]bool
+	message *template.Template
+	subject *template.Template
+	sender  sender
+	// recent holds the send times within the last minute, dropped the
+	// messages over the rate limit not reported yet
+	recent  []time.Time
+	dropped int
+}
+
+// alert is an open FATAL or restart storm alert of a process. running is
+// the event of its last start, nil while it is not running.
+type alert struct {
+	running *Event
+}
+
+// Notifier turns reported events into notifications. Notify only queues an
+// event; Run sends them one at a time, so slow channels never hold up the
+// caller. All state is owned by the Run goroutine.
+type Notifier struct {
+	cfg       config.NotificationsConfig
+	host      string
+	events    map[string]bool
+	templates map[string]*template.Template
+	channels  []*channel
+	queue     chan Event
+
+	// Log reports delivery problems; it defaults to the standard logger
+	Log func(level, message string)
+
+	// crashes holds the recent crash times of each process
+	crashes map[string][]time.Time
+	// alerts holds processes reported FATAL or in a restart storm
+	alerts map[string]*alert
+	// lastSent and suppressed deduplicate events per event and process
+	lastSent   map[string]time.Time
+	suppressed map[string]int
+}
+
+// New creates a notifier for the channels in cfg, which must have its
+// defaults set.
+func New(cfg config.NotificationsConfig) (*Notifier, error) {
+	host, _ := os.Hostname()
+	n := &Notifier{
+		cfg:        cfg,
+		host:       host,
+		events:     toSet(cfg.Events),
+		templates:  make(map[string]*template.Template),
+		queue:      make(chan Event, queueSize),
+		Log:        func(level, message string) { log.Printf("Notifications: %s", message) },
+		crashes:    make(map[string][]time.Time),
+		alerts:     make(map[string]*alert),
+		lastSent:   make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+
+	for event, text := range defaultTemplates {
+		if custom, ok := cfg.Templates[event]; ok {
+			text = custom
+		}
+		tmpl, err := template.New(event).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", event, err)
+		}
+		n.templates[event] = tmpl
+	}
+
+	for _, chCfg := range cfg.Channels {
+		ch := &channel{cfg: chCfg, sender: newSender(chCfg)}
+		if len(chCfg.Events) > 0 {
+			ch.events = toSet(chCfg.Events)
+		}
+		var err error
+		if chCfg.Template != "" {
+			if ch.message, err = template.New(chCfg.Name).Parse(chCfg.Template); err != nil {
+				return nil, fmt.Errorf("channel %s: template: %w", chCfg.Name, err)
+			}
+		}
+		subject := chCfg.Subject
+		if subject == "" {
+			subject = defaultSubject
+		}
+		if ch.subject, err = template.New(chCfg.Name).Parse(subject); err != nil {
+			return nil, fmt.Errorf("channel %s: subject: %w", chCfg.Name, err)
+		}
+		n.channels = append(n.channels, ch)
+	}
+
+	return n, nil
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// Notify queues an event. It never blocks; when the queue is full the event
+// is dropped. A nil Notifier ignores all events.
+func (n *Notifier) Notify(ev Event) {
+	if n == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	ev.Host = n.host
+
+	select {
+	case n.queue <- ev:
+	default:
+		n.Log("error", fmt.Sprintf("queue full, dropped %s event of %s", ev.Event, ev.Process))
+	}
+}
+
+// Run sends queued events until ctx is cancelled.
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-n.queue:
+			n.handle(ev)
+		case now := <-ticker.C:
+			n.checkRecovered(now)
+		}
+	}
+}
+
+// handle derives restart storms and recoveries from the reported events
+// and delivers them.
+func (n *Notifier) handle(ev Event) {
+	switch ev.Event {
+	case EventRunning:
+		if a := n.alerts[ev.Process]; a != nil {
+			a.running = &ev
+		}
+
+	case EventCrash:
+		if a := n.alerts[ev.Process]; a != nil {
+			a.running = nil
+		}
+		n.deliver(ev)
+
+		window := time.Duration(n.cfg.StormWindow) * time.Second
+		recent := n.crashes[ev.Process][:0]
+		for _, t := range n.crashes[ev.Process] {
+			if ev.Time.Sub(t) < window {
+				recent = append(recent, t)
+			}
+		}
+		recent = append(recent, ev.Time)
+		if len(recent) < n.cfg.StormCrashes {
+			n.crashes[ev.Process] = recent
+			return
+		}
+		// A new storm needs as many crashes again
+		delete(n.crashes, ev.Process)
+		n.alerts[ev.Process] = &alert{}
+
+		storm := ev
+		storm.Event = EventRestartStorm
+		storm.Crashes = len(recent)
+		storm.Window = window
+		n.deliver(storm)
+
+	case EventFatal:
+		n.alerts[ev.Process] = &alert{}
+		n.deliver(ev)
+
+	default:
+		n.deliver(ev)
+	}
+}
+
+// checkRecovered closes the alerts of processes that have been running for
+// the recovery window and reports them recovered.
+func (n *Notifier) checkRecovered(now time.Time) {
+	window := time.Duration(n.cfg.RecoveryWindow) * time.Second
+	for process, a := range n.alerts {
+		if a.running == nil || now.Sub(a.running.Time) < window {
+			continue
+		}
+		delete(n.alerts, process)
+
+		ev := *a.running
+		ev.Event = EventRecovered
+		ev.Time = now
+		ev.Window = window
+		n.deliver(ev)
+	}
+}
+
+// deliver sends ev to every channel that wants it, unless the same event of
+// the same process was sent within the dedup window.
+func (n *Notifier) deliver(ev Event) {
+	if !n.events[ev.Event] {
+		return
+	}
+
+	key := ev.Event + "/" + ev.Process
+	if last, ok := n.lastSent[key]; ok && ev.Time.Sub(last) < time.Duration(n.cfg.DedupWindow)*time.Second {
+		n.suppressed[key]++
+		return
+	}
+	n.lastSent[key] = ev.Time
+	ev.Suppressed = n.suppressed[key]
+	delete(n.suppressed, key)
+
+	for _, ch := range n.channels {
+		if !ch.wants(ev) {
+			continue
+		}
+		if !ch.allow(ev.Time, *n.cfg.RateLimit) {
+			continue
+		}
+		if ch.dropped > 0 {
+			n.Log("warning", fmt.Sprintf("channel %s: dropped %d notification(s) over the rate limit", ch.cfg.Name, ch.dropped))
+			ch.dropped = 0
+		}
+		if err := n.send(ch, ev); err != nil {
+			n.Log("error", fmt.Sprintf("channel %s: failed to send %s event of %s: %v", ch.cfg.Name, ev.Event, ev.Process, err))
+		}
+	}
+}
+
+// wants reports whether the channel subscribed to the event and, for
+// process events, to the program.
+func (ch *channel) wants(ev Event) bool {
+	if ch.events != nil && !ch.events[ev.Event] {
+		return false
+	}
+	if len(ch.cfg.Programs) == 0 || ev.Process == "" {
+		return true
+	}
+	for _, pattern := range ch.cfg.Programs {
+		if ok, _ := path.Match(pattern, ev.Program); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, ev.Process); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allow applies the rate limit of limit messages per minute, counting the
+// messages dropped.
+func (ch *channel) allow(now time.Time, limit int) bool {
+	if limit == 0 {
+		return true
+	}
+	recent := ch.recent[:0]
+	for _, t := range ch.recent {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	ch.recent = recent
+	if len(recent) >= limit {
+		ch.dropped++
+		return false
+	}
+	ch.recent = append(ch.recent, now)
+	return true
+}
+
+// send renders ev for the channel and sends it.
+func (n *Notifier) send(ch *channel, ev Event) error {
+	tmpl := ch.message
+	if tmpl == nil {
+		tmpl = n.templates[ev.Event]
+	}
+	text, err := render(tmpl, ev)
+	if err != nil {
+		return err
+	}
+	if ev.Suppressed > 0 {
+		text += fmt.Sprintf("\n(%d similar notification(s) suppressed)", ev.Suppressed)
+	}
+	subject, err := render(ch.subject, ev)
+	if err != nil {
+		return err
+	}
+	return ch.sender.send(message{Event: ev, Subject: subject, Text: text})
+}
+
+func render(tmpl *template.Template, ev Event) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ev); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Test sends a test notification to the named channel, or to every channel
+// if name is empty, ignoring event subscriptions, routing and rate limits.
+func (n *Notifier) Test(name string) ([]TestResult, error) {
+	ev := Event{Event: EventTest, Host: n.host, Time: time.Now()}
+
+	results := []TestResult{}
+	for _, ch := range n.channels {
+		if name != "" && ch.cfg.Name != name {
+			continue
+		}
+		result := TestResult{Channel: ch.cfg.Name, Type: ch.cfg.Type}
+		if err := n.send(ch, ev); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	if name != "" && len(results) == 0 {
+		return nil, ErrUnknownChannel
+	}
+	return results, nil
+}
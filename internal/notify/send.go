@@ -0,0 +1,212 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+const (
+	sendTimeout = 10 * time.Second
+	// maxErrorBody is the number of bytes of an error response quoted in the
+	// error
+	maxErrorBody = 200
+
+	telegramAPI = "https://api.telegram.org"
+)
+
+var httpClient = &http.Client{Timeout: sendTimeout}
+
+// message is a rendered notification.
+type message struct {
+	Event
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+type sender interface {
+	send(msg message) error
+}
+
+func newSender(cfg config.NotifyChannelConfig) sender {
+	switch cfg.Type {
+	case config.ChannelSlack:
+		return slackSender{url: cfg.URL}
+	case config.ChannelTelegram:
+		base := cfg.URL
+		if base == "" {
+			base = telegramAPI
+		}
+		return telegramSender{url: strings.TrimSuffix(base, "/") + "/bot" + cfg.BotToken + "/sendMessage", chatID: cfg.ChatID}
+	case config.ChannelEmail:
+		return emailSender{smtp: *cfg.SMTP}
+	default:
+		return webhookSender{url: cfg.URL, headers: cfg.Headers}
+	}
+}
+
+// webhookSender posts the event as JSON, with the rendered subject and text.
+type webhookSender struct {
+	url     string
+	headers map[string]string
+}
+
+func (s webhookSender) send(msg message) error {
+	return postJSON(s.url, s.headers, msg)
+}
+
+// slackSender posts to a Slack incoming webhook, or any service accepting
+// the same payload, e.g. Mattermost or Discord's /slack endpoint.
+type slackSender struct {
+	url string
+}
+
+func (s slackSender) send(msg message) error {
+	return postJSON(s.url, nil, map[string]string{"text": msg.Text})
+}
+
+// telegramSender sends through the sendMessage method of the Telegram Bot
+// API.
+type telegramSender struct {
+	url    string
+	chatID string
+}
+
+func (s telegramSender) send(msg message) error {
+	return postJSON(s.url, nil, map[string]string{"chat_id": s.chatID, "text": msg.Text})
+}
+
+func postJSON(endpoint string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return withoutURL(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pupervisor")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return withoutURL(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// withoutURL drops the request URL from an error of net/http, since URLs
+// can hold secrets such as the Telegram bot token, and delivery errors end
+// up in the system log and in test results.
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s: %w", urlErr.Op, urlErr.Err)
+	}
+	return err
+}
+
+// emailSender sends plain text mail over SMTP. Port 465 uses TLS from the
+// start; on other ports the connection is upgraded with STARTTLS when the
+// server offers it.
+type emailSender struct {
+	smtp config.SMTPConfig
+}
+
+func (s emailSender) send(msg message) error {
+	cfg := s.smtp
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+
+	dialer := &net.Dialer{Timeout: sendTimeout}
+	var conn net.Conn
+	var err error
+	if cfg.Port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(3 * sendTimeout))
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && cfg.Port != 465 {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, to := range cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(mailBody(cfg, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func mailBody(cfg config.SMTPConfig, msg message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", msg.Time.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Text, "\r\n", "\n"), "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// headerValue keeps a rendered subject on one line.
+func headerValue(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"pupervisor/internal/storage"
+)
+
+var errNoCgroups = errors.New("cgroup limits are configured but cgroups are not available")
+
+// placeInCgroup prepares the cgroup of an instance and makes cmd start in
+// it. It returns the cgroup directory, or "" when cgroups are disabled, and a
+// function to call once the command was started. Caller must hold pm.mu.
+func (pm *ProcessManager) placeInCgroup(cmd *exec.Cmd, name string, state *ProcessState) (string, func(), error) {
+	if pm.cgroups == nil {
+		if state.Config.Cgroup != nil {
+			return "", nil, errNoCgroups
+		}
+		return "", func() {}, nil
+	}
+
+	dir, err := pm.cgroups.prepare(state.Program, name, state.Config.Cgroup)
+	if err != nil {
+		return "", nil, fmt.Errorf("cgroup: %w", err)
+	}
+	release, err := attachCgroup(cmd, dir)
+	if err != nil {
+		removeCgroup(dir)
+		return "", nil, fmt.Errorf("cgroup: %w", err)
+	}
+	return dir, release, nil
+}
+
+// UseCgroups places every process started from now on into a cgroup below
+// cgroups.
+func (pm *ProcessManager) UseCgroups(cgroups *Cgroups) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.cgroups = cgroups
+}
+
+// recordOOMKills records OOM kills in the cgroup of a running process that
+// were not seen before, e.g. of a child process. Caller must hold pm.mu.
+func (pm *ProcessManager) recordOOMKills(name string, state *ProcessState, kills int, now time.Time) {
+	if kills <= state.oomKills {
+		return
+	}
+
+	err := fmt.Errorf("OOM killer killed %d process(es) in cgroup %s", kills-state.oomKills, state.cgroup)
+	state.oomKills = kills
+	pm.log("error", fmt.Sprintf("Process %s: %v", name, err), name)
+	pm.saveCrashRecord(name, state, state.StartTime, now, err, storage.CrashReasonOOM)
+}
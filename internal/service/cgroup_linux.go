@@ -0,0 +1,251 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+)
+
+// cgroupControllers are enabled for the programs' cgroups where available.
+var cgroupControllers = []string{"cpu", "memory", "pids"}
+
+// cgroupPeriod is the cpu.max period in microseconds.
+const cgroupPeriod = 100000
+
+// Cgroups manages one cgroup v2 per program below a parent cgroup. Program
+// cgroups hold the limits; every instance runs in a leaf cgroup of its own
+// below it, which is used for accounting and OOM detection.
+type Cgroups struct {
+	root string
+}
+
+// NewCgroups creates the parent cgroup and enables the cpu, memory and pids
+// controllers for its children. A relative parent is resolved against the
+// cgroup2 mount point.
+func NewCgroups(parent string) (*Cgroups, error) {
+	if !filepath.IsAbs(parent) {
+		mount, err := cgroup2Mount()
+		if err != nil {
+			return nil, err
+		}
+		parent = filepath.Join(mount, parent)
+	}
+
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+	// The parent only gets controllers its own parent delegates
+	enableControllers(filepath.Dir(parent))
+	enableControllers(parent)
+
+	return &Cgroups{root: parent}, nil
+}
+
+// Root returns the parent cgroup directory.
+func (cg *Cgroups) Root() string {
+	return cg.root
+}
+
+// cgroup2Mount finds the cgroup2 mount point in /proc/self/mountinfo.
+func cgroup2Mount() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 0:30 / /sys/fs/cgroup rw,nosuid - cgroup2 cgroup2 rw
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" && len(fields) > 4 {
+				return fields[4], nil
+			}
+		}
+	}
+	return "", errors.New("no cgroup2 file system mounted")
+}
+
+// enableControllers enables the available cgroupControllers for the
+// children of dir. Errors are ignored: the limits that need a missing
+// controller fail to apply with a clearer message.
+func enableControllers(dir string) {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return
+	}
+	available := strings.Fields(string(data))
+
+	for _, controller := range cgroupControllers {
+		for _, a := range available {
+			if a == controller {
+				_ = os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+"+controller), 0644)
+			}
+		}
+	}
+}
+
+// prepare creates the cgroup of an instance of program, applies the
+// program's limits and returns the instance's cgroup directory.
+func (cg *Cgroups) prepare(program, instance string, limits *config.CgroupConfig) (string, error) {
+	programDir := filepath.Join(cg.root, program)
+	if err := os.MkdirAll(programDir, 0755); err != nil {
+		return "", err
+	}
+	enableControllers(programDir)
+
+	if limits == nil {
+		limits = &config.CgroupConfig{}
+	}
+
+	// Unset limits are written as "max" so that removing one from the
+	// configuration lifts it again
+	cpuMax := fmt.Sprintf("max %d", cgroupPeriod)
+	if limits.CPUMax > 0 {
+		cpuMax = fmt.Sprintf("%d %d", int64(limits.CPUMax*cgroupPeriod), cgroupPeriod)
+	}
+	for _, l := range []struct {
+		file  string
+		value string
+		set   bool
+	}{
+		{"cpu.max", cpuMax, limits.CPUMax > 0},
+		{"memory.max", limitValue(int64(limits.MemoryMax)), limits.MemoryMax > 0},
+		{"memory.high", limitValue(int64(limits.MemoryHigh)), limits.MemoryHigh > 0},
+		{"pids.max", limitValue(int64(limits.PidsMax)), limits.PidsMax > 0},
+	} {
+		path := filepath.Join(programDir, l.file)
+		if _, err := os.Stat(path); err != nil {
+			if l.set {
+				controller, _, _ := strings.Cut(l.file, ".")
+				return "", fmt.Errorf("cannot set %s: %s controller not available in %s", l.file, controller, cg.root)
+			}
+			continue
+		}
+		if err := os.WriteFile(path, []byte(l.value), 0644); err != nil {
+			return "", fmt.Errorf("cannot set %s: %w", l.file, err)
+		}
+	}
+
+	dir := filepath.Join(programDir, instance)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func limitValue(v int64) string {
+	if v <= 0 {
+		return "max"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// attachCgroup makes cmd start directly inside the cgroup dir
+// (CLONE_INTO_CGROUP), so not even early children escape it. The returned
+// function closes the directory once the command was started.
+func attachCgroup(cmd *exec.Cmd, dir string) (func(), error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+	return func() { f.Close() }, nil
+}
+
+// removeCgroup removes an instance cgroup and, once its last instance is
+// gone, the program cgroup. Cgroups that still contain processes stay.
+func removeCgroup(dir string) {
+	if os.Remove(dir) == nil {
+		_ = os.Remove(filepath.Dir(dir))
+	}
+}
+
+// cgroupProcs lists the pids in the cgroup dir.
+func cgroupProcs(dir string) []int {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// cgroupOOMKills returns the number of processes in the cgroup dir killed by
+// the OOM killer, from memory.events.
+func cgroupOOMKills(dir string) int {
+	var kills int
+	readFlatKeyed(filepath.Join(dir, "memory.events"), func(key, value string) {
+		if key == "oom_kill" {
+			kills, _ = strconv.Atoi(value)
+		}
+	})
+	return kills
+}
+
+// sampleCgroup sums the usage of all processes in the cgroup dir. CPU time
+// and memory come from the cgroup's own accounting, which also covers
+// processes that already exited or left the process tree.
+func sampleCgroup(dir string) (*models.ResourceUsage, error) {
+	pids := cgroupProcs(dir)
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("no processes in %s", dir)
+	}
+
+	usage := &models.ResourceUsage{}
+	for _, pid := range pids {
+		if u, err := readProcess(pid); err == nil {
+			addUsage(usage, u)
+		}
+	}
+
+	// cpu.stat exists even without the cpu controller
+	readFlatKeyed(filepath.Join(dir, "cpu.stat"), func(key, value string) {
+		if key == "usage_usec" {
+			if usec, err := strconv.ParseUint(value, 10, 64); err == nil {
+				usage.CPUSeconds = float64(usec) / 1e6
+			}
+		}
+	})
+	if data, err := os.ReadFile(filepath.Join(dir, "memory.current")); err == nil {
+		if current, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			usage.RSSBytes = current
+		}
+	}
+
+	return usage, nil
+}
+
+// readFlatKeyed calls fn for every "key value" line of a cgroup file.
+func readFlatKeyed(path string, fn func(key, value string)) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			fn(fields[0], fields[1])
+		}
+	}
+}
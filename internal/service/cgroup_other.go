@@ -0,0 +1,44 @@
+//go:build !linux
+
+package service
+
+import (
+	"errors"
+	"os/exec"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+)
+
+// Cgroups is only available on Linux.
+type Cgroups struct{}
+
+func NewCgroups(parent string) (*Cgroups, error) {
+	return nil, errors.New("cgroups are only supported on linux")
+}
+
+func (cg *Cgroups) Root() string {
+	return ""
+}
+
+func (cg *Cgroups) prepare(program, instance string, limits *config.CgroupConfig) (string, error) {
+	return "", errors.New("cgroups are only supported on linux")
+}
+
+func attachCgroup(cmd *exec.Cmd, dir string) (func(), error) {
+	return nil, errors.New("cgroups are only supported on linux")
+}
+
+func removeCgroup(dir string) {}
+
+func cgroupProcs(dir string) []int {
+	return nil
+}
+
+func cgroupOOMKills(dir string) int {
+	return 0
+}
+
+func sampleCgroup(dir string) (*models.ResourceUsage, error) {
+	return nil, errors.New("cgroups are only supported on linux")
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"fmt"
+	"os/exec"
+
+	"pupervisor/internal/config"
+)
+
+// startCommand starts cmd as the configured user, with the configured umask
+// and resource limits. The limits are set before the program runs, see
+// startWithRlimits.
+func startCommand(cmd *exec.Cmd, cfg config.ProcessConfig) error {
+	if cfg.User != "" {
+		if err := setCredential(cmd, cfg.User); err != nil {
+			return fmt.Errorf("user: %w", err)
+		}
+	}
+
+	start := cmd.Start
+	if cfg.Umask != "" {
+		mask, _ := config.ParseUmask(cfg.Umask)
+		start = func() error { return startWithUmask(cmd, mask) }
+	}
+
+	if cfg.Rlimits != nil {
+		return startWithRlimits(cmd, cfg.Rlimits, start)
+	}
+	return start()
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+
+package service
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"pupervisor/internal/config"
+)
+
+// setCredential makes cmd run as the user described by spec. The user is
+// looked up at every start so changes to its groups are picked up.
+func setCredential(cmd *exec.Cmd, spec string) error {
+	id, err := config.LookupIdentity(spec)
+	if err != nil {
+		return err
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    id.UID,
+		Gid:    id.GID,
+		Groups: id.Groups,
+		// Only root may change supplementary groups
+		NoSetGroups: os.Geteuid() != 0,
+	}
+	return nil
+}
+
+// umaskMu serializes starts that change the umask, which is process-wide.
+var umaskMu sync.Mutex
+
+// startWithUmask starts cmd with the given umask. The child inherits the
+// umask at fork, so pupervisor's own is swapped only for the start.
+func startWithUmask(cmd *exec.Cmd, mask int) error {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	return cmd.Start()
+}
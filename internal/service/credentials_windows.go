@@ -0,0 +1,19 @@
+//go:build windows
+
+package service
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errUnsupported = errors.New("not supported on windows")
+
+func setCredential(cmd *exec.Cmd, spec string) error {
+	return errUnsupported
+}
+
+// startWithUmask ignores the umask, which Windows does not have.
+func startWithUmask(cmd *exec.Cmd, mask int) error {
+	return cmd.Start()
+}
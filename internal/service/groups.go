@@ -0,0 +1,246 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"pupervisor/internal/models"
+)
+
+var (
+	ErrInvalidNumProcs     = errors.New("numprocs must be at least 1")
+	ErrProcessNameTemplate = errors.New("process_name must contain %(process_num) to run more than one instance")
+)
+
+// GetGroups returns all process groups with their member processes.
+func (pm *ProcessManager) GetGroups() []models.Group {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	byName := make(map[string]*models.Group)
+	programs := make(map[string]map[string]bool)
+	for name, state := range pm.processes {
+		g, ok := byName[state.Group]
+		if !ok {
+			g = &models.Group{Name: state.Group, Programs: []string{}, Processes: []string{}}
+			byName[state.Group] = g
+			programs[state.Group] = make(map[string]bool)
+		}
+		g.Processes = append(g.Processes, name)
+		g.Total++
+		if state.Status == models.StateRunning {
+			g.Running++
+		}
+		if !programs[state.Group][state.Program] {
+			programs[state.Group][state.Program] = true
+			g.Programs = append(g.Programs, state.Program)
+		}
+	}
+
+	result := make([]models.Group, 0, len(byName))
+	for _, g := range byName {
+		sort.Strings(g.Programs)
+		sort.Strings(g.Processes)
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// groupMembers returns the process names belonging to a group in start order.
+func (pm *ProcessManager) groupMembers(group string) ([]string, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	var names []string
+	for name, state := range pm.processes {
+		if state.Group == group {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, ErrGroupNotFound
+	}
+
+	pm.sortByStartOrder(names)
+	return names, nil
+}
+
+func (pm *ProcessManager) StartGroup(group string) (succeeded int, failed int, err error) {
+	names, err := pm.groupMembers(group)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pm.log("info", fmt.Sprintf("Starting group %s (%d processes)", group, len(names)), "")
+
+	for _, name := range names {
+		if err := pm.StartProcess(name); err != nil {
+			if errors.Is(err, ErrProcessAlreadyRunning) {
+				continue
+			}
+			pm.log("error", fmt.Sprintf("Failed to start %s: %v", name, err), name)
+			failed++
+		} else {
+			succeeded++
+		}
+	}
+
+	return succeeded, failed, nil
+}
+
+func (pm *ProcessManager) StopGroup(group string) (succeeded int, failed int, err error) {
+	names, err := pm.groupMembers(group)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	pm.log("info", fmt.Sprintf("Stopping group %s (%d processes)", group, len(names)), "")
+
+	for i := len(names) - 1; i >= 0; i-- {
+		name := names[i]
+		if err := pm.StopProcess(name); err != nil {
+			if errors.Is(err, ErrProcessNotRunning) {
+				continue
+			}
+			pm.log("error", fmt.Sprintf("Failed to stop %s: %v", name, err), name)
+			failed++
+		} else {
+			succeeded++
+		}
+	}
+
+	return succeeded, failed, nil
+}
+
+func (pm *ProcessManager) RestartGroup(group string) (succeeded int, failed int, err error) {
+	names, err := pm.groupMembers(group)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	succeeded, failed = pm.RestartSelected(names)
+	return succeeded, failed, nil
+}
+
+// ScaleProgram changes the number of running instances of a program. New
+// instances are started when the program autostarts or any of its existing
+// instances is running; surplus instances (highest process numbers first) are
+// stopped and removed. Other instances are left untouched.
+func (pm *ProcessManager) ScaleProgram(program string, numprocs int) (*models.ScaleResult, error) {
+	if numprocs < 1 {
+		return nil, ErrInvalidNumProcs
+	}
+
+	pm.mu.Lock()
+
+	procCfg, ok := pm.programs[program]
+	if !ok {
+		pm.mu.Unlock()
+		return nil, ErrProgramNotFound
+	}
+	if numprocs > 1 && !procCfg.HasProcessNum() {
+		pm.mu.Unlock()
+		return nil, ErrProcessNameTemplate
+	}
+
+	instances := pm.instancesOf(program)
+	result := &models.ScaleResult{
+		Program:  program,
+		NumProcs: numprocs,
+		Added:    []string{},
+		Removed:  []string{},
+	}
+
+	startNew := procCfg.AutoStart
+	for _, state := range instances {
+		if state.Status.IsActive() {
+			startNew = true
+		}
+	}
+
+	if numprocs > len(instances) {
+		next := procCfg.NumProcsStart
+		if len(instances) > 0 {
+			next = instances[len(instances)-1].ProcessNum + 1
+		}
+
+		nums := make([]int, 0, numprocs-len(instances))
+		for i := 0; i < numprocs-len(instances); i++ {
+			num := next + i
+			if _, exists := pm.processes[procCfg.InstanceName(num)]; exists {
+				pm.mu.Unlock()
+				return nil, fmt.Errorf("process name %q already in use", procCfg.InstanceName(num))
+			}
+			nums = append(nums, num)
+		}
+
+		for _, num := range nums {
+			state := pm.addInstance(procCfg, num)
+			result.Added = append(result.Added, state.Config.Name)
+		}
+	} else {
+		for _, state := range instances[numprocs:] {
+			result.Removed = append(result.Removed, state.Config.Name)
+		}
+	}
+
+	procCfg.NumProcs = numprocs
+	pm.programs[program] = procCfg
+	pm.mu.Unlock()
+
+	pm.log("info", fmt.Sprintf("Scaling program %s to %d instance(s): %d added, %d removed",
+		program, numprocs, len(result.Added), len(result.Removed)), "")
+
+	pm.removeInstances(result.Removed)
+
+	if startNew {
+		for _, name := range result.Added {
+			if err := pm.StartProcess(name); err != nil {
+				pm.log("error", fmt.Sprintf("Failed to start %s: %v", name, err), name)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// instancesOf returns the instances of a program sorted by process number.
+// Caller must hold pm.mu.
+func (pm *ProcessManager) instancesOf(program string) []*ProcessState {
+	var instances []*ProcessState
+	for _, state := range pm.processes {
+		if state.Program == program {
+			instances = append(instances, state)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ProcessNum < instances[j].ProcessNum
+	})
+	return instances
+}
+
+// removeInstances stops the named processes and drops them from the manager,
+// closing log files no other process writes to.
+func (pm *ProcessManager) removeInstances(names []string) {
+	for i := len(names) - 1; i >= 0; i-- {
+		if err := pm.StopProcess(names[i]); err != nil && !errors.Is(err, ErrProcessNotRunning) {
+			pm.log("error", fmt.Sprintf("Failed to stop %s: %v", names[i], err), names[i])
+		}
+	}
+
+	pm.mu.Lock()
+	for _, name := range names {
+		delete(pm.processes, name)
+	}
+	pm.closeUnusedLogFiles()
+	pm.mu.Unlock()
+
+	for _, name := range names {
+		pm.output.Forget(name)
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+	"pupervisor/internal/storage"
+)
+
+// runHealthCheck performs a single probe of a program's health check and
+// returns nil when it passed. Exec checks run as the program's user, in its
+// directory and with its environment.
+func runHealthCheck(cfg config.ProcessConfig) error {
+	hc := cfg.HealthCheck
+	timeout := time.Duration(hc.Timeout) * time.Second
+
+	switch hc.Type {
+	case config.HealthCheckHTTP:
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(hc.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != hc.ExpectedStatus {
+			return fmt.Errorf("GET %s returned %d, expected %d", hc.URL, resp.StatusCode, hc.ExpectedStatus)
+		}
+		return nil
+
+	case config.HealthCheckTCP:
+		conn, err := net.DialTimeout("tcp", hc.Address, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case config.HealthCheckExec:
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, hc.Command, hc.Args...)
+		setCommandEnv(cmd, cfg)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+
+		err := startCommand(cmd, cfg)
+		if err == nil {
+			err = cmd.Wait()
+		}
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%s timed out after %s", hc.Command, timeout)
+			}
+			if out.Len() > 0 {
+				return fmt.Errorf("%s: %v: %s", hc.Command, err, truncate(strings.TrimSpace(out.String()), 200))
+			}
+			return fmt.Errorf("%s: %v", hc.Command, err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown health check type %q", hc.Type)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// runHealthChecks probes a RUNNING process every interval until it exits or
+// leaves the RUNNING state.
+func (pm *ProcessManager) runHealthChecks(name string, state *ProcessState, cmd *exec.Cmd, cfg config.ProcessConfig, done <-chan struct{}) {
+	hc := cfg.HealthCheck
+	ticker := time.NewTicker(time.Duration(hc.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		err := runHealthCheck(cfg)
+		if !pm.recordHealth(name, state, cmd, hc, err) {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordHealth stores a check result and acts on the failure threshold. It
+// reports whether checking should continue.
+func (pm *ProcessManager) recordHealth(name string, state *ProcessState, cmd *exec.Cmd, hc *config.HealthCheckConfig, err error) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.processes[name] != state || state.Cmd != cmd || state.Status != models.StateRunning {
+		return false
+	}
+
+	health := &state.health
+	health.LastCheck = time.Now().Format(time.RFC3339)
+
+	if err == nil {
+		if health.Status == models.HealthUnhealthy {
+			pm.log("info", fmt.Sprintf("Process %s is healthy again", name), name)
+		}
+		health.Status = models.HealthHealthy
+		health.Failures = 0
+		health.LastError = ""
+		state.healthRestarts = 0
+		return true
+	}
+
+	health.Failures++
+	health.LastError = err.Error()
+	if health.Failures < hc.FailureThreshold {
+		pm.log("warning", fmt.Sprintf("Health check of %s failed (%d/%d): %v", name, health.Failures, hc.FailureThreshold, err), name)
+		return true
+	}
+
+	if health.Status != models.HealthUnhealthy {
+		pm.log("error", fmt.Sprintf("Process %s is unhealthy after %d failed checks: %v", name, health.Failures, err), name)
+	}
+	health.Status = models.HealthUnhealthy
+
+	if hc.OnFailure != config.HealthActionRestart {
+		return true
+	}
+
+	state.healthRestarts++
+	pm.saveCrashRecord(name, state, state.StartTime, time.Now(), err, storage.CrashReasonUnhealthy)
+	go pm.restartUnhealthy(name, state, cmd, "unhealthy: "+err.Error())
+	return false
+}
+
+// restartUnhealthy stops a process that failed its health check and starts
+// it again after the backoff delay. The restarts count as failed start
+// attempts until a check passes; once startretries is exhausted the process
+// is left FATAL instead.
+func (pm *ProcessManager) restartUnhealthy(name string, state *ProcessState, cmd *exec.Cmd, reason string) {
+	pm.mu.RLock()
+	current := pm.processes[name] == state && state.Cmd == cmd && state.Status == models.StateRunning
+	pm.mu.RUnlock()
+	if !current {
+		return
+	}
+
+	pm.log("warning", fmt.Sprintf("Stopping process %s (%s)", name, reason), name)
+	if err := pm.StopProcess(name); err != nil && !errors.Is(err, ErrProcessNotRunning) {
+		pm.log("error", fmt.Sprintf("Failed to stop %s: %v", name, err), name)
+		return
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	// The process may have been started manually or removed meanwhile
+	if pm.processes[name] != state || state.Cmd != cmd || state.Status != models.StateStopped {
+		return
+	}
+	state.retries = state.healthRestarts
+	pm.scheduleRestart(name, state, reason)
+}
+
+// healthReady reports whether a process passes its health check, or has
+// none configured. Caller must hold pm.mu.
+func healthReady(state *ProcessState) bool {
+	return state.Config.HealthCheck == nil || state.health.Status == models.HealthHealthy
+}
+
+// Unhealthy returns the names of running processes whose health check is
+// failing.
+func (pm *ProcessManager) Unhealthy() []string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	names := []string{}
+	for _, name := range pm.startOrder() {
+		state := pm.processes[name]
+		if state.Status == models.StateRunning && state.health.Status == models.HealthUnhealthy {
+			names = append(names, name)
+		}
+	}
+	return names
+}
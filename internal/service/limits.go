@@ -0,0 +1,52 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"pupervisor/internal/models"
+	"pupervisor/internal/storage"
+)
+
+// enforceLimits restarts a RUNNING process whose latest sample exceeds
+// max_memory, or whose CPU usage stayed above max_cpu_percent for
+// max_cpu_window seconds. Caller must hold pm.mu.
+func (pm *ProcessManager) enforceLimits(name string, state *ProcessState, usage *models.ResourceUsage, now time.Time) {
+	cfg := state.Config
+	if state.Status != models.StateRunning {
+		state.cpuOverSince = time.Time{}
+		return
+	}
+
+	var violation error
+	if cfg.MaxMemory > 0 && usage.RSSBytes > uint64(cfg.MaxMemory) {
+		violation = fmt.Errorf("memory usage %s exceeds max_memory %s",
+			formatBytes(int64(usage.RSSBytes)), formatBytes(int64(cfg.MaxMemory)))
+	}
+
+	if cfg.MaxCPUPercent > 0 {
+		if usage.CPUPercent <= cfg.MaxCPUPercent {
+			state.cpuOverSince = time.Time{}
+		} else {
+			if state.cpuOverSince.IsZero() {
+				state.cpuOverSince = now
+				pm.log("warning", fmt.Sprintf("Process %s uses %.1f%% CPU, above max_cpu_percent %.1f%%",
+					name, usage.CPUPercent, cfg.MaxCPUPercent), name)
+			}
+			window := time.Duration(cfg.MaxCPUWindow) * time.Second
+			if violation == nil && now.Sub(state.cpuOverSince) >= window {
+				violation = fmt.Errorf("CPU usage %.1f%% above max_cpu_percent %.1f%% for %s",
+					usage.CPUPercent, cfg.MaxCPUPercent, window)
+			}
+		}
+	}
+
+	if violation == nil {
+		return
+	}
+
+	state.cpuOverSince = time.Time{}
+	pm.log("error", fmt.Sprintf("Process %s exceeded its resource limit: %v", name, violation), name)
+	pm.saveCrashRecord(name, state, state.StartTime, now, violation, storage.CrashReasonLimit)
+	go pm.restartRunning(name, state, state.Cmd, "limit: "+violation.Error())
+}
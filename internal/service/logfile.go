@@ -0,0 +1,214 @@
+package service
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// LogFile is a size-rotated log file for process output. When a write would
+// grow the file past maxBytes the file is renamed to path.1 (older backups
+// shift to path.2 ... path.N) and a fresh file is opened.
+type LogFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	backups  int
+	compress bool
+	file     *os.File
+	size     int64
+	// closed is set by Close; output still draining from an exited process
+	// is dropped instead of opening the file again
+	closed bool
+}
+
+// OpenLogFile opens (or creates) path for appending. A maxBytes <= 0 disables
+// rotation; backups <= 0 discards the old file on rotation.
+func OpenLogFile(path string, maxBytes int64, backups int, compress bool) (*LogFile, error) {
+	lf := &LogFile{
+		path:     path,
+		maxBytes: maxBytes,
+		backups:  backups,
+		compress: compress,
+	}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *LogFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(lf.path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(lf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	lf.file = f
+	lf.size = info.Size()
+	return nil
+}
+
+func (lf *LogFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.closed {
+		return 0, os.ErrClosed
+	}
+	if lf.file == nil {
+		if err := lf.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if lf.maxBytes > 0 && lf.size > 0 && lf.size+int64(len(p)) > lf.maxBytes {
+		if err := lf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := lf.file.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// WriteLine writes line followed by a newline.
+func (lf *LogFile) WriteLine(line string) error {
+	_, err := lf.Write([]byte(line + "\n"))
+	return err
+}
+
+// Reopen closes and reopens the file, picking up a file moved away by an
+// external tool such as logrotate.
+func (lf *LogFile) Reopen() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.closed {
+		return nil
+	}
+	if lf.file != nil {
+		lf.file.Close()
+		lf.file = nil
+	}
+	return lf.open()
+}
+
+// SetRotation changes the rotation settings; they apply from the next write.
+func (lf *LogFile) SetRotation(maxBytes int64, backups int, compress bool) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	lf.maxBytes = maxBytes
+	lf.backups = backups
+	lf.compress = compress
+}
+
+// Close closes the file for good; later writes fail with os.ErrClosed.
+func (lf *LogFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	lf.closed = true
+	if lf.file == nil {
+		return nil
+	}
+	err := lf.file.Close()
+	lf.file = nil
+	return err
+}
+
+func (lf *LogFile) Path() string {
+	return lf.path
+}
+
+// rotate shifts backups and starts a new file. Caller must hold lf.mu.
+func (lf *LogFile) rotate() error {
+	if err := lf.file.Close(); err != nil {
+		return err
+	}
+	lf.file = nil
+
+	if lf.backups <= 0 {
+		if err := os.Remove(lf.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return lf.open()
+	}
+
+	ext := ""
+	if lf.compress {
+		ext = ".gz"
+	}
+
+	// Drop the oldest backup and shift the rest up by one
+	_ = os.Remove(lf.backupName(lf.backups) + ext)
+	for i := lf.backups - 1; i >= 1; i-- {
+		src := lf.backupName(i) + ext
+		if _, err := os.Stat(src); err == nil {
+			if err := os.Rename(src, lf.backupName(i+1)+ext); err != nil {
+				return err
+			}
+		}
+	}
+
+	first := lf.backupName(1)
+	if err := os.Rename(lf.path, first); err != nil {
+		return err
+	}
+
+	if lf.compress {
+		if err := gzipFile(first); err != nil {
+			return fmt.Errorf("compress %s: %w", first, err)
+		}
+	}
+
+	return lf.open()
+}
+
+func (lf *LogFile) backupName(n int) string {
+	return fmt.Sprintf("%s.%d", lf.path, n)
+}
+
+// gzipFile replaces path with path.gz.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrBadArguments is returned for invalid log offsets or lengths.
+var ErrBadArguments = errors.New("bad arguments")
+
+// logSource is a process output log addressed by byte offset. Only the bytes
+// from start to size are still available.
+type logSource interface {
+	io.ReaderAt
+	start() int64
+	size() int64
+}
+
+type fileLog struct {
+	*os.File
+	length int64
+}
+
+func (f fileLog) start() int64 { return 0 }
+func (f fileLog) size() int64  { return f.length }
+
+// memoryLog is the tail of a stream kept in the output backlog.
+type memoryLog struct {
+	data []byte
+	end  int64
+}
+
+func (m memoryLog) start() int64 { return m.end - int64(len(m.data)) }
+func (m memoryLog) size() int64  { return m.end }
+
+func (m memoryLog) ReadAt(p []byte, off int64) (int, error) {
+	off -= m.start()
+	if off < 0 || off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// openLog opens the stdout or stderr log of a process: its log file if one
+// is configured and exists, or else the output kept in memory.
+func (pm *ProcessManager) openLog(name, stream string) (logSource, func(), error) {
+	pm.mu.RLock()
+	state, ok := pm.processes[name]
+	var path string
+	if ok {
+		path = state.Config.Stdout
+		if stream == StreamStderr {
+			path = state.Config.Stderr
+		}
+	}
+	pm.mu.RUnlock()
+	if !ok {
+		return nil, nil, ErrProcessNotFound
+	}
+
+	if path != "" {
+		if f, err := os.Open(path); err == nil {
+			if info, err := f.Stat(); err == nil {
+				return fileLog{File: f, length: info.Size()}, func() { f.Close() }, nil
+			}
+			f.Close()
+		}
+	}
+
+	data, end := pm.output.Log(name, stream)
+	return memoryLog{data: data, end: end}, func() {}, nil
+}
+
+// readRange reads up to length bytes at offset, skipping the part of the
+// range that is no longer available.
+func readRange(src logSource, offset, length int64) []byte {
+	if offset < src.start() {
+		offset = src.start()
+	}
+	if remaining := src.size() - offset; length > remaining {
+		length = remaining
+	}
+	if length <= 0 {
+		return nil
+	}
+	buf := make([]byte, length)
+	n, _ := src.ReadAt(buf, offset)
+	return buf[:n]
+}
+
+// ReadLog reads from the stdout or stderr log of a process, like
+// supervisord's readProcessStdoutLog: a negative offset reads that many bytes
+// from the end and requires length 0; otherwise length 0 reads to the end.
+func (pm *ProcessManager) ReadLog(name, stream string, offset, length int64) (string, error) {
+	if length < 0 || (offset < 0 && length != 0) {
+		return "", ErrBadArguments
+	}
+
+	src, closeLog, err := pm.openLog(name, stream)
+	if err != nil {
+		return "", err
+	}
+	defer closeLog()
+
+	size := src.size()
+	switch {
+	case offset < 0:
+		length = -offset
+		offset = max(size+offset, 0)
+	case length == 0:
+		length = size - offset
+	}
+	return string(readRange(src, offset, length)), nil
+}
+
+// TailLog returns up to length bytes of the stdout or stderr log of a process
+// starting at offset, like supervisord's tailProcessStdoutLog. If more than
+// length bytes were written since offset, the last length bytes are returned
+// and overflow is set. The returned offset is the current end of the log, to
+// be passed to the next call.
+func (pm *ProcessManager) TailLog(name, stream string, offset, length int64) (data string, next int64, overflow bool, err error) {
+	if offset < 0 || length < 0 {
+		return "", 0, false, ErrBadArguments
+	}
+
+	src, closeLog, err := pm.openLog(name, stream)
+	if err != nil {
+		return "", 0, false, err
+	}
+	defer closeLog()
+
+	size := src.size()
+	if size > offset+length {
+		overflow = true
+		offset = size - length
+	}
+	return string(readRange(src, offset, length)), size, overflow, nil
+}
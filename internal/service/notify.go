@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"pupervisor/internal/notify"
+)
+
+var ErrNotificationsDisabled = errors.New("no notification channels configured")
+
+// notifyStderrLines is the number of stderr lines sent with a crash
+const notifyStderrLines = 20
+
+// UseNotifier sends crashes and state changes of processes to n.
+func (pm *ProcessManager) UseNotifier(n *notify.Notifier) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	n.Log = func(level, message string) {
+		pm.log(level, "Notifications: "+message, "")
+	}
+	pm.notifier = n
+}
+
+// notify reports an event of a process to the notifier, if there is one.
+// Caller must hold pm.mu.
+func (pm *ProcessManager) notify(event, name string, state *ProcessState, message string) {
+	if pm.notifier == nil {
+		return
+	}
+	pm.notifier.Notify(notify.Event{
+		Event:    event,
+		Process:  name,
+		Program:  state.Program,
+		Group:    state.Group,
+		Message:  message,
+		ExitCode: state.ExitCode,
+		Signal:   exitSignal(state),
+	})
+}
+
+// notifyCrash reports a crash with the last lines of stderr. Caller must
+// hold pm.mu.
+func (pm *ProcessManager) notifyCrash(name string, state *ProcessState, err error, reason string) {
+	if pm.notifier == nil {
+		return
+	}
+	message := fmt.Sprintf("exit code %d", state.ExitCode)
+	if err != nil {
+		message = err.Error()
+	}
+	var stderr string
+	if state.outputBuffer != nil {
+		stderr = strings.TrimRight(state.outputBuffer.GetLastStderr(notifyStderrLines), "\n")
+	}
+	pm.notifier.Notify(notify.Event{
+		Event:    notify.EventCrash,
+		Process:  name,
+		Program:  state.Program,
+		Group:    state.Group,
+		Message:  message,
+		Reason:   reason,
+		ExitCode: state.ExitCode,
+		Signal:   exitSignal(state),
+		Stderr:   stderr,
+	})
+}
+
+// TestNotification sends a test notification to the named channel, or to
+// all channels if channel is empty.
+func (pm *ProcessManager) TestNotification(channel string) ([]notify.TestResult, error) {
+	pm.mu.RLock()
+	n := pm.notifier
+	pm.mu.RUnlock()
+
+	if n == nil {
+		return nil, ErrNotificationsDisabled
+	}
+	return n.Test(channel)
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+)
+
+var ErrDependencyNotRunning = errors.New("dependency not running")
+
+// dependencyPollInterval is how often a waiting program re-checks its
+// dependencies.
+const dependencyPollInterval = 100 * time.Millisecond
+
+// programOrder returns program names in start order (see config.StartOrder).
+// Caller must hold pm.mu.
+func (pm *ProcessManager) programOrder() []string {
+	programs := make([]config.ProcessConfig, 0, len(pm.programs))
+	for _, procCfg := range pm.programs {
+		programs = append(programs, procCfg)
+	}
+
+	order, err := config.StartOrder(programs)
+	if err != nil {
+		// The configuration was validated on load; fall back to name order
+		order = make([]string, 0, len(programs))
+		for _, procCfg := range programs {
+			order = append(order, procCfg.Name)
+		}
+		sort.Strings(order)
+	}
+	return order
+}
+
+// startOrder returns process names in start order: programs by dependency
+// and priority, instances of a program by process number. Caller must hold
+// pm.mu.
+func (pm *ProcessManager) startOrder() []string {
+	var names []string
+	for _, program := range pm.programOrder() {
+		for _, state := range pm.instancesOf(program) {
+			names = append(names, state.Config.Name)
+		}
+	}
+	return names
+}
+
+// sortByStartOrder orders names by their position in the start order.
+// Caller must hold pm.mu.
+func (pm *ProcessManager) sortByStartOrder(names []string) {
+	position := make(map[string]int)
+	for i, name := range pm.startOrder() {
+		position[name] = i
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return position[names[i]] < position[names[j]]
+	})
+}
+
+// dependenciesReady reports whether every instance of every dependency of
+// program is RUNNING and passes its health check, if any, or for oneshot
+// dependencies has SUCCEEDED. It fails when a dependency reached a state it
+// will not leave on its own.
+func (pm *ProcessManager) dependenciesReady(program string) (bool, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	procCfg, ok := pm.programs[program]
+	if !ok {
+		return false, ErrProgramNotFound
+	}
+
+	ready := true
+	for _, dep := range procCfg.DependsOn {
+		for _, state := range pm.instancesOf(dep) {
+			switch state.Status {
+			case models.StateRunning:
+				// A oneshot dependency has to complete first
+				if state.Config.Type == config.TypeOneshot || !healthReady(state) {
+					ready = false
+				}
+			case models.StateSucceeded:
+			case models.StateStopped, models.StateExited, models.StateFatal:
+				return false, fmt.Errorf("%w: %s is %s", ErrDependencyNotRunning, state.Config.Name, state.Status)
+			default:
+				ready = false
+			}
+		}
+	}
+	return ready, nil
+}
+
+// waitForDependencies blocks until all dependencies of program are running.
+func (pm *ProcessManager) waitForDependencies(ctx context.Context, program string) error {
+	ready, err := pm.dependenciesReady(program)
+	if err != nil || ready {
+		return err
+	}
+
+	pm.log("info", fmt.Sprintf("Program %s waiting for dependencies", program), "")
+
+	ticker := time.NewTicker(dependencyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			ready, err := pm.dependenciesReady(program)
+			if err != nil || ready {
+				return err
+			}
+		}
+	}
+}
@@ -5,17 +5,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"os/exec"
-	"runtime"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"pupervisor/internal/config"
+	"pupervisor/internal/cron"
 	"pupervisor/internal/models"
+	"pupervisor/internal/notify"
 	"pupervisor/internal/storage"
 )
 
@@ -23,17 +26,40 @@ var (
 	ErrProcessNotFound       = errors.New("process not found")
 	ErrProcessAlreadyRunning = errors.New("process already running")
 	ErrProcessNotRunning     = errors.New("process not running")
+	ErrProgramNotFound       = errors.New("program not found")
+	ErrGroupNotFound         = errors.New("group not found")
 )
 
 type ProcessState struct {
-	Config       config.ProcessConfig
-	Cmd          *exec.Cmd
-	Status       string
-	Pid          int
-	StartTime    time.Time
-	ExitCode     int
-	cancel       context.CancelFunc
-	outputBuffer *OutputBuffer
+	Config         config.ProcessConfig
+	Program        string
+	Group          string
+	ProcessNum     int
+	Cmd            *exec.Cmd
+	Status         models.State
+	StateChangedAt time.Time
+	Pid            int
+	StartTime      time.Time
+	ExitCode       int
+	outputBuffer   *OutputBuffer
+	done           chan struct{}
+	retries        int
+	healthRestarts int
+	starts         int
+	usage          *models.ResourceUsage
+	usageAt        time.Time
+	cpuOverSince   time.Time
+	leftovers      []int
+	cgroup         string
+	oomKills       int
+	backoffTimer   *time.Timer
+	startTimer     *time.Timer
+	transitions    []models.StateTransition
+	health         models.Health
+	startReason    string
+	schedule       *cron.Schedule
+	nextRun        time.Time
+	runQueued      bool
 }
 
 type OutputBuffer struct {
@@ -81,6 +107,16 @@ func (ob *OutputBuffer) GetStderr() string {
 	return strings.Join(ob.stderr, "\n")
 }
 
+func (ob *OutputBuffer) GetLastStdout(n int) string {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	start := 0
+	if len(ob.stdout) > n {
+		start = len(ob.stdout) - n
+	}
+	return strings.Join(ob.stdout[start:], "\n")
+}
+
 func (ob *OutputBuffer) GetLastStderr(n int) string {
 	ob.mu.RLock()
 	defer ob.mu.RUnlock()
@@ -93,15 +129,28 @@ func (ob *OutputBuffer) GetLastStderr(n int) string {
 
 type ProcessManager struct {
 	mu        sync.RWMutex
+	programs  map[string]config.ProcessConfig
 	processes map[string]*ProcessState
+	logFiles  map[string]*LogFile
 	logs      *LogBuffer
+	output    *OutputHub
 	storage   *storage.Storage
+	cgroups   *Cgroups
+	notifier  *notify.Notifier
+
+	configPath string
+	reloadMu   sync.Mutex
+
+	// startCtx is cancelled by StopAll to abort pending dependency waits
+	startCtx     context.Context
+	cancelStarts context.CancelFunc
 }
 
 type LogBuffer struct {
 	mu         sync.RWMutex
 	entries    []models.LogEntry
 	maxEntries int
+	dropped    uint64
 }
 
 func NewLogBuffer(maxEntries int) *LogBuffer {
@@ -117,10 +166,18 @@ func (lb *LogBuffer) Add(entry models.LogEntry) {
 
 	lb.entries = append(lb.entries, entry)
 	if len(lb.entries) > lb.maxEntries {
+		lb.dropped += uint64(len(lb.entries) - lb.maxEntries)
 		lb.entries = lb.entries[len(lb.entries)-lb.maxEntries:]
 	}
 }
 
+// Dropped returns the number of entries evicted to make room for new ones.
+func (lb *LogBuffer) Dropped() uint64 {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+	return lb.dropped
+}
+
 func (lb *LogBuffer) GetLast(n int) []models.LogEntry {
 	lb.mu.RLock()
 	defer lb.mu.RUnlock()
@@ -164,21 +221,53 @@ func (lb *LogBuffer) GetByLevel(level string, n int) []models.LogEntry {
 
 func NewProcessManager(cfg *config.SupervisorConfig, store *storage.Storage) *ProcessManager {
 	pm := &ProcessManager{
+		programs:  make(map[string]config.ProcessConfig),
 		processes: make(map[string]*ProcessState),
+		logFiles:  make(map[string]*LogFile),
 		logs:      NewLogBuffer(1000),
+		output:    NewOutputHub(),
 		storage:   store,
+
+		configPath: cfg.Path,
 	}
+	pm.startCtx, pm.cancelStarts = context.WithCancel(context.Background())
 
 	for _, procCfg := range cfg.Processes {
-		pm.processes[procCfg.Name] = &ProcessState{
-			Config: procCfg,
-			Status: "stopped",
+		pm.programs[procCfg.Name] = procCfg
+		for _, num := range procCfg.ProcessNums() {
+			pm.addInstance(procCfg, num)
 		}
 	}
 
 	return pm
 }
 
+// addInstance registers a stopped instance of a program. Caller must hold pm.mu
+// or be the constructor.
+func (pm *ProcessManager) addInstance(procCfg config.ProcessConfig, num int) *ProcessState {
+	inst := procCfg.Instance(num)
+	state := &ProcessState{
+		Config:         inst,
+		Program:        procCfg.Name,
+		Group:          procCfg.Group,
+		ProcessNum:     num,
+		Status:         models.StateStopped,
+		StateChangedAt: time.Now(),
+	}
+	if inst.HealthCheck != nil {
+		state.health = models.Health{Status: models.HealthUnknown, Type: inst.HealthCheck.Type}
+	}
+	if inst.Schedule != nil {
+		// The schedule was validated when the configuration was loaded
+		if schedule, err := inst.Schedule.Parse(); err == nil {
+			state.schedule = schedule
+			state.nextRun = schedule.Next(time.Now())
+		}
+	}
+	pm.processes[inst.Name] = state
+	return state
+}
+
 func (pm *ProcessManager) GetStorage() *storage.Storage {
 	return pm.storage
 }
@@ -194,6 +283,10 @@ func (pm *ProcessManager) log(level, message string, processName string) {
 }
 
 func (pm *ProcessManager) StartProcess(name string) error {
+	return pm.startProcess(name, "started manually")
+}
+
+func (pm *ProcessManager) startProcess(name, reason string) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -202,25 +295,28 @@ func (pm *ProcessManager) StartProcess(name string) error {
 		return ErrProcessNotFound
 	}
 
-	if state.Status == "running" {
+	if state.Status.IsActive() {
 		return ErrProcessAlreadyRunning
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	state.cancel = cancel
+	// A manual start cancels any pending retry and resets FATAL
+	state.cancelBackoff()
+	state.retries = 0
+	state.healthRestarts = 0
 
-	cmd := exec.CommandContext(ctx, state.Config.Command, state.Config.Args...)
+	return pm.spawn(name, state, reason)
+}
 
-	if state.Config.Directory != "" {
-		cmd.Dir = state.Config.Directory
+// spawn launches the process described by state and moves it to STARTING.
+// Caller must hold pm.mu.
+func (pm *ProcessManager) spawn(name string, state *ProcessState, reason string) error {
+	if !canTransition(state.Status, models.StateStarting) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, state.Status, models.StateStarting)
 	}
 
-	if len(state.Config.Environment) > 0 {
-		cmd.Env = os.Environ()
-		for k, v := range state.Config.Environment {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-		}
-	}
+	cmd := exec.Command(state.Config.Command, state.Config.Args...)
+	setProcessGroup(cmd)
+	setCommandEnv(cmd, state.Config)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -228,101 +324,402 @@ func (pm *ProcessManager) StartProcess(name string) error {
 		return err
 	}
 
-	stderr, err := cmd.StderrPipe()
+	var stderr io.ReadCloser
+	if state.Config.RedirectStderr {
+		cmd.Stderr = cmd.Stdout
+	} else {
+		stderr, err = cmd.StderrPipe()
+		if err != nil {
+			pm.log("error", fmt.Sprintf("Failed to create stderr pipe for %s: %v", name, err), name)
+			return err
+		}
+	}
+
+	cgroup, release, err := pm.placeInCgroup(cmd, name, state)
 	if err != nil {
-		pm.log("error", fmt.Sprintf("Failed to create stderr pipe for %s: %v", name, err), name)
+		pm.log("error", fmt.Sprintf("Failed to start process %s: %v", name, err), name)
 		return err
 	}
-
-	if err := cmd.Start(); err != nil {
+	err = startCommand(cmd, state.Config)
+	release()
+	if err != nil {
+		if cgroup != "" {
+			removeCgroup(cgroup)
+		}
 		pm.log("error", fmt.Sprintf("Failed to start process %s: %v", name, err), name)
 		return err
 	}
 
+	output := NewOutputBuffer(500) // Keep last 500 lines
+	stdoutLog, stderrLog := pm.logFilesFor(name, state.Config)
+
+	pm.transition(name, state, models.StateStarting, reason)
 	state.Cmd = cmd
-	state.Status = "running"
 	state.Pid = cmd.Process.Pid
 	state.StartTime = time.Now()
 	state.ExitCode = 0
-	state.outputBuffer = NewOutputBuffer(500) // Keep last 500 lines
+	state.startReason = reason
+	state.starts++
+	state.usage = nil
+	state.cpuOverSince = time.Time{}
+	state.leftovers = nil
+	state.cgroup = cgroup
+	state.oomKills = 0
+	if cgroup != "" {
+		state.oomKills = cgroupOOMKills(cgroup)
+	}
+	state.done = make(chan struct{})
+	state.outputBuffer = output
+	if hc := state.Config.HealthCheck; hc != nil {
+		state.health = models.Health{Status: models.HealthUnknown, Type: hc.Type}
+	}
 
 	pm.log("info", fmt.Sprintf("Process %s started with PID %d", name, state.Pid), name)
 
+	// The process only counts as RUNNING once it survived startsecs; with
+	// startsecs: 0 it does right away
+	if secs := *state.Config.StartSecs; secs > 0 {
+		state.startTimer = time.AfterFunc(time.Duration(secs)*time.Second, func() {
+			pm.markRunning(name, state, cmd)
+		})
+	} else {
+		pm.running(name, state, cmd)
+	}
+
 	// Read stdout in goroutine
 	go func() {
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
 			line := scanner.Text()
-			state.outputBuffer.AddStdout(line)
+			output.AddStdout(line)
+			if stdoutLog != nil {
+				_ = stdoutLog.WriteLine(line)
+			}
+			pm.output.Publish(name, StreamStdout, line)
 			pm.log("info", fmt.Sprintf("[%s] %s", name, line), name)
 		}
 	}()
 
 	// Read stderr in goroutine
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text()
-			state.outputBuffer.AddStderr(line)
-			pm.log("error", fmt.Sprintf("[%s] %s", name, line), name)
-		}
-	}()
+	if stderr != nil {
+		go func() {
+			scanner := bufio.NewScanner(stderr)
+			for scanner.Scan() {
+				line := scanner.Text()
+				output.AddStderr(line)
+				if stderrLog != nil {
+					_ = stderrLog.WriteLine(line)
+				}
+				pm.output.Publish(name, StreamStderr, line)
+				pm.log("error", fmt.Sprintf("[%s] %s", name, line), name)
+			}
+		}()
+	}
 
 	// Monitor process in goroutine
-	go pm.monitorProcess(name, state)
+	go pm.monitorProcess(name, state, cmd, state.done)
 
 	return nil
 }
 
-func (pm *ProcessManager) monitorProcess(name string, state *ProcessState) {
-	if state.Cmd == nil {
+// setCommandEnv sets the working directory and environment of a program on
+// cmd, for the program itself and for commands run on its behalf.
+func setCommandEnv(cmd *exec.Cmd, cfg config.ProcessConfig) {
+	if cfg.Directory != "" {
+		cmd.Dir = cfg.Directory
+	}
+
+	if len(cfg.Environment) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range cfg.Environment {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+}
+
+// logFilesFor returns the output log files configured for a process, opening
+// them on first use. Instances sharing a path share one LogFile so rotation
+// stays consistent; the rotation settings of the last started process win.
+// Caller must hold pm.mu.
+func (pm *ProcessManager) logFilesFor(name string, cfg config.ProcessConfig) (stdout, stderr *LogFile) {
+	if cfg.Stdout != "" {
+		stdout = pm.openLogFile(name, cfg.Stdout, int64(*cfg.StdoutMaxBytes), *cfg.StdoutBackups, cfg.LogCompress)
+	}
+	if cfg.Stderr != "" {
+		stderr = pm.openLogFile(name, cfg.Stderr, int64(*cfg.StderrMaxBytes), *cfg.StderrBackups, cfg.LogCompress)
+	}
+	return stdout, stderr
+}
+
+func (pm *ProcessManager) openLogFile(name, path string, maxBytes int64, backups int, compress bool) *LogFile {
+	if lf, ok := pm.logFiles[path]; ok {
+		lf.SetRotation(maxBytes, backups, compress)
+		return lf
+	}
+
+	lf, err := OpenLogFile(path, maxBytes, backups, compress)
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Failed to open log file %s for %s: %v", path, name, err), name)
+		return nil
+	}
+
+	pm.logFiles[path] = lf
+	return lf
+}
+
+// ReopenLogs reopens all process log files, e.g. after logrotate moved them.
+func (pm *ProcessManager) ReopenLogs() {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for path, lf := range pm.logFiles {
+		if err := lf.Reopen(); err != nil {
+			pm.log("error", fmt.Sprintf("Failed to reopen log file %s: %v", path, err), "")
+		}
+	}
+	pm.log("info", fmt.Sprintf("Reopened %d log file(s)", len(pm.logFiles)), "")
+}
+
+// closeUnusedLogFiles closes the log files no process is configured to
+// write to anymore, e.g. after its program was removed. Caller must hold
+// pm.mu.
+func (pm *ProcessManager) closeUnusedLogFiles() {
+	used := make(map[string]bool)
+	for _, state := range pm.processes {
+		used[state.Config.Stdout] = true
+		used[state.Config.Stderr] = true
+	}
+	for path, lf := range pm.logFiles {
+		if used[path] {
+			continue
+		}
+		if err := lf.Close(); err != nil {
+			pm.log("error", fmt.Sprintf("Failed to close log file %s: %v", path, err), "")
+		}
+		delete(pm.logFiles, path)
+	}
+}
+
+// CloseLogFiles closes all process log files. Processes should be stopped
+// first; output they still write is dropped.
+func (pm *ProcessManager) CloseLogFiles() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for path, lf := range pm.logFiles {
+		if err := lf.Close(); err != nil {
+			pm.log("error", fmt.Sprintf("Failed to close log file %s: %v", path, err), "")
+		}
+		delete(pm.logFiles, path)
+	}
+}
+
+func (pm *ProcessManager) markRunning(name string, state *ProcessState, cmd *exec.Cmd) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if state.Cmd != cmd || state.Status != models.StateStarting {
 		return
 	}
+	pm.running(name, state, cmd)
+}
+
+// running moves a started process to RUNNING. Caller must hold pm.mu.
+func (pm *ProcessManager) running(name string, state *ProcessState, cmd *exec.Cmd) {
+	state.startTimer = nil
+
+	reason := fmt.Sprintf("process stayed up for %ds", *state.Config.StartSecs)
+	if pm.transition(name, state, models.StateRunning, reason) {
+		// A oneshot job only starts over once it succeeds
+		if state.Config.Type != config.TypeOneshot {
+			state.retries = 0
+		}
+		pm.log("info", fmt.Sprintf("Process %s is running (%s)", name, reason), name)
+
+		if hc := state.Config.HealthCheck; hc != nil {
+			go pm.runHealthChecks(name, state, cmd, state.Config, state.done)
+		}
+	}
+}
 
+func (pm *ProcessManager) monitorProcess(name string, state *ProcessState, cmd *exec.Cmd, done chan struct{}) {
 	startTime := state.StartTime
-	err := state.Cmd.Wait()
+	err := cmd.Wait()
 	crashTime := time.Now()
 
 	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	defer close(done)
+
+	if state.startTimer != nil {
+		state.startTimer.Stop()
+		state.startTimer = nil
+	}
 
 	exitCode := 0
-	if state.Cmd.ProcessState != nil {
-		exitCode = state.Cmd.ProcessState.ExitCode()
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
 	}
 	state.ExitCode = exitCode
+	state.Pid = 0
+	if state.Config.HealthCheck != nil {
+		state.health.Status = models.HealthUnknown
+	}
 
-	// Save crash info if process exited abnormally
-	if err != nil || exitCode != 0 {
-		pm.saveCrashRecord(name, state, startTime, crashTime, err)
+	// Any OOM kill in the cgroup not seen while running most likely hit the
+	// process itself
+	oomKilled := false
+	if state.cgroup != "" {
+		oomKilled = cgroupOOMKills(state.cgroup) > state.oomKills
+		removeCgroup(state.cgroup)
+		state.cgroup = ""
 	}
 
-	state.Status = "stopped"
-	state.Pid = 0
+	// An exit is expected if the process exited on its own with a code
+	// listed in exitcodes
+	expected := cmd.ProcessState != nil && !oomKilled && exitSignal(state) == "" &&
+		state.Config.ExpectedExit(exitCode)
 
-	if err != nil {
-		pm.log("warning", fmt.Sprintf("Process %s exited with error: %v", name, err), name)
+	exitReason := "exited normally"
+	switch {
+	case err != nil:
+		exitReason = err.Error()
+	case !expected:
+		exitReason = "unexpected exit status 0"
+	}
+
+	if state.schedule != nil {
+		pm.saveJobRun(name, state, startTime, crashTime, state.Status == models.StateStopping, expected)
+	}
+
+	if state.Status == models.StateStopping {
+		// Stopping a process also drops a queued scheduled run
+		state.runQueued = false
+		pm.transition(name, state, models.StateStopped, exitReason)
+		pm.log("info", fmt.Sprintf("Process %s stopped", name), name)
+		return
+	}
+
+	// A scheduled run queued while this one was going starts now
+	defer pm.startQueuedRun(name, state)
+
+	// Save crash info if process exited abnormally
+	reason := storage.CrashReasonExit
+	if oomKilled {
+		reason = storage.CrashReasonOOM
+		pm.log("error", fmt.Sprintf("Process %s was killed by the OOM killer", name), name)
+	}
+	if !expected {
+		pm.saveCrashRecord(name, state, startTime, crashTime, err, reason)
+	}
+
+	if expected {
+		pm.log("info", fmt.Sprintf("Process %s exited normally (%s)", name, exitReason), name)
 	} else {
-		pm.log("info", fmt.Sprintf("Process %s exited normally", name), name)
+		pm.log("warning", fmt.Sprintf("Process %s exited unexpectedly: %s", name, exitReason), name)
 	}
 
-	// Auto-restart if configured
-	if state.Config.AutoRestart && state.cancel != nil {
-		select {
-		case <-time.After(time.Duration(state.Config.StartSecs) * time.Second):
-			pm.mu.Unlock()
-			pm.log("info", fmt.Sprintf("Auto-restarting process %s", name), name)
-			if err := pm.StartProcess(name); err != nil {
-				pm.log("error", fmt.Sprintf("Failed to auto-restart process %s: %v", name, err), name)
-			}
-			pm.mu.Lock()
-		default:
+	// A oneshot program is done once it completes, however quickly
+	if expected && state.Config.Type == config.TypeOneshot {
+		state.retries = 0
+		pm.transition(name, state, models.StateSucceeded, exitReason)
+		return
+	}
+
+	wasStarting := state.Status == models.StateStarting
+	restart := state.Config.AutoRestart.Restarts(expected) && pm.processes[name] == state
+
+	// Exiting before startsecs elapsed counts as a failed start attempt and
+	// goes straight to BACKOFF; a process that reached RUNNING exits first
+	// and starts over with a clean slate.
+	if wasStarting && restart {
+		state.retries++
+		pm.scheduleRestart(name, state, "exited before startsecs: "+exitReason)
+		return
+	}
+
+	pm.transition(name, state, models.StateExited, exitReason)
+	if restart {
+		// Every failed run of a oneshot job counts as an attempt
+		if state.Config.Type == config.TypeOneshot {
+			state.retries++
+		} else {
+			state.retries = 0
 		}
+		pm.scheduleRestart(name, state, "autorestart")
 	}
+}
 
-	pm.mu.Unlock()
+// scheduleRestart puts the process into BACKOFF and arms a timer for the next
+// start attempt, or marks it FATAL once startretries is exhausted.
+// Caller must hold pm.mu.
+func (pm *ProcessManager) scheduleRestart(name string, state *ProcessState, reason string) {
+	if state.retries > *state.Config.StartRetries {
+		pm.transition(name, state, models.StateFatal, fmt.Sprintf("%d failed start attempts", state.retries))
+		pm.log("error", fmt.Sprintf("Process %s entered FATAL state after %d failed start attempts", name, state.retries), name)
+		return
+	}
+
+	if !pm.transition(name, state, models.StateBackoff, reason) {
+		return
+	}
+
+	delay := backoffDelay(state.Config, state.retries)
+	state.backoffTimer = time.AfterFunc(delay, func() {
+		pm.retryStart(name, state)
+	})
+
+	pm.log("info", fmt.Sprintf("Process %s will be restarted in %s (attempt %d/%d)",
+		name, delay.Round(time.Millisecond), state.retries, *state.Config.StartRetries), name)
 }
 
-func (pm *ProcessManager) saveCrashRecord(name string, state *ProcessState, startTime, crashTime time.Time, err error) {
+func (pm *ProcessManager) retryStart(name string, state *ProcessState) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	// The process may have been stopped, started manually or removed meanwhile
+	if pm.processes[name] != state || state.Status != models.StateBackoff {
+		return
+	}
+	state.backoffTimer = nil
+
+	pm.log("info", fmt.Sprintf("Auto-restarting process %s", name), name)
+	if err := pm.spawn(name, state, "autorestart"); err != nil {
+		state.retries++
+		pm.scheduleRestart(name, state, "spawn error: "+err.Error())
+	}
+}
+
+// backoffDelay returns the wait before start attempt number retries:
+// backoff_initial doubled per failed attempt, capped at backoff_max, with
+// +/-20% jitter so that sibling instances do not restart in lockstep.
+func backoffDelay(cfg config.ProcessConfig, retries int) time.Duration {
+	initial := time.Duration(cfg.BackoffInitial) * time.Second
+	max := time.Duration(cfg.BackoffMax) * time.Second
+
+	delay := initial
+	for i := 0; i < retries && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	jitter := (rand.Float64()*0.4 - 0.2) * float64(delay)
+	return delay + time.Duration(jitter)
+}
+
+func (state *ProcessState) cancelBackoff() {
+	if state.backoffTimer != nil {
+		state.backoffTimer.Stop()
+		state.backoffTimer = nil
+	}
+}
+
+// saveCrashRecord stores a crash history entry. reason tells why the run
+// ended, e.g. storage.CrashReasonExit or storage.CrashReasonUnhealthy.
+func (pm *ProcessManager) saveCrashRecord(name string, state *ProcessState, startTime, crashTime time.Time, err error, reason string) {
+	pm.notifyCrash(name, state, err, reason)
 	if pm.storage == nil {
 		return
 	}
@@ -338,26 +735,17 @@ func (pm *ProcessManager) saveCrashRecord(name string, state *ProcessState, star
 		stderr = state.outputBuffer.GetLastStderr(50) // Last 50 lines of stderr
 	}
 
-	// Extract signal if killed by signal
-	signal := ""
-	if state.Cmd != nil && state.Cmd.ProcessState != nil {
-		if ws, ok := state.Cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
-			if ws.Signaled() {
-				signal = ws.Signal().String()
-			}
-		}
-	}
-
 	crash := &storage.CrashRecord{
 		ProcessName: name,
 		ExitCode:    state.ExitCode,
-		Signal:      signal,
+		Signal:      exitSignal(state),
 		ErrorMsg:    errMsg,
 		Stdout:      stdout,
 		Stderr:      stderr,
 		StartedAt:   startTime,
 		CrashedAt:   crashTime,
 		Uptime:      formatDuration(crashTime.Sub(startTime)),
+		Reason:      reason,
 	}
 
 	if saveErr := pm.storage.SaveCrash(crash); saveErr != nil {
@@ -365,23 +753,49 @@ func (pm *ProcessManager) saveCrashRecord(name string, state *ProcessState, star
 	}
 }
 
+// exitSignal returns the signal that killed the last run of a process, or ""
+// if it exited on its own.
+func exitSignal(state *ProcessState) string {
+	if state.Cmd != nil && state.Cmd.ProcessState != nil {
+		if ws, ok := state.Cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+			if ws.Signaled() {
+				return ws.Signal().String()
+			}
+		}
+	}
+	return ""
+}
+
 func (pm *ProcessManager) StopProcess(name string) error {
 	pm.mu.Lock()
-	defer pm.mu.Unlock()
 
 	state, ok := pm.processes[name]
 	if !ok {
+		pm.mu.Unlock()
 		return ErrProcessNotFound
 	}
 
-	if state.Status != "running" || state.Cmd == nil || state.Cmd.Process == nil {
-		return ErrProcessNotRunning
+	// Stopping a process waiting in BACKOFF just cancels the pending restart
+	if state.Status == models.StateBackoff {
+		state.cancelBackoff()
+		state.retries = 0
+		pm.transition(name, state, models.StateStopped, "stopped while in backoff")
+		pm.mu.Unlock()
+		pm.log("info", fmt.Sprintf("Cancelled pending restart of process %s", name), name)
+		return nil
 	}
 
-	// Cancel context to stop auto-restart
-	if state.cancel != nil {
-		state.cancel()
-		state.cancel = nil
+	// Another caller is already stopping it; just wait for the exit
+	if state.Status == models.StateStopping {
+		done := state.done
+		pm.mu.Unlock()
+		<-done
+		return nil
+	}
+
+	if !state.Status.IsActive() || state.Cmd == nil || state.Cmd.Process == nil {
+		pm.mu.Unlock()
+		return ErrProcessNotRunning
 	}
 
 	// Send signal
@@ -395,38 +809,52 @@ func (pm *ProcessManager) StopProcess(name string) error {
 		sig = syscall.SIGTERM
 	}
 
-	pm.log("info", fmt.Sprintf("Sending %s to process %s (PID %d)", state.Config.StopSignal, name, state.Pid), name)
+	// STOPPING also prevents auto-restart once the process exits
+	pm.transition(name, state, models.StateStopping, "stop requested")
+	target := "process"
+	if state.Config.StopAsGroup {
+		target = "process group of"
+	}
+	pm.log("info", fmt.Sprintf("Sending %s to %s %s (PID %d)", state.Config.StopSignal, target, name, state.Pid), name)
+
+	process := state.Cmd.Process
+	pid := state.Pid
+	cfg := state.Config
+	cgroup := state.cgroup
+	done := state.done
+	timeout := time.Duration(cfg.StopTimeout) * time.Second
+	pm.mu.Unlock()
+
+	// Children are reparented once the process exits, so find them now.
+	// The cgroup also knows the ones that left the tree.
+	tree := descendants(pid, processChildren())
+	if cgroup != "" {
+		tree = append(tree, cgroupProcs(cgroup)...)
+	}
 
-	if err := state.Cmd.Process.Signal(sig); err != nil {
+	if err := signalProcess(process, sig, cfg.StopAsGroup); err != nil {
 		pm.log("error", fmt.Sprintf("Failed to send signal to %s: %v", name, err), name)
 		return err
 	}
+	deadline := time.Now().Add(timeout)
 
-	// Wait for process to stop with timeout
-	done := make(chan struct{})
-	go func() {
-		_ = state.Cmd.Wait()
-		close(done)
-	}()
-
+	// Wait for the monitor goroutine to observe the exit
 	select {
 	case <-done:
-		pm.log("info", fmt.Sprintf("Process %s stopped", name), name)
-	case <-time.After(time.Duration(state.Config.StopTimeout) * time.Second):
+	case <-time.After(timeout):
 		pm.log("warning", fmt.Sprintf("Process %s did not stop in time, killing", name), name)
-		_ = state.Cmd.Process.Kill()
+		_ = signalProcess(process, syscall.SIGKILL, cfg.KillAsGroup)
+		<-done
 	}
 
-	state.Status = "stopped"
-	state.Pid = 0
-
+	pm.checkLeftovers(name, state, cfg, pid, tree, deadline)
 	return nil
 }
 
 func (pm *ProcessManager) RestartProcess(name string) error {
 	pm.mu.RLock()
 	state, ok := pm.processes[name]
-	isRunning := ok && state.Status == "running"
+	isRunning := ok && state.Status.IsActive()
 	pm.mu.RUnlock()
 
 	if !ok {
@@ -443,40 +871,44 @@ func (pm *ProcessManager) RestartProcess(name string) error {
 	return pm.StartProcess(name)
 }
 
+// restartRunning restarts a process on the supervisor's own initiative, e.g.
+// after a failed health check. Nothing happens if the run identified by cmd
+// was already stopped, restarted or removed.
+func (pm *ProcessManager) restartRunning(name string, state *ProcessState, cmd *exec.Cmd, reason string) {
+	pm.mu.RLock()
+	current := pm.processes[name] == state && state.Cmd == cmd && state.Status == models.StateRunning
+	pm.mu.RUnlock()
+	if !current {
+		return
+	}
+
+	pm.log("warning", fmt.Sprintf("Restarting process %s (%s)", name, reason), name)
+	if err := pm.StopProcess(name); err != nil && !errors.Is(err, ErrProcessNotRunning) {
+		pm.log("error", fmt.Sprintf("Failed to stop %s: %v", name, err), name)
+		return
+	}
+	if err := pm.startProcess(name, reason); err != nil && !errors.Is(err, ErrProcessAlreadyRunning) {
+		pm.log("error", fmt.Sprintf("Failed to start %s: %v", name, err), name)
+	}
+}
+
 func (pm *ProcessManager) GetProcesses() []models.Process {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
 
 	result := make([]models.Process, 0, len(pm.processes))
 	for name, state := range pm.processes {
-		uptime := "N/A"
-		if state.Status == "running" && !state.StartTime.IsZero() {
-			uptime = formatDuration(time.Since(state.StartTime))
-		}
-
-		memory := "N/A"
-		cpu := "N/A"
-		if state.Status == "running" && state.Pid > 0 {
-			memory = getProcessMemory(state.Pid)
-			cpu = getProcessCPU(state.Pid)
-		}
-
-		result = append(result, models.Process{
-			Name:      name,
-			Status:    state.Status,
-			Pid:       state.Pid,
-			Uptime:    uptime,
-			Memory:    memory,
-			CPU:       cpu,
-			Command:   state.Config.Command,
-			Args:      state.Config.Args,
-			Directory: state.Config.Directory,
-		})
+		result = append(result, processInfo(name, state))
 	}
 
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
 	return result
 }
 
+// GetProcess returns a single process including its recent state transitions.
 func (pm *ProcessManager) GetProcess(name string) (models.Process, bool) {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
@@ -486,29 +918,88 @@ func (pm *ProcessManager) GetProcess(name string) (models.Process, bool) {
 		return models.Process{}, false
 	}
 
+	info := processInfo(name, state)
+	info.Transitions = make([]models.StateTransition, len(state.transitions))
+	copy(info.Transitions, state.transitions)
+
+	return info, true
+}
+
+// processInfo builds the API view of a process. Caller must hold pm.mu.
+func processInfo(name string, state *ProcessState) models.Process {
 	uptime := "N/A"
-	if state.Status == "running" && !state.StartTime.IsZero() {
+	if state.Status.IsActive() && !state.StartTime.IsZero() {
 		uptime = formatDuration(time.Since(state.StartTime))
 	}
 
 	memory := "N/A"
 	cpu := "N/A"
-	if state.Status == "running" && state.Pid > 0 {
-		memory = getProcessMemory(state.Pid)
-		cpu = getProcessCPU(state.Pid)
+	var resources *models.ResourceUsage
+	if state.Status.IsActive() && state.usage != nil {
+		usage := *state.usage
+		resources = &usage
+		memory = formatBytes(int64(usage.RSSBytes))
+		cpu = fmt.Sprintf("%.1f%%", usage.CPUPercent)
+	}
+
+	var rlimits, cgroupLimits map[string]string
+	if state.Config.Rlimits != nil {
+		rlimits = state.Config.Rlimits.Map()
+	}
+	if state.Config.Cgroup != nil {
+		cgroupLimits = state.Config.Cgroup.Map()
+	}
+
+	var startedAt string
+	if !state.StartTime.IsZero() {
+		startedAt = state.StartTime.Format(time.RFC3339)
+	}
+
+	var health *models.Health
+	if state.Config.HealthCheck != nil {
+		h := state.health
+		health = &h
+	}
+
+	var schedule, nextRun string
+	if state.schedule != nil {
+		schedule = state.schedule.String()
+		if !state.nextRun.IsZero() {
+			nextRun = state.nextRun.Format(time.RFC3339)
+		}
 	}
 
 	return models.Process{
-		Name:      name,
-		Status:    state.Status,
-		Pid:       state.Pid,
-		Uptime:    uptime,
-		Memory:    memory,
-		CPU:       cpu,
-		Command:   state.Config.Command,
-		Args:      state.Config.Args,
-		Directory: state.Config.Directory,
-	}, true
+		Name:           name,
+		Program:        state.Program,
+		Group:          state.Group,
+		ProcessNum:     state.ProcessNum,
+		Type:           state.Config.Type,
+		Status:         state.Status,
+		StateChangedAt: state.StateChangedAt.Format(time.RFC3339),
+		StartedAt:      startedAt,
+		Pid:            state.Pid,
+		ExitCode:       state.ExitCode,
+		Uptime:         uptime,
+		Memory:         memory,
+		CPU:            cpu,
+		Command:        state.Config.Command,
+		Args:           state.Config.Args,
+		Directory:      state.Config.Directory,
+		User:           state.Config.User,
+		Umask:          state.Config.Umask,
+		Rlimits:        rlimits,
+		Cgroup:         state.cgroup,
+		CgroupLimits:   cgroupLimits,
+		AutoStart:      state.Config.AutoStart,
+		Priority:       state.Config.Priority,
+		DependsOn:      state.Config.DependsOn,
+		Schedule:       schedule,
+		NextRun:        nextRun,
+		Health:         health,
+		Resources:      resources,
+		LeftoverPIDs:   state.leftovers,
+	}
 }
 
 func (pm *ProcessManager) GetLogs(limit int) []models.LogEntry {
@@ -530,33 +1021,70 @@ func (pm *ProcessManager) GetLogsByProcess(processName string, limit int) []mode
 	return filtered
 }
 
+// StartAll starts autostart programs in dependency and priority order. A
+// program waits until the programs it depends on are RUNNING; if one of them
+// fails instead, the program is not started. StopAll cancels a StartAll that
+// is still waiting.
 func (pm *ProcessManager) StartAll() {
+	pm.startPrograms(nil, "autostart")
+}
+
+// startPrograms starts the given programs (all autostart programs when
+// selected is nil) in start order, waiting for dependencies as StartAll does.
+func (pm *ProcessManager) startPrograms(selected map[string]bool, reason string) {
 	pm.mu.RLock()
-	var toStart []string
-	for name, state := range pm.processes {
-		if state.Config.AutoStart {
-			toStart = append(toStart, name)
-		}
-	}
+	ctx := pm.startCtx
+	order := pm.programOrder()
 	pm.mu.RUnlock()
 
-	for _, name := range toStart {
-		pm.log("info", fmt.Sprintf("Auto-starting process %s", name), name)
-		if err := pm.StartProcess(name); err != nil {
-			pm.log("error", fmt.Sprintf("Failed to auto-start %s: %v", name, err), name)
+	for _, program := range order {
+		pm.mu.RLock()
+		procCfg, ok := pm.programs[program]
+		var toStart []string
+		for _, state := range pm.instancesOf(program) {
+			toStart = append(toStart, state.Config.Name)
+		}
+		pm.mu.RUnlock()
+
+		if !ok || (selected == nil && !procCfg.AutoStart) || (selected != nil && !selected[program]) {
+			continue
+		}
+
+		if err := pm.waitForDependencies(ctx, program); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			pm.log("error", fmt.Sprintf("Not starting program %s: %v", program, err), "")
+			continue
+		}
+
+		for _, name := range toStart {
+			if ctx.Err() != nil {
+				return
+			}
+			pm.log("info", fmt.Sprintf("Starting process %s (%s)", name, reason), name)
+			if err := pm.startProcess(name, reason); err != nil && !errors.Is(err, ErrProcessAlreadyRunning) {
+				pm.log("error", fmt.Sprintf("Failed to start %s: %v", name, err), name)
+			}
 		}
 	}
 }
 
+// StopAll stops every process in reverse start order, so programs stop
+// before the programs they depend on.
 func (pm *ProcessManager) StopAll() {
-	pm.mu.RLock()
+	pm.mu.Lock()
+	pm.cancelStarts()
+	pm.startCtx, pm.cancelStarts = context.WithCancel(context.Background())
+	order := pm.startOrder()
 	var toStop []string
-	for name, state := range pm.processes {
-		if state.Status == "running" {
-			toStop = append(toStop, name)
+	for i := len(order) - 1; i >= 0; i-- {
+		state := pm.processes[order[i]]
+		if state.Status.IsActive() || state.Status == models.StateBackoff {
+			toStop = append(toStop, order[i])
 		}
 	}
-	pm.mu.RUnlock()
+	pm.mu.Unlock()
 
 	for _, name := range toStop {
 		pm.log("info", fmt.Sprintf("Stopping process %s", name), name)
@@ -569,8 +1097,8 @@ func (pm *ProcessManager) StopAll() {
 func (pm *ProcessManager) RestartAll() (restarted int, failed int) {
 	pm.mu.RLock()
 	var toRestart []string
-	for name, state := range pm.processes {
-		if state.Status == "running" {
+	for _, name := range pm.startOrder() {
+		if pm.processes[name].Status.IsActive() {
 			toRestart = append(toRestart, name)
 		}
 	}
@@ -606,7 +1134,7 @@ func (pm *ProcessManager) RestartSelected(names []string) (restarted int, failed
 			continue
 		}
 
-		if state.Status != "running" {
+		if !state.Status.IsActive() {
 			pm.log("info", fmt.Sprintf("Process %s is not running, starting", name), name)
 			if err := pm.StartProcess(name); err != nil {
 				pm.log("error", fmt.Sprintf("Failed to start %s: %v", name, err), name)
@@ -656,54 +1184,6 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%ds", seconds)
 }
 
-func getProcessMemory(pid int) string {
-	if pid <= 0 {
-		return "N/A"
-	}
-
-	var cmd *exec.Cmd
-	if runtime.GOOS == "darwin" {
-		// macOS: use ps to get RSS in KB
-		cmd = exec.Command("ps", "-o", "rss=", "-p", strconv.Itoa(pid))
-	} else {
-		// Linux: use ps
-		cmd = exec.Command("ps", "-o", "rss=", "-p", strconv.Itoa(pid))
-	}
-
-	output, err := cmd.Output()
-	if err != nil {
-		return "N/A"
-	}
-
-	rssStr := strings.TrimSpace(string(output))
-	rssKB, err := strconv.ParseInt(rssStr, 10, 64)
-	if err != nil {
-		return "N/A"
-	}
-
-	return formatBytes(rssKB * 1024)
-}
-
-func getProcessCPU(pid int) string {
-	if pid <= 0 {
-		return "N/A"
-	}
-
-	cmd := exec.Command("ps", "-o", "%cpu=", "-p", strconv.Itoa(pid))
-	output, err := cmd.Output()
-	if err != nil {
-		return "N/A"
-	}
-
-	cpuStr := strings.TrimSpace(string(output))
-	cpu, err := strconv.ParseFloat(cpuStr, 64)
-	if err != nil {
-		return "N/A"
-	}
-
-	return fmt.Sprintf("%.1f%%", cpu)
-}
-
 func formatBytes(bytes int64) string {
 	const (
 		KB = 1024
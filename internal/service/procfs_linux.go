@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc/<pid>/stat. It is 100
+// on every Linux architecture Go supports.
+const clockTicks = 100
+
+// parseStat returns the fields of /proc/<pid>/stat after the command name,
+// which may itself contain spaces and parentheses. fields[0] is field 3
+// (state) of proc(5).
+func parseStat(pid int) ([]string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return nil, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	return fields, nil
+}
+
+// processChildren maps every pid on the system to its child pids.
+func processChildren() map[int][]int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fields, err := parseStat(pid)
+		if err != nil {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		children[ppid] = append(children[ppid], pid)
+	}
+	return children
+}
+
+// groupMembers returns the pids of all processes in process group pgid.
+func groupMembers(pgid int) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fields, err := parseStat(pid)
+		if err != nil {
+			continue
+		}
+		if pgrp, _ := strconv.Atoi(fields[2]); pgrp == pgid {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// processAlive reports whether pid exists and is not a zombie.
+func processAlive(pid int) bool {
+	fields, err := parseStat(pid)
+	return err == nil && fields[0] != "Z"
+}
+
+// readProcess reads the resource usage of a single process from /proc.
+func readProcess(pid int) (rawUsage, error) {
+	var u rawUsage
+
+	fields, err := parseStat(pid)
+	if err != nil {
+		return u, err
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	u.cpuSeconds = float64(utime+stime) / clockTicks
+
+	readKeyValues(fmt.Sprintf("/proc/%d/status", pid), func(key, value string) {
+		switch key {
+		case "VmRSS":
+			u.rss = parseKB(value)
+		case "VmSize":
+			u.vms = parseKB(value)
+		case "Threads":
+			u.threads, _ = strconv.Atoi(value)
+		}
+	})
+
+	// io is only readable for processes we may ptrace; leave it at zero
+	// otherwise
+	readKeyValues(fmt.Sprintf("/proc/%d/io", pid), func(key, value string) {
+		switch key {
+		case "read_bytes":
+			u.readBytes, _ = strconv.ParseUint(value, 10, 64)
+		case "write_bytes":
+			u.writeBytes, _ = strconv.ParseUint(value, 10, 64)
+		}
+	})
+
+	if fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid)); err == nil {
+		u.fds = len(fds)
+	}
+
+	return u, nil
+}
+
+// readKeyValues calls fn for every "key: value" line of a /proc file.
+func readKeyValues(path string, fn func(key, value string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok {
+			fn(key, strings.TrimSpace(value))
+		}
+	}
+}
+
+// parseKB parses a "1234 kB" value into bytes.
+func parseKB(value string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimSuffix(value, " kB"), 10, 64)
+	return n * 1024
+}
@@ -0,0 +1,86 @@
+//go:build !linux
+
+package service
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// processChildren is not available without /proc; only the supervised
+// process itself is sampled.
+func processChildren() map[int][]int {
+	return nil
+}
+
+// groupMembers asks ps for the pids of all processes in process group pgid.
+func groupMembers(pgid int) []int {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,pgid=").Output()
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		if pgrp, _ := strconv.Atoi(fields[1]); pgrp == pgid && pid > 0 {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// processAlive reports whether pid exists and is not a zombie.
+func processAlive(pid int) bool {
+	out, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return false
+	}
+	stat := strings.TrimSpace(string(out))
+	return stat != "" && !strings.HasPrefix(stat, "Z")
+}
+
+// readProcess asks ps for the usage of a single process. IO, thread and file
+// descriptor counts are not available.
+func readProcess(pid int) (rawUsage, error) {
+	var u rawUsage
+
+	out, err := exec.Command("ps", "-o", "rss=,vsz=,time=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return u, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 {
+		return u, fmt.Errorf("unexpected ps output %q", strings.TrimSpace(string(out)))
+	}
+
+	rss, _ := strconv.ParseUint(fields[0], 10, 64)
+	vsz, _ := strconv.ParseUint(fields[1], 10, 64)
+	u.rss = rss * 1024
+	u.vms = vsz * 1024
+	u.cpuSeconds = parseCPUTime(fields[2])
+	u.threads = 1
+	return u, nil
+}
+
+// parseCPUTime parses ps's [[dd-]hh:]mm:ss[.ss] format.
+func parseCPUTime(s string) float64 {
+	var days float64
+	if d, rest, ok := strings.Cut(s, "-"); ok {
+		days, _ = strconv.ParseFloat(d, 64)
+		s = rest
+	}
+
+	var seconds float64
+	for _, part := range strings.Split(s, ":") {
+		v, _ := strconv.ParseFloat(part, 64)
+		seconds = seconds*60 + v
+	}
+	return days*86400 + seconds
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"pupervisor/internal/config"
+)
+
+// leftoverGrace is how long the descendants of a stopped process get to exit
+// before they are reported as left over.
+const leftoverGrace = time.Second
+
+// signalProcess sends sig to the process, or to its whole process group.
+func signalProcess(process *os.Process, sig syscall.Signal, group bool) error {
+	if group {
+		return signalGroup(process.Pid, sig)
+	}
+	return process.Signal(sig)
+}
+
+// descendants returns the pids of all descendants of pid.
+func descendants(pid int, children map[int][]int) []int {
+	var pids []int
+	seen := map[int]bool{pid: true}
+	queue := append([]int(nil), children[pid]...)
+	for len(queue) > 0 {
+		child := queue[0]
+		queue = queue[1:]
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		pids = append(pids, child)
+		queue = append(queue, children[child]...)
+	}
+	return pids
+}
+
+// survivors returns the pids from tree and from the process group led by pid
+// that are still alive.
+func survivors(pid int, tree []int) []int {
+	seen := map[int]bool{pid: true}
+	candidates := append(append([]int(nil), tree...), groupMembers(pid)...)
+
+	var alive []int
+	for _, p := range candidates {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if processAlive(p) {
+			alive = append(alive, p)
+		}
+	}
+	sort.Ints(alive)
+	return alive
+}
+
+// groupAlive reports whether any process in the group led by pid is alive.
+func groupAlive(pid int) bool {
+	for _, p := range groupMembers(pid) {
+		if processAlive(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitFor polls done until it returns true or wait elapses.
+func waitFor(done func() bool, wait time.Duration) {
+	deadline := time.Now().Add(wait)
+	for !done() && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// checkLeftovers verifies that a stopped process took its descendants with
+// it. With killasgroup, members of its process group that are still alive
+// are killed. Whatever survives is logged and reported by the API until the
+// process is started again.
+func (pm *ProcessManager) checkLeftovers(name string, state *ProcessState, cfg config.ProcessConfig, pid int, tree []int, deadline time.Time) {
+	// Group members were signalled too and get the rest of stoptimeout
+	if cfg.StopAsGroup {
+		waitFor(func() bool { return !groupAlive(pid) }, time.Until(deadline))
+	}
+	if cfg.KillAsGroup && groupAlive(pid) {
+		pm.log("warning", fmt.Sprintf("Killing the remaining processes in the process group of %s", name), name)
+		_ = signalGroup(pid, syscall.SIGKILL)
+	}
+
+	var alive []int
+	waitFor(func() bool {
+		alive = survivors(pid, tree)
+		return len(alive) == 0
+	}, leftoverGrace)
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	// Started again meanwhile; the new run is not affected
+	if state.Status.IsActive() {
+		return
+	}
+	state.leftovers = alive
+	if len(alive) > 0 {
+		pm.log("warning", fmt.Sprintf("Processes left running after %s stopped: PIDs %s", name, joinPIDs(alive)), name)
+	}
+}
+
+func joinPIDs(pids []int) string {
+	parts := make([]string, len(pids))
+	for i, pid := range pids {
+		parts[i] = strconv.Itoa(pid)
+	}
+	return strings.Join(parts, ", ")
+}
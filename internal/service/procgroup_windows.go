@@ -0,0 +1,22 @@
+//go:build windows
+
+package service
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup does nothing: Windows has no POSIX process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup signals only the process itself, since Windows cannot signal
+// a process group.
+func signalGroup(pid int, sig syscall.Signal) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(sig)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+	"pupervisor/internal/storage"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrProgramExists = errors.New("program already exists")
+
+// programActionVerbs describe program changes in the system log.
+var programActionVerbs = map[string]string{
+	storage.ProgramCreated: "added to",
+	storage.ProgramUpdated: "changed in",
+	storage.ProgramDeleted: "removed from",
+}
+
+// ProgramDefinition returns the definition of a program as written in the
+// configuration file, without defaults filled in.
+func (pm *ProcessManager) ProgramDefinition(name string) (map[string]interface{}, error) {
+	pm.reloadMu.Lock()
+	defer pm.reloadMu.Unlock()
+
+	f, err := pm.openConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	node, err := f.Program(name)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, ErrProgramNotFound
+	}
+
+	def := make(map[string]interface{})
+	if err := node.Decode(&def); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// CreateProgram adds a program to the configuration file and applies the
+// file like a reload.
+func (pm *ProcessManager) CreateProgram(pc config.ProcessConfig, actor string) (*models.ReloadResult, error) {
+	return pm.editProgram(pc.Name, storage.ProgramCreated, actor, func(f *config.ConfigFile, prev *yaml.Node) error {
+		if prev != nil {
+			return ErrProgramExists
+		}
+		return f.SetProgram(pc)
+	})
+}
+
+// UpdateProgram replaces the definition of a program in the configuration
+// file and applies the file like a reload.
+func (pm *ProcessManager) UpdateProgram(pc config.ProcessConfig, actor string) (*models.ReloadResult, error) {
+	return pm.editProgram(pc.Name, storage.ProgramUpdated, actor, func(f *config.ConfigFile, prev *yaml.Node) error {
+		if prev == nil {
+			return ErrProgramNotFound
+		}
+		return f.SetProgram(pc)
+	})
+}
+
+// DeleteProgram removes a program from the configuration file and applies
+// the file like a reload, which stops its processes.
+func (pm *ProcessManager) DeleteProgram(name, actor string) (*models.ReloadResult, error) {
+	return pm.editProgram(name, storage.ProgramDeleted, actor, func(f *config.ConfigFile, prev *yaml.Node) error {
+		if prev == nil {
+			return ErrProgramNotFound
+		}
+		_, err := f.RemoveProgram(name)
+		return err
+	})
+}
+
+// editProgram applies edit to the configuration file, validates the result,
+// writes it back and reloads it. The change is recorded with the
+// definitions before and after.
+func (pm *ProcessManager) editProgram(name, action, actor string, edit func(f *config.ConfigFile, prev *yaml.Node) error) (*models.ReloadResult, error) {
+	pm.reloadMu.Lock()
+	defer pm.reloadMu.Unlock()
+
+	f, err := pm.openConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	prev, err := f.Program(name)
+	if err != nil {
+		return nil, err
+	}
+	change := &storage.ProgramChange{Program: name, Action: action, Actor: actor}
+	if prev != nil {
+		if change.Before, err = config.EncodeNode(prev); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := edit(f, prev); err != nil {
+		return nil, err
+	}
+	next, err := f.Program(name)
+	if err != nil {
+		return nil, err
+	}
+	if next != nil {
+		if change.After, err = config.EncodeNode(next); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := f.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := config.ParseConfig(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if err := f.Save(data); err != nil {
+		return nil, err
+	}
+
+	pm.log("info", fmt.Sprintf("Program %s %s %s by %s", name, programActionVerbs[action], pm.configPath, actor), "")
+	if pm.storage != nil {
+		if err := pm.storage.SaveProgramChange(change); err != nil {
+			pm.log("error", fmt.Sprintf("Failed to record change of program %s: %v", name, err), "")
+		}
+	}
+
+	return pm.reload()
+}
+
+func (pm *ProcessManager) openConfigFile() (*config.ConfigFile, error) {
+	if pm.configPath == "" {
+		return nil, ErrNoConfigPath
+	}
+	return config.OpenConfigFile(pm.configPath)
+}
+
+// ProgramChanges returns the latest recorded changes of a program, or of
+// all programs if name is empty, newest first. Deleted programs keep their
+// history.
+func (pm *ProcessManager) ProgramChanges(name string, limit int) ([]storage.ProgramChange, error) {
+	if pm.storage == nil {
+		return []storage.ProgramChange{}, nil
+	}
+	return pm.storage.GetProgramChanges(name, limit)
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/models"
+)
+
+var (
+	ErrNoConfigPath  = errors.New("no configuration file to reload")
+	ErrInvalidConfig = errors.New("invalid configuration")
+)
+
+// configDiff compares a freshly loaded configuration with the running one.
+type configDiff struct {
+	result   models.ReloadResult
+	programs map[string]config.ProcessConfig
+	// scaled holds changed programs whose only difference is numprocs
+	scaled map[string]bool
+}
+
+// Reread loads the configuration file and reports how it differs from the
+// running configuration without applying anything.
+func (pm *ProcessManager) Reread() (*models.ReloadResult, error) {
+	pm.reloadMu.Lock()
+	defer pm.reloadMu.Unlock()
+
+	diff, err := pm.readConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &diff.result, nil
+}
+
+// Reload loads the configuration file and applies the difference: removed
+// programs are stopped and dropped, changed programs are replaced (and
+// started again if they were running or autostart), added programs are
+// registered and started if autostart. Programs whose only change is numprocs
+// are scaled in place; unchanged programs are not touched.
+func (pm *ProcessManager) Reload() (*models.ReloadResult, error) {
+	pm.reloadMu.Lock()
+	defer pm.reloadMu.Unlock()
+
+	return pm.reload()
+}
+
+// reload applies the configuration file. Caller must hold pm.reloadMu.
+func (pm *ProcessManager) reload() (*models.ReloadResult, error) {
+	diff, err := pm.readConfig()
+	if err != nil {
+		pm.log("error", fmt.Sprintf("Configuration reload failed: %v", err), "")
+		return nil, err
+	}
+
+	result := &diff.result
+	pm.log("info", fmt.Sprintf("Reloading configuration from %s: %d added, %d removed, %d changed",
+		pm.configPath, len(result.Added), len(result.Removed), len(result.Changed)), "")
+
+	for _, program := range result.Removed {
+		pm.removeProgram(program)
+	}
+
+	// Remove every replaced program before adding any back, so instance
+	// names moving between programs cannot collide
+	start := make(map[string]bool)
+	var replaced []string
+	for _, program := range result.Changed {
+		procCfg := diff.programs[program]
+		if diff.scaled[program] {
+			if _, err := pm.ScaleProgram(program, procCfg.NumProcs); err != nil {
+				pm.log("error", fmt.Sprintf("Failed to scale %s: %v", program, err), "")
+			}
+			continue
+		}
+
+		if procCfg.AutoStart || pm.programActive(program) {
+			start[program] = true
+		}
+		pm.removeProgram(program)
+		replaced = append(replaced, program)
+	}
+
+	for _, program := range replaced {
+		pm.addProgram(diff.programs[program])
+	}
+
+	for _, program := range result.Added {
+		procCfg := diff.programs[program]
+		pm.addProgram(procCfg)
+		if procCfg.AutoStart {
+			start[program] = true
+		}
+	}
+
+	if len(start) > 0 {
+		go pm.startPrograms(start, "config reload")
+	}
+
+	result.Applied = true
+	return result, nil
+}
+
+// readConfig loads the configuration file and diffs it against the running
+// programs. Caller must hold pm.reloadMu.
+func (pm *ProcessManager) readConfig() (*configDiff, error) {
+	if pm.configPath == "" {
+		return nil, ErrNoConfigPath
+	}
+
+	cfg, err := config.LoadProcessConfig(pm.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	diff := &configDiff{
+		result: models.ReloadResult{
+			Added:     []string{},
+			Removed:   []string{},
+			Changed:   []string{},
+			Unchanged: []string{},
+		},
+		programs: make(map[string]config.ProcessConfig, len(cfg.Processes)),
+		scaled:   make(map[string]bool),
+	}
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, procCfg := range cfg.Processes {
+		diff.programs[procCfg.Name] = procCfg
+
+		current, ok := pm.programs[procCfg.Name]
+		switch {
+		case !ok:
+			diff.result.Added = append(diff.result.Added, procCfg.Name)
+		case reflect.DeepEqual(current, procCfg):
+			diff.result.Unchanged = append(diff.result.Unchanged, procCfg.Name)
+		default:
+			diff.result.Changed = append(diff.result.Changed, procCfg.Name)
+			current.NumProcs = procCfg.NumProcs
+			if reflect.DeepEqual(current, procCfg) {
+				diff.scaled[procCfg.Name] = true
+			}
+		}
+	}
+
+	for name := range pm.programs {
+		if _, ok := diff.programs[name]; !ok {
+			diff.result.Removed = append(diff.result.Removed, name)
+		}
+	}
+
+	sort.Strings(diff.result.Added)
+	sort.Strings(diff.result.Removed)
+	sort.Strings(diff.result.Changed)
+	sort.Strings(diff.result.Unchanged)
+
+	return diff, nil
+}
+
+// programActive reports whether any instance of program is running or
+// waiting to be restarted.
+func (pm *ProcessManager) programActive(program string) bool {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, state := range pm.instancesOf(program) {
+		if state.Status.IsActive() || state.Status == models.StateBackoff {
+			return true
+		}
+	}
+	return false
+}
+
+// removeProgram stops all instances of program and forgets it.
+func (pm *ProcessManager) removeProgram(program string) {
+	pm.mu.RLock()
+	var names []string
+	for _, state := range pm.instancesOf(program) {
+		names = append(names, state.Config.Name)
+	}
+	pm.mu.RUnlock()
+
+	pm.removeInstances(names)
+
+	pm.mu.Lock()
+	delete(pm.programs, program)
+	pm.mu.Unlock()
+}
+
+// addProgram registers program and its stopped instances.
+func (pm *ProcessManager) addProgram(procCfg config.ProcessConfig) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.programs[procCfg.Name] = procCfg
+	for _, num := range procCfg.ProcessNums() {
+		pm.addInstance(procCfg, num)
+	}
+}
+
+// WatchConfig polls the configuration file and reloads it whenever its
+// modification time or size changes, until ctx is cancelled.
+func (pm *ProcessManager) WatchConfig(ctx context.Context, interval time.Duration) {
+	if pm.configPath == "" {
+		return
+	}
+
+	last, _ := os.Stat(pm.configPath)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(pm.configPath)
+		if err != nil {
+			continue
+		}
+		if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		last = info
+
+		pm.log("info", fmt.Sprintf("Configuration file %s changed", pm.configPath), "")
+		_, _ = pm.Reload()
+	}
+}
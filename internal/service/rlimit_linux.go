@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"pupervisor/internal/config"
+)
+
+// startWithRlimits starts cmd with start and sets its resource limits
+// before it runs its first instruction. The child is traced
+// (PTRACE_TRACEME), so the kernel stops it right after exec; the limits
+// are set with prlimit while it is stopped, then it is let go. Neither the
+// program nor anything it forks ever runs without them.
+func startWithRlimits(cmd *exec.Cmd, rc *config.RlimitsConfig, start func() error) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Ptrace = true
+
+	// Only the thread that started the child may detach from it
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := start(); err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+
+	var ws unix.WaitStatus
+	if _, err := unix.Wait4(pid, &ws, 0, nil); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("rlimits: waiting for the process to stop at exec: %w", err)
+	}
+	if !ws.Stopped() {
+		return fmt.Errorf("rlimits: process exited before its limits were set")
+	}
+
+	err := applyRlimits(pid, rc)
+	if err != nil {
+		// SIGKILL also ends a stopped, traced process
+		_ = cmd.Process.Kill()
+	}
+	if detachErr := unix.PtraceDetach(pid); detachErr != nil && err == nil {
+		_ = cmd.Process.Kill()
+		err = fmt.Errorf("detaching: %w", detachErr)
+	}
+	if err != nil {
+		_ = cmd.Wait()
+		return fmt.Errorf("rlimits: %w", err)
+	}
+	return nil
+}
+
+// applyRlimits sets the configured limits of a process as both its soft and
+// hard limits.
+func applyRlimits(pid int, rc *config.RlimitsConfig) error {
+	for _, limit := range []struct {
+		name     string
+		resource int
+		value    *config.Rlimit
+	}{
+		{"nofile", unix.RLIMIT_NOFILE, rc.NoFile},
+		{"nproc", unix.RLIMIT_NPROC, rc.NProc},
+		{"core", unix.RLIMIT_CORE, rc.Core},
+		{"as", unix.RLIMIT_AS, rc.AS},
+	} {
+		if limit.value == nil {
+			continue
+		}
+		value := uint64(*limit.value)
+		rlim := unix.Rlimit{Cur: value, Max: value}
+		if err := unix.Prlimit(pid, limit.resource, &rlim, nil); err != nil {
+			if errors.Is(err, unix.EPERM) {
+				return fmt.Errorf("%s: %w (raising limits, or limiting a process of another user, needs CAP_SYS_RESOURCE)", limit.name, err)
+			}
+			return fmt.Errorf("%s: %w", limit.name, err)
+		}
+	}
+	return nil
+}
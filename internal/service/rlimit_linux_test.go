@@ -0,0 +1,34 @@
+package service
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+
+	"pupervisor/internal/config"
+)
+
+func TestStartWithRlimits(t *testing.T) {
+	nofile := config.Rlimit(100)
+	core := config.Rlimit(0)
+	rc := &config.RlimitsConfig{NoFile: &nofile, Core: &core}
+
+	// The limits hold from the first instruction, and for forked children
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", `echo $(ulimit -n) $(ulimit -Hn) $(ulimit -c); sh -c 'ulimit -n'`)
+	cmd.Stdout = &out
+	if err := startWithRlimits(cmd, rc, cmd.Start); err != nil {
+		t.Fatalf("startWithRlimits: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if want := "100 100 0\n100\n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+
+	cmd = exec.Command("/nonexistent/pupervisor-test")
+	if err := startWithRlimits(cmd, rc, cmd.Start); err == nil {
+		t.Error("startWithRlimits succeeded for a missing command")
+	}
+}
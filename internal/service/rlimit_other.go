@@ -0,0 +1,17 @@
+//go:build !linux
+
+package service
+
+import (
+	"errors"
+	"os/exec"
+
+	"pupervisor/internal/config"
+)
+
+// startWithRlimits fails: setting the limits of another process needs
+// prlimit, which only Linux has. Configurations with rlimits are rejected
+// at load.
+func startWithRlimits(cmd *exec.Cmd, rc *config.RlimitsConfig, start func() error) error {
+	return errors.New("rlimits: only supported on linux")
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"pupervisor/internal/models"
+	"pupervisor/internal/storage"
+)
+
+// DefaultSampleInterval is how often the resource usage of running processes
+// is sampled.
+const DefaultSampleInterval = 5 * time.Second
+
+// Stored samples are downsampled as they age so the history stays small:
+// raw samples for a day, 5 minute averages for a week, hourly averages for a
+// month.
+var sampleDownsampling = []struct {
+	after  time.Duration
+	bucket time.Duration
+}{
+	{after: 24 * time.Hour, bucket: 5 * time.Minute},
+	{after: 7 * 24 * time.Hour, bucket: time.Hour},
+}
+
+const (
+	sampleRetention  = 30 * 24 * time.Hour
+	compactionPeriod = time.Hour
+)
+
+// rawUsage is the usage of a single OS process as read from the system.
+type rawUsage struct {
+	cpuSeconds float64
+	rss        uint64
+	vms        uint64
+	readBytes  uint64
+	writeBytes uint64
+	threads    int
+	fds        int
+}
+
+// addUsage adds the usage of a single process to usage.
+func addUsage(usage *models.ResourceUsage, u rawUsage) {
+	usage.CPUSeconds += u.cpuSeconds
+	usage.RSSBytes += u.rss
+	usage.VMSBytes += u.vms
+	usage.ReadBytes += u.readBytes
+	usage.WriteBytes += u.writeBytes
+	usage.Threads += u.threads
+	usage.OpenFDs += u.fds
+	usage.Processes++
+}
+
+// sampleTree sums the usage of pid and all of its descendants.
+func sampleTree(pid int, children map[int][]int) (*models.ResourceUsage, error) {
+	root, err := readProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &models.ResourceUsage{}
+	addUsage(usage, root)
+
+	seen := map[int]bool{pid: true}
+	queue := append([]int(nil), children[pid]...)
+	for len(queue) > 0 {
+		child := queue[0]
+		queue = queue[1:]
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+
+		// Children may exit between listing and reading
+		if u, err := readProcess(child); err == nil {
+			addUsage(usage, u)
+			queue = append(queue, children[child]...)
+		}
+	}
+
+	return usage, nil
+}
+
+type sampleTarget struct {
+	name   string
+	state  *ProcessState
+	pid    int
+	cgroup string
+}
+
+// RunSampler samples the resource usage of every running process tree each
+// interval until ctx is cancelled. The API and metrics serve the latest
+// sample instead of querying the system per request; samples are also stored
+// for the metrics history.
+func (pm *ProcessManager) RunSampler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastCompaction time.Time
+	for {
+		samples := pm.sampleResources()
+
+		if pm.storage != nil {
+			if len(samples) > 0 {
+				if err := pm.storage.SaveProcessSamples(samples); err != nil {
+					pm.log("error", fmt.Sprintf("Failed to save resource samples: %v", err), "")
+				}
+			}
+			if time.Since(lastCompaction) >= compactionPeriod {
+				lastCompaction = time.Now()
+				pm.compactSamples(lastCompaction)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sampleResources refreshes the cached usage of every running process and
+// returns the new samples for storage.
+func (pm *ProcessManager) sampleResources() []storage.ProcessSample {
+	pm.mu.RLock()
+	var targets []sampleTarget
+	for name, state := range pm.processes {
+		if state.Status.IsActive() && state.Pid > 0 {
+			targets = append(targets, sampleTarget{name: name, state: state, pid: state.Pid, cgroup: state.cgroup})
+		}
+	}
+	pm.mu.RUnlock()
+
+	if len(targets) == 0 {
+		return nil
+	}
+
+	children := processChildren()
+	samples := make([]*models.ResourceUsage, len(targets))
+	oomKills := make([]int, len(targets))
+	for i, t := range targets {
+		// Processes in a cgroup are sampled by membership, which also
+		// covers children that left the process tree
+		var usage *models.ResourceUsage
+		var err error
+		if t.cgroup != "" {
+			usage, err = sampleCgroup(t.cgroup)
+			oomKills[i] = cgroupOOMKills(t.cgroup)
+		} else {
+			usage, err = sampleTree(t.pid, children)
+		}
+		if err == nil {
+			samples[i] = usage
+		}
+	}
+	now := time.Now()
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	var stored []storage.ProcessSample
+	for i, t := range targets {
+		state := t.state
+		if pm.processes[t.name] != state || state.Pid != t.pid || !state.Status.IsActive() {
+			continue
+		}
+		if t.cgroup != "" {
+			pm.recordOOMKills(t.name, state, oomKills[i], now)
+		}
+
+		usage := samples[i]
+		if usage == nil {
+			state.usage = nil
+			continue
+		}
+
+		// CPU percent is the share of one core used since the previous
+		// sample, or since the process started for the first one
+		since, prevSeconds := state.StartTime, 0.0
+		if state.usage != nil {
+			since, prevSeconds = state.usageAt, state.usage.CPUSeconds
+		}
+		if elapsed := now.Sub(since).Seconds(); elapsed > 0 && usage.CPUSeconds > prevSeconds {
+			usage.CPUPercent = math.Round((usage.CPUSeconds-prevSeconds)/elapsed*10000) / 100
+		}
+
+		usage.SampledAt = now.Format(time.RFC3339)
+		state.usage = usage
+		state.usageAt = now
+		pm.enforceLimits(t.name, state, usage, now)
+
+		stored = append(stored, storage.ProcessSample{
+			ProcessName: t.name,
+			Timestamp:   now,
+			CPUPercent:  usage.CPUPercent,
+			RSSBytes:    int64(usage.RSSBytes),
+			Threads:     usage.Threads,
+			OpenFDs:     usage.OpenFDs,
+		})
+	}
+
+	return stored
+}
+
+// compactSamples downsamples and expires stored samples.
+func (pm *ProcessManager) compactSamples(now time.Time) {
+	for _, d := range sampleDownsampling {
+		if _, err := pm.storage.DownsampleProcessSamples(now.Add(-d.after), d.bucket); err != nil {
+			pm.log("error", fmt.Sprintf("Failed to downsample resource samples: %v", err), "")
+			return
+		}
+	}
+	if _, err := pm.storage.DeleteProcessSamplesBefore(now.Add(-sampleRetention)); err != nil {
+		pm.log("error", fmt.Sprintf("Failed to expire resource samples: %v", err), "")
+	}
+}
+
+// ProcessMetrics returns the stored resource history of a process between
+// from and to, averaged over step.
+func (pm *ProcessManager) ProcessMetrics(name string, from, to time.Time, step time.Duration) ([]storage.MetricPoint, error) {
+	pm.mu.RLock()
+	_, ok := pm.processes[name]
+	pm.mu.RUnlock()
+	if !ok {
+		return nil, ErrProcessNotFound
+	}
+
+	if pm.storage == nil {
+		return []storage.MetricPoint{}, nil
+	}
+	return pm.storage.GetProcessMetrics(name, from, to, step)
+}
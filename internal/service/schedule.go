@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"pupervisor/internal/config"
+	"pupervisor/internal/storage"
+)
+
+const (
+	// maxJobRuns is the number of runs kept per scheduled process
+	maxJobRuns = 100
+	// jobRunOutputLines is the number of output lines stored per run and stream
+	jobRunOutputLines = 50
+
+	reasonScheduled = "scheduled run"
+	reasonQueued    = "queued scheduled run"
+)
+
+// RunScheduler starts scheduled processes when their next run is due, until
+// ctx is cancelled. Runs missed while pupervisor was not scheduling, e.g.
+// during a suspend, are started once.
+func (pm *ProcessManager) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, name := range pm.dueRuns(now) {
+				go pm.runScheduled(name)
+			}
+		}
+	}
+}
+
+// dueRuns returns the processes whose next run is due at now and advances
+// their next run.
+func (pm *ProcessManager) dueRuns(now time.Time) []string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	var due []string
+	for name, state := range pm.processes {
+		if state.schedule == nil || state.nextRun.IsZero() || now.Before(state.nextRun) {
+			continue
+		}
+		due = append(due, name)
+		state.nextRun = state.schedule.Next(now)
+	}
+	sort.Strings(due)
+	return due
+}
+
+// runScheduled starts a scheduled run, applying the overlap policy if the
+// previous run is still going.
+func (pm *ProcessManager) runScheduled(name string) {
+	err := pm.startProcess(name, reasonScheduled)
+	if err == nil {
+		pm.log("info", fmt.Sprintf("Started scheduled run of %s", name), name)
+		return
+	}
+	if !errors.Is(err, ErrProcessAlreadyRunning) {
+		pm.log("error", fmt.Sprintf("Failed to start scheduled run of %s: %v", name, err), name)
+		return
+	}
+
+	pm.mu.Lock()
+	state, ok := pm.processes[name]
+	if !ok || state.Config.Schedule == nil {
+		pm.mu.Unlock()
+		return
+	}
+	overlap := state.Config.Schedule.Overlap
+	if overlap == config.OverlapQueue {
+		state.runQueued = true
+	}
+	pm.mu.Unlock()
+
+	switch overlap {
+	case config.OverlapQueue:
+		pm.log("info", fmt.Sprintf("Scheduled run of %s queued until the previous run exits", name), name)
+	case config.OverlapReplace:
+		pm.log("warning", fmt.Sprintf("Stopping the previous run of %s for the scheduled run", name), name)
+		if err := pm.StopProcess(name); err != nil && !errors.Is(err, ErrProcessNotRunning) {
+			pm.log("error", fmt.Sprintf("Failed to stop %s: %v", name, err), name)
+			return
+		}
+		if err := pm.startProcess(name, reasonScheduled); err != nil {
+			pm.log("error", fmt.Sprintf("Failed to start scheduled run of %s: %v", name, err), name)
+		}
+	default:
+		pm.log("warning", fmt.Sprintf("Skipping scheduled run of %s, the previous run is still going", name), name)
+	}
+}
+
+// startQueuedRun starts a run that was queued while the previous run of the
+// process was going. Caller must hold pm.mu.
+func (pm *ProcessManager) startQueuedRun(name string, state *ProcessState) {
+	if !state.runQueued || pm.processes[name] != state {
+		return
+	}
+	state.runQueued = false
+	state.cancelBackoff()
+	state.retries = 0
+
+	if err := pm.spawn(name, state, reasonQueued); err != nil {
+		pm.log("error", fmt.Sprintf("Failed to start queued run of %s: %v", name, err), name)
+	}
+}
+
+// saveJobRun records a finished run of a scheduled process. expected tells
+// whether the run exited with a code listed in exitcodes.
+// Caller must hold pm.mu.
+func (pm *ProcessManager) saveJobRun(name string, state *ProcessState, startTime, endTime time.Time, stopped, expected bool) {
+	if pm.storage == nil {
+		return
+	}
+
+	status := storage.JobRunSucceeded
+	switch {
+	case stopped:
+		status = storage.JobRunStopped
+	case !expected:
+		status = storage.JobRunFailed
+	}
+
+	run := &storage.JobRun{
+		ProcessName: name,
+		Trigger:     state.startReason,
+		Status:      status,
+		ExitCode:    state.ExitCode,
+		Signal:      exitSignal(state),
+		StartedAt:   startTime,
+		EndedAt:     endTime,
+		Duration:    formatDuration(endTime.Sub(startTime)),
+	}
+	if state.outputBuffer != nil {
+		run.Stdout = state.outputBuffer.GetLastStdout(jobRunOutputLines)
+		run.Stderr = state.outputBuffer.GetLastStderr(jobRunOutputLines)
+	}
+
+	if err := pm.storage.SaveJobRun(run, maxJobRuns); err != nil {
+		pm.log("error", fmt.Sprintf("Failed to save run of %s: %v", name, err), name)
+	}
+}
+
+// JobRuns returns the latest recorded runs of a scheduled process, newest
+// first.
+func (pm *ProcessManager) JobRuns(name string, limit int) ([]storage.JobRun, error) {
+	pm.mu.RLock()
+	_, ok := pm.processes[name]
+	pm.mu.RUnlock()
+	if !ok {
+		return nil, ErrProcessNotFound
+	}
+
+	if pm.storage == nil {
+		return []storage.JobRun{}, nil
+	}
+	return pm.storage.GetJobRuns(name, limit)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"pupervisor/internal/models"
+	"pupervisor/internal/notify"
+)
+
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// maxTransitions is the number of state changes kept per process.
+const maxTransitions = 20
+
+// transitions lists the states reachable from each state. A process that
+// exited or was stopped for failing its health check goes on to BACKOFF, or
+// to FATAL once it used up its retries.
+var transitions = map[models.State][]models.State{
+	models.StateStopped:   {models.StateStarting, models.StateBackoff, models.StateFatal},
+	models.StateStarting:  {models.StateRunning, models.StateBackoff, models.StateStopping, models.StateExited, models.StateSucceeded, models.StateFatal},
+	models.StateRunning:   {models.StateStopping, models.StateExited, models.StateSucceeded},
+	models.StateBackoff:   {models.StateStarting, models.StateFatal, models.StateStopped},
+	models.StateStopping:  {models.StateStopped},
+	models.StateExited:    {models.StateStarting, models.StateBackoff, models.StateFatal},
+	models.StateSucceeded: {models.StateStarting},
+	models.StateFatal:     {models.StateStarting},
+	models.StateUnknown: {
+		models.StateStopped, models.StateStarting, models.StateRunning, models.StateBackoff,
+		models.StateStopping, models.StateExited, models.StateSucceeded, models.StateFatal,
+	},
+}
+
+func canTransition(from, to models.State) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// setState moves the process to a new state, recording when and why.
+// Transitions to the current state are no-ops. Caller must hold pm.mu.
+func (state *ProcessState) setState(to models.State, reason string) error {
+	from := state.Status
+	if from == to {
+		return nil
+	}
+	if !canTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+
+	now := time.Now()
+	state.Status = to
+	state.StateChangedAt = now
+	state.transitions = append(state.transitions, models.StateTransition{
+		From:   from,
+		To:     to,
+		At:     now.Format(time.RFC3339),
+		Reason: reason,
+	})
+	if len(state.transitions) > maxTransitions {
+		state.transitions = state.transitions[len(state.transitions)-maxTransitions:]
+	}
+
+	return nil
+}
+
+// transition applies setState, logs rejected transitions and reports FATAL
+// states and successful starts to the notifier. Caller must hold pm.mu.
+func (pm *ProcessManager) transition(name string, state *ProcessState, to models.State, reason string) bool {
+	if err := state.setState(to, reason); err != nil {
+		pm.log("error", fmt.Sprintf("Process %s: %v", name, err), name)
+		return false
+	}
+
+	switch to {
+	case models.StateFatal:
+		pm.notify(notify.EventFatal, name, state, reason)
+	case models.StateRunning, models.StateSucceeded:
+		pm.notify(notify.EventRunning, name, state, reason)
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"time"
+
+	"pupervisor/internal/models"
+)
+
+// ProcessStats returns the numeric state of every process in start order,
+// including the last sampled resource usage of running ones.
+func (pm *ProcessManager) ProcessStats() []models.ProcessStats {
+	pm.mu.RLock()
+	stats := make([]models.ProcessStats, 0, len(pm.processes))
+	for _, name := range pm.startOrder() {
+		state := pm.processes[name]
+		s := models.ProcessStats{
+			Name:    name,
+			Program: state.Program,
+			Group:   state.Group,
+			Status:  state.Status,
+			Pid:     state.Pid,
+		}
+		if state.starts > 1 {
+			s.Restarts = state.starts - 1
+		}
+		if state.Status.IsActive() && !state.StartTime.IsZero() {
+			s.UptimeSeconds = time.Since(state.StartTime).Seconds()
+		}
+		if state.Config.HealthCheck != nil && state.health.Status != models.HealthUnknown {
+			healthy := state.health.Status == models.HealthHealthy
+			s.Healthy = &healthy
+		}
+		if state.Status.IsActive() && state.usage != nil {
+			usage := *state.usage
+			s.Resources = &usage
+		}
+		stats = append(stats, s)
+	}
+	pm.mu.RUnlock()
+
+	return stats
+}
+
+// DroppedLogEntries returns the number of system log entries evicted from the
+// in-memory log buffer.
+func (pm *ProcessManager) DroppedLogEntries() uint64 {
+	return pm.logs.Dropped()
+}
+
+// DroppedOutputLines returns the number of output lines not delivered to
+// slow live-output subscribers.
+func (pm *ProcessManager) DroppedOutputLines() uint64 {
+	return pm.output.Dropped()
+}
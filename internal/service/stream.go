@@ -0,0 +1,199 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pupervisor/internal/models"
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+
+	// outputBacklog is the number of recent lines kept per process for replay.
+	outputBacklog = 500
+	// subscriberBuffer is the number of lines queued for a slow subscriber
+	// before new lines are dropped.
+	subscriberBuffer = 256
+)
+
+// Subscription receives output lines of a single process. Lines published
+// while the subscriber's queue is full are dropped and counted. C is closed
+// when the process is removed.
+type Subscription struct {
+	C <-chan models.OutputLine
+
+	ch      chan models.OutputLine
+	process string
+	streams map[string]bool
+	dropped atomic.Uint64
+}
+
+// Dropped returns the number of lines that were not delivered because the
+// subscriber did not keep up.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription) wants(line models.OutputLine) bool {
+	if line.Process != s.process {
+		return false
+	}
+	return len(s.streams) == 0 || s.streams[line.Stream]
+}
+
+// OutputHub fans process output out to live subscribers and keeps a short
+// per-process backlog for replay.
+type OutputHub struct {
+	mu          sync.Mutex
+	seq         uint64
+	backlog     map[string][]models.OutputLine
+	written     map[streamKey]int64
+	subscribers map[*Subscription]struct{}
+	dropped     atomic.Uint64
+}
+
+type streamKey struct {
+	process string
+	stream  string
+}
+
+func NewOutputHub() *OutputHub {
+	return &OutputHub{
+		backlog:     make(map[string][]models.OutputLine),
+		written:     make(map[streamKey]int64),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+func (h *OutputHub) Publish(process, stream, line string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	entry := models.OutputLine{
+		Seq:       h.seq,
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Process:   process,
+		Stream:    stream,
+		Line:      line,
+	}
+
+	lines := append(h.backlog[process], entry)
+	if len(lines) > outputBacklog {
+		lines = lines[len(lines)-outputBacklog:]
+	}
+	h.backlog[process] = lines
+	h.written[streamKey{process, stream}] += int64(len(line)) + 1
+
+	for sub := range h.subscribers {
+		if !sub.wants(entry) {
+			continue
+		}
+		select {
+		case sub.ch <- entry:
+		default:
+			sub.dropped.Add(1)
+			h.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for a process. streams limits delivery to
+// stdout and/or stderr (empty means both). The returned backlog holds up to
+// replay matching lines with a sequence number greater than after; it is
+// captured atomically with the subscription so no line is missed or repeated.
+func (h *OutputHub) Subscribe(process string, streams []string, replay int, after uint64) (*Subscription, []models.OutputLine) {
+	ch := make(chan models.OutputLine, subscriberBuffer)
+	sub := &Subscription{
+		C:       ch,
+		ch:      ch,
+		process: process,
+	}
+	if len(streams) > 0 {
+		sub.streams = make(map[string]bool, len(streams))
+		for _, s := range streams {
+			sub.streams[s] = true
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	backlog := []models.OutputLine{}
+	if replay > 0 {
+		for _, line := range h.backlog[process] {
+			if line.Seq > after && sub.wants(line) {
+				backlog = append(backlog, line)
+			}
+		}
+		if len(backlog) > replay {
+			backlog = backlog[len(backlog)-replay:]
+		}
+	}
+
+	h.subscribers[sub] = struct{}{}
+	return sub, backlog
+}
+
+// Log returns the buffered lines of one stream of a process as
+// newline-terminated text, and the number of bytes the stream produced in
+// total. The text covers the offsets [end-len(text), end) of the stream.
+func (h *OutputHub) Log(process, stream string) (text []byte, end int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, line := range h.backlog[process] {
+		if line.Stream == stream {
+			text = append(append(text, line.Line...), '\n')
+		}
+	}
+	return text, h.written[streamKey{process, stream}]
+}
+
+// Dropped returns the number of lines dropped across all subscribers.
+func (h *OutputHub) Dropped() uint64 {
+	return h.dropped.Load()
+}
+
+func (h *OutputHub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, sub)
+}
+
+// Forget drops the backlog of a process that no longer exists and closes its
+// subscriptions.
+func (h *OutputHub) Forget(process string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.backlog, process)
+	delete(h.written, streamKey{process, StreamStdout})
+	delete(h.written, streamKey{process, StreamStderr})
+	for sub := range h.subscribers {
+		if sub.process == process {
+			delete(h.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// SubscribeOutput streams the output of a process. See OutputHub.Subscribe.
+func (pm *ProcessManager) SubscribeOutput(name string, streams []string, replay int, after uint64) (*Subscription, []models.OutputLine, error) {
+	pm.mu.RLock()
+	_, ok := pm.processes[name]
+	pm.mu.RUnlock()
+	if !ok {
+		return nil, nil, ErrProcessNotFound
+	}
+
+	sub, backlog := pm.output.Subscribe(name, streams, replay, after)
+	return sub, backlog, nil
+}
+
+func (pm *ProcessManager) UnsubscribeOutput(sub *Subscription) {
+	pm.output.Unsubscribe(sub)
+}
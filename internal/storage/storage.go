@@ -2,6 +2,7 @@ package storage
 
 import (
 	"database/sql"
+	"math"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -23,6 +24,94 @@ type CrashRecord struct {
 	StartedAt   time.Time `json:"started_at"`
 	CrashedAt   time.Time `json:"crashed_at"`
 	Uptime      string    `json:"uptime"`
+	Reason      string    `json:"reason"`
+}
+
+// Crash reasons
+const (
+	CrashReasonExit      = "exit"
+	CrashReasonUnhealthy = "unhealthy"
+	CrashReasonLimit     = "limit"
+	CrashReasonOOM       = "oom"
+)
+
+// JobRun is one run of a scheduled program, recorded when it ends
+type JobRun struct {
+	ID          int64     `json:"id"`
+	ProcessName string    `json:"process_name"`
+	Trigger     string    `json:"trigger"`
+	Status      string    `json:"status"`
+	ExitCode    int       `json:"exit_code"`
+	Signal      string    `json:"signal,omitempty"`
+	Stdout      string    `json:"stdout,omitempty"`
+	Stderr      string    `json:"stderr,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	Duration    string    `json:"duration"`
+}
+
+// Job run statuses
+const (
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+	JobRunStopped   = "stopped"
+)
+
+// ProgramChange records a program definition created, updated or deleted
+// through the API. Before and After hold the definition as YAML and are
+// empty for creations and deletions respectively.
+type ProgramChange struct {
+	ID        int64     `json:"id"`
+	Program   string    `json:"program"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	Before    string    `json:"before,omitempty"`
+	After     string    `json:"after,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Program change actions
+const (
+	ProgramCreated = "create"
+	ProgramUpdated = "update"
+	ProgramDeleted = "delete"
+)
+
+// AuditEntry records one call that changed something: who made it, from
+// where, what it was applied to and how it ended.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	Actor      string    `json:"actor"`
+	Source     string    `json:"source"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target,omitempty"`
+	Params     string    `json:"params,omitempty"`
+	Status     int       `json:"status"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Audit results
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditFilter selects audit entries. Empty fields match everything; Action
+// and Target match substrings.
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	Result string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
 }
 
 // Settings represents user settings
@@ -33,6 +122,40 @@ type Settings struct {
 	UpdatedAt string `json:"updated_at"`
 }
 
+// APIToken is a bearer token for API access. Only a hash of the secret is
+// stored.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// ProcessSample is one resource usage measurement of a process. Resolution
+// is 0 for raw samples and the bucket size in seconds for downsampled ones.
+type ProcessSample struct {
+	ProcessName string
+	Timestamp   time.Time
+	Resolution  int
+	CPUPercent  float64
+	RSSBytes    int64
+	Threads     int
+	OpenFDs     int
+}
+
+// MetricPoint is the average resource usage of a process over one step of a
+// time series.
+type MetricPoint struct {
+	Timestamp   time.Time `json:"timestamp"`
+	CPUPercent  float64   `json:"cpu_percent"`
+	RSSBytes    int64     `json:"rss_bytes"`
+	MaxRSSBytes int64     `json:"max_rss_bytes"`
+	Threads     int       `json:"threads"`
+	OpenFDs     int       `json:"open_fds"`
+}
+
 // ErrorLog represents a system error log
 type ErrorLog struct {
 	ID        int64     `json:"id"`
@@ -96,9 +219,110 @@ func (s *Storage) migrate() error {
 
 	CREATE INDEX IF NOT EXISTS idx_errors_time ON error_logs(created_at DESC);
 	CREATE INDEX IF NOT EXISTS idx_errors_level ON error_logs(level);
+
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		role TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		expires_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS process_samples (
+		process_name TEXT NOT NULL,
+		ts INTEGER NOT NULL,
+		resolution INTEGER NOT NULL DEFAULT 0,
+		cpu_percent REAL NOT NULL,
+		rss_bytes INTEGER NOT NULL,
+		threads INTEGER NOT NULL,
+		open_fds INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_samples_process_ts ON process_samples(process_name, ts);
+	CREATE INDEX IF NOT EXISTS idx_samples_ts ON process_samples(ts);
+
+	CREATE TABLE IF NOT EXISTS job_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		process_name TEXT NOT NULL,
+		trigger TEXT NOT NULL,
+		status TEXT NOT NULL,
+		exit_code INTEGER,
+		signal TEXT,
+		stdout TEXT,
+		stderr TEXT,
+		started_at DATETIME,
+		ended_at DATETIME,
+		duration TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_job_runs_process ON job_runs(process_name, started_at DESC);
+
+	CREATE TABLE IF NOT EXISTS program_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		program TEXT NOT NULL,
+		action TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		before TEXT,
+		after TEXT,
+		changed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_program_changes_program ON program_changes(program, id DESC);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor TEXT NOT NULL,
+		source TEXT,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target TEXT,
+		params TEXT,
+		status INTEGER NOT NULL,
+		result TEXT NOT NULL,
+		error TEXT,
+		duration_ms INTEGER NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_time ON audit_log(created_at DESC);
+	CREATE INDEX IF NOT EXISTS idx_audit_actor ON audit_log(actor, created_at DESC);
 	`
 
-	_, err := s.db.Exec(schema)
+	if _, err := s.db.Exec(schema); err != nil {
+		return err
+	}
+
+	return s.addColumn("crashes", "reason", "TEXT NOT NULL DEFAULT 'exit'")
+}
+
+// addColumn adds a column to an existing table unless it is already there.
+func (s *Storage) addColumn(table, column, definition string) error {
+	rows, err := s.db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = s.db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
 	return err
 }
 
@@ -110,9 +334,12 @@ func (s *Storage) Close() error {
 
 func (s *Storage) SaveCrash(crash *CrashRecord) error {
 	query := `
-		INSERT INTO crashes (process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO crashes (process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
+	if crash.Reason == "" {
+		crash.Reason = CrashReasonExit
+	}
 	result, err := s.db.Exec(query,
 		crash.ProcessName,
 		crash.ExitCode,
@@ -123,6 +350,7 @@ func (s *Storage) SaveCrash(crash *CrashRecord) error {
 		crash.StartedAt,
 		crash.CrashedAt,
 		crash.Uptime,
+		crash.Reason,
 	)
 	if err != nil {
 		return err
@@ -134,7 +362,7 @@ func (s *Storage) SaveCrash(crash *CrashRecord) error {
 
 func (s *Storage) GetCrashes(limit int) ([]CrashRecord, error) {
 	query := `
-		SELECT id, process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime
+		SELECT id, process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime, reason
 		FROM crashes
 		ORDER BY crashed_at DESC
 		LIMIT ?
@@ -152,7 +380,7 @@ func (s *Storage) GetCrashes(limit int) ([]CrashRecord, error) {
 		var startedAt, crashedAt sql.NullTime
 		var uptime sql.NullString
 
-		err := rows.Scan(&c.ID, &c.ProcessName, &c.ExitCode, &signal, &errMsg, &stdout, &stderr, &startedAt, &crashedAt, &uptime)
+		err := rows.Scan(&c.ID, &c.ProcessName, &c.ExitCode, &signal, &errMsg, &stdout, &stderr, &startedAt, &crashedAt, &uptime, &c.Reason)
 		if err != nil {
 			return nil, err
 		}
@@ -177,7 +405,7 @@ func (s *Storage) GetCrashes(limit int) ([]CrashRecord, error) {
 
 func (s *Storage) GetCrashesByProcess(processName string, limit int) ([]CrashRecord, error) {
 	query := `
-		SELECT id, process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime
+		SELECT id, process_name, exit_code, signal, error_message, stdout, stderr, started_at, crashed_at, uptime, reason
 		FROM crashes
 		WHERE process_name = ?
 		ORDER BY crashed_at DESC
@@ -196,7 +424,7 @@ func (s *Storage) GetCrashesByProcess(processName string, limit int) ([]CrashRec
 		var startedAt, crashedAt sql.NullTime
 		var uptime sql.NullString
 
-		err := rows.Scan(&c.ID, &c.ProcessName, &c.ExitCode, &signal, &errMsg, &stdout, &stderr, &startedAt, &crashedAt, &uptime)
+		err := rows.Scan(&c.ID, &c.ProcessName, &c.ExitCode, &signal, &errMsg, &stdout, &stderr, &startedAt, &crashedAt, &uptime, &c.Reason)
 		if err != nil {
 			return nil, err
 		}
@@ -245,6 +473,212 @@ func (s *Storage) GetCrashStats() (map[string]int, error) {
 	return stats, rows.Err()
 }
 
+// Job run operations
+
+// SaveJobRun stores a run and drops the oldest runs of the process beyond
+// keep.
+func (s *Storage) SaveJobRun(run *JobRun, keep int) error {
+	result, err := s.db.Exec(`
+		INSERT INTO job_runs (process_name, trigger, status, exit_code, signal, stdout, stderr, started_at, ended_at, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		run.ProcessName, run.Trigger, run.Status, run.ExitCode, run.Signal,
+		run.Stdout, run.Stderr, run.StartedAt, run.EndedAt, run.Duration,
+	)
+	if err != nil {
+		return err
+	}
+	run.ID, _ = result.LastInsertId()
+
+	_, err = s.db.Exec(`
+		DELETE FROM job_runs
+		WHERE process_name = ? AND id NOT IN (
+			SELECT id FROM job_runs WHERE process_name = ? ORDER BY id DESC LIMIT ?
+		)
+	`, run.ProcessName, run.ProcessName, keep)
+	return err
+}
+
+// GetJobRuns returns the latest runs of a process, newest first.
+func (s *Storage) GetJobRuns(processName string, limit int) ([]JobRun, error) {
+	rows, err := s.db.Query(`
+		SELECT id, process_name, trigger, status, exit_code, signal, stdout, stderr, started_at, ended_at, duration
+		FROM job_runs
+		WHERE process_name = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, processName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		var r JobRun
+		var signal, stdout, stderr, duration sql.NullString
+		var startedAt, endedAt sql.NullTime
+		if err := rows.Scan(&r.ID, &r.ProcessName, &r.Trigger, &r.Status, &r.ExitCode, &signal, &stdout, &stderr, &startedAt, &endedAt, &duration); err != nil {
+			return nil, err
+		}
+
+		r.Signal = signal.String
+		r.Stdout = stdout.String
+		r.Stderr = stderr.String
+		r.Duration = duration.String
+		if startedAt.Valid {
+			r.StartedAt = startedAt.Time
+		}
+		if endedAt.Valid {
+			r.EndedAt = endedAt.Time
+		}
+		runs = append(runs, r)
+	}
+
+	return runs, rows.Err()
+}
+
+// Program change operations
+
+func (s *Storage) SaveProgramChange(change *ProgramChange) error {
+	if change.ChangedAt.IsZero() {
+		change.ChangedAt = time.Now()
+	}
+	result, err := s.db.Exec(`
+		INSERT INTO program_changes (program, action, actor, before, after, changed_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, change.Program, change.Action, change.Actor, change.Before, change.After, change.ChangedAt)
+	if err != nil {
+		return err
+	}
+	change.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetProgramChanges returns the latest changes of a program, newest first.
+// An empty program returns the changes of all programs.
+func (s *Storage) GetProgramChanges(program string, limit int) ([]ProgramChange, error) {
+	rows, err := s.db.Query(`
+		SELECT id, program, action, actor, before, after, changed_at
+		FROM program_changes
+		WHERE ? = '' OR program = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, program, program, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []ProgramChange{}
+	for rows.Next() {
+		var c ProgramChange
+		var before, after sql.NullString
+		var changedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.Program, &c.Action, &c.Actor, &before, &after, &changedAt); err != nil {
+			return nil, err
+		}
+
+		c.Before = before.String
+		c.After = after.String
+		if changedAt.Valid {
+			c.ChangedAt = changedAt.Time
+		}
+		changes = append(changes, c)
+	}
+
+	return changes, rows.Err()
+}
+
+// Audit operations
+
+func (s *Storage) SaveAuditEntry(entry *AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	// Stored in UTC so that time filters compare correctly as text
+	entry.CreatedAt = entry.CreatedAt.UTC()
+	result, err := s.db.Exec(`
+		INSERT INTO audit_log (actor, source, method, path, action, target, params, status, result, error, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.Actor, entry.Source, entry.Method, entry.Path, entry.Action, entry.Target, entry.Params,
+		entry.Status, entry.Result, entry.Error, entry.DurationMs, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetAuditEntries returns the audit entries matching filter, newest first,
+// and the number of matching entries without Limit and Offset.
+func (s *Storage) GetAuditEntries(filter AuditFilter) ([]AuditEntry, int, error) {
+	where := "WHERE 1 = 1"
+	var args []interface{}
+	if filter.Actor != "" {
+		where += " AND actor = ?"
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		where += " AND instr(action, ?) > 0"
+		args = append(args, filter.Action)
+	}
+	if filter.Target != "" {
+		where += " AND instr(target, ?) > 0"
+		args = append(args, filter.Target)
+	}
+	if filter.Result != "" {
+		where += " AND result = ?"
+		args = append(args, filter.Result)
+	}
+	if !filter.Since.IsZero() {
+		where += " AND created_at >= ?"
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		where += " AND created_at < ?"
+		args = append(args, filter.Until.UTC())
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM audit_log "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, actor, source, method, path, action, target, params, status, result, error, duration_ms, created_at
+		FROM audit_log `+where+`
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var source, target, params, errMsg sql.NullString
+		var createdAt sql.NullTime
+		if err := rows.Scan(&e.ID, &e.Actor, &source, &e.Method, &e.Path, &e.Action, &target, &params,
+			&e.Status, &e.Result, &errMsg, &e.DurationMs, &createdAt); err != nil {
+			return nil, 0, err
+		}
+
+		e.Source = source.String
+		e.Target = target.String
+		e.Params = params.String
+		e.Error = errMsg.String
+		if createdAt.Valid {
+			e.CreatedAt = createdAt.Time
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, total, rows.Err()
+}
+
 // Settings operations
 
 func (s *Storage) GetSetting(key string) (string, error) {
@@ -288,6 +722,207 @@ func (s *Storage) GetAllSettings() (map[string]string, error) {
 	return settings, rows.Err()
 }
 
+// API token operations
+
+func (s *Storage) CreateAPIToken(token *APIToken, tokenHash string) error {
+	token.CreatedAt = time.Now()
+	result, err := s.db.Exec(
+		"INSERT INTO api_tokens (name, role, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		token.Name, token.Role, tokenHash, token.CreatedAt, token.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	token.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetAPITokenByHash returns the token with the given hash, or nil if there
+// is none.
+func (s *Storage) GetAPITokenByHash(tokenHash string) (*APIToken, error) {
+	row := s.db.QueryRow(
+		"SELECT id, name, role, created_at, last_used_at, expires_at FROM api_tokens WHERE token_hash = ?",
+		tokenHash,
+	)
+
+	token, err := scanAPIToken(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return token, err
+}
+
+func (s *Storage) GetAPITokens() ([]APIToken, error) {
+	rows, err := s.db.Query("SELECT id, name, role, created_at, last_used_at, expires_at FROM api_tokens ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// DeleteAPIToken removes a token and reports whether it existed.
+func (s *Storage) DeleteAPIToken(id int64) (bool, error) {
+	result, err := s.db.Exec("DELETE FROM api_tokens WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Storage) TouchAPIToken(id int64, at time.Time) error {
+	_, err := s.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", at, id)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	var t APIToken
+	var createdAt, lastUsedAt, expiresAt sql.NullTime
+	if err := row.Scan(&t.ID, &t.Name, &t.Role, &createdAt, &lastUsedAt, &expiresAt); err != nil {
+		return nil, err
+	}
+
+	if createdAt.Valid {
+		t.CreatedAt = createdAt.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	return &t, nil
+}
+
+// Process sample operations
+
+func (s *Storage) SaveProcessSamples(samples []ProcessSample) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO process_samples (process_name, ts, resolution, cpu_percent, rss_bytes, threads, open_fds)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, sample := range samples {
+		if _, err := stmt.Exec(
+			sample.ProcessName, sample.Timestamp.Unix(), sample.Resolution,
+			sample.CPUPercent, sample.RSSBytes, sample.Threads, sample.OpenFDs,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetProcessMetrics returns the samples of a process between from and to,
+// averaged over buckets of step.
+func (s *Storage) GetProcessMetrics(processName string, from, to time.Time, step time.Duration) ([]MetricPoint, error) {
+	stepSeconds := int64(step.Seconds())
+	if stepSeconds < 1 {
+		stepSeconds = 1
+	}
+
+	rows, err := s.db.Query(`
+		SELECT (ts / ?) * ? AS bucket, AVG(cpu_percent), AVG(rss_bytes), MAX(rss_bytes), AVG(threads), AVG(open_fds)
+		FROM process_samples
+		WHERE process_name = ? AND ts >= ? AND ts <= ?
+		GROUP BY bucket
+		ORDER BY bucket
+	`, stepSeconds, stepSeconds, processName, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []MetricPoint{}
+	for rows.Next() {
+		var bucket int64
+		var cpu, rss, threads, fds float64
+		var maxRSS int64
+		if err := rows.Scan(&bucket, &cpu, &rss, &maxRSS, &threads, &fds); err != nil {
+			return nil, err
+		}
+		points = append(points, MetricPoint{
+			Timestamp:   time.Unix(bucket, 0),
+			CPUPercent:  math.Round(cpu*100) / 100,
+			RSSBytes:    int64(rss),
+			MaxRSSBytes: maxRSS,
+			Threads:     int(math.Round(threads)),
+			OpenFDs:     int(math.Round(fds)),
+		})
+	}
+
+	return points, rows.Err()
+}
+
+// DownsampleProcessSamples replaces samples older than before that are finer
+// than bucket with one averaged sample per process and bucket. It returns the
+// number of samples removed.
+func (s *Storage) DownsampleProcessSamples(before time.Time, bucket time.Duration) (int64, error) {
+	size := int64(bucket.Seconds())
+	// Only whole buckets, so a bucket is never averaged twice
+	cutoff := before.Unix() / size * size
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO process_samples (process_name, ts, resolution, cpu_percent, rss_bytes, threads, open_fds)
+		SELECT process_name, (ts / ?) * ?, ?, AVG(cpu_percent), CAST(AVG(rss_bytes) AS INTEGER),
+			CAST(ROUND(AVG(threads)) AS INTEGER), CAST(ROUND(AVG(open_fds)) AS INTEGER)
+		FROM process_samples
+		WHERE resolution < ? AND ts < ?
+		GROUP BY process_name, ts / ?
+	`, size, size, size, size, cutoff, size); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("DELETE FROM process_samples WHERE resolution < ? AND ts < ?", size, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	removed, _ := result.RowsAffected()
+
+	return removed, tx.Commit()
+}
+
+func (s *Storage) DeleteProcessSamplesBefore(before time.Time) (int64, error) {
+	result, err := s.db.Exec("DELETE FROM process_samples WHERE ts < ?", before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // Error log operations
 
 func (s *Storage) SaveError(level, source, message string) error {
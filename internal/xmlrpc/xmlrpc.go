@@ -0,0 +1,318 @@
+// Package xmlrpc decodes XML-RPC method calls and encodes responses and
+// faults, as far as needed to serve supervisord's XML-RPC interface.
+//
+// Values decode to int, bool, string, float64, []interface{} (array),
+// map[string]interface{} (struct) and nil. The same types, plus int64,
+// []string and []map[string]interface{}, can be encoded.
+package xmlrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fault is an XML-RPC fault response.
+type Fault struct {
+	Code   int
+	String string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("fault %d: %s", f.Code, f.String)
+}
+
+var errMalformed = errors.New("malformed XML-RPC request")
+
+// DecodeCall reads a methodCall.
+func DecodeCall(r io.Reader) (method string, params []interface{}, err error) {
+	d := xml.NewDecoder(r)
+	inCall := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "methodCall":
+			inCall = true
+		case "methodName":
+			if method, err = text(d); err != nil {
+				return "", nil, err
+			}
+			method = strings.TrimSpace(method)
+		case "value":
+			v, err := decodeValue(d)
+			if err != nil {
+				return "", nil, err
+			}
+			params = append(params, v)
+		}
+	}
+	if !inCall || method == "" {
+		return "", nil, errMalformed
+	}
+	return method, params, nil
+}
+
+// text reads the character data up to the end of the current element.
+func text(d *xml.Decoder) (string, error) {
+	var b strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			b.Write(t)
+		case xml.EndElement:
+			return b.String(), nil
+		case xml.StartElement:
+			return "", errMalformed
+		}
+	}
+}
+
+// decodeValue decodes the contents of a <value> element, whose start tag was
+// just read, including its end tag.
+func decodeValue(d *xml.Decoder) (interface{}, error) {
+	var chars strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			chars.Write(t)
+		case xml.EndElement:
+			// A value without a type element is a string
+			return chars.String(), nil
+		case xml.StartElement:
+			v, err := decodeTyped(d, t.Name.Local)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.Skip(); err != nil {
+				return nil, err
+			}
+			return v, nil
+		}
+	}
+}
+
+func decodeTyped(d *xml.Decoder, kind string) (interface{}, error) {
+	switch kind {
+	case "array":
+		return decodeArray(d)
+	case "struct":
+		return decodeStruct(d)
+	case "nil":
+		return nil, d.Skip()
+	}
+
+	s, err := text(d)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "string", "dateTime.iso8601":
+		return s, nil
+	case "int", "i4", "i8":
+		return strconv.Atoi(strings.TrimSpace(s))
+	case "boolean":
+		switch strings.TrimSpace(s) {
+		case "1":
+			return true, nil
+		case "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid boolean %q", s)
+	case "double":
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case "base64":
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		return string(data), err
+	}
+	return nil, fmt.Errorf("unsupported type %q", kind)
+}
+
+func decodeArray(d *xml.Decoder) (interface{}, error) {
+	values := []interface{}{}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "value" {
+				v, err := decodeValue(d)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, v)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "array" {
+				return values, nil
+			}
+		}
+	}
+}
+
+func decodeStruct(d *xml.Decoder) (interface{}, error) {
+	members := map[string]interface{}{}
+	var name string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "name":
+				if name, err = text(d); err != nil {
+					return nil, err
+				}
+			case "value":
+				v, err := decodeValue(d)
+				if err != nil {
+					return nil, err
+				}
+				members[name] = v
+			}
+		case xml.EndElement:
+			if t.Name.Local == "struct" {
+				return members, nil
+			}
+		}
+	}
+}
+
+// EncodeResponse writes a methodResponse holding result.
+func EncodeResponse(w io.Writer, result interface{}) error {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString("<methodResponse><params><param>")
+	if err := encodeValue(&b, result); err != nil {
+		return err
+	}
+	b.WriteString("</param></params></methodResponse>\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// EncodeFault writes a fault methodResponse.
+func EncodeFault(w io.Writer, f *Fault) error {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString("<methodResponse><fault>")
+	if err := encodeValue(&b, map[string]interface{}{
+		"faultCode":   f.Code,
+		"faultString": f.String,
+	}); err != nil {
+		return err
+	}
+	b.WriteString("</fault></methodResponse>\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func encodeValue(b *bytes.Buffer, v interface{}) error {
+	b.WriteString("<value>")
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("<nil/>")
+	case bool:
+		if v {
+			b.WriteString("<boolean>1</boolean>")
+		} else {
+			b.WriteString("<boolean>0</boolean>")
+		}
+	case int:
+		fmt.Fprintf(b, "<int>%d</int>", v)
+	case int64:
+		fmt.Fprintf(b, "<int>%d</int>", v)
+	case float64:
+		b.WriteString("<double>" + strconv.FormatFloat(v, 'f', -1, 64) + "</double>")
+	case string:
+		b.WriteString("<string>")
+		if err := xml.EscapeText(b, []byte(v)); err != nil {
+			return err
+		}
+		b.WriteString("</string>")
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		if err := encodeArray(b, items); err != nil {
+			return err
+		}
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, m := range v {
+			items[i] = m
+		}
+		if err := encodeArray(b, items); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := encodeArray(b, v); err != nil {
+			return err
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("<struct>")
+		for _, k := range keys {
+			b.WriteString("<member><name>")
+			if err := xml.EscapeText(b, []byte(k)); err != nil {
+				return err
+			}
+			b.WriteString("</name>")
+			if err := encodeValue(b, v[k]); err != nil {
+				return err
+			}
+			b.WriteString("</member>")
+		}
+		b.WriteString("</struct>")
+	default:
+		return fmt.Errorf("xmlrpc: cannot encode %T", v)
+	}
+	b.WriteString("</value>")
+	return nil
+}
+
+// encodeArray writes the <array> element of a value.
+func encodeArray(b *bytes.Buffer, items []interface{}) error {
+	b.WriteString("<array><data>")
+	for _, item := range items {
+		if err := encodeValue(b, item); err != nil {
+			return err
+		}
+	}
+	b.WriteString("</data></array>")
+	return nil
+}
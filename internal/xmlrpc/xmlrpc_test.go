@@ -0,0 +1,243 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func call(params string) string {
+	return `<?xml version="1.0"?><methodCall><methodName>supervisor.test</methodName><params>` + params + `</params></methodCall>`
+}
+
+func TestDecodeCall(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		method string
+		params []interface{}
+	}{
+		{
+			name:   "no params",
+			body:   `<methodCall><methodName> supervisor.getState </methodName></methodCall>`,
+			method: "supervisor.getState",
+		},
+		{
+			name:   "untyped value is a string",
+			body:   call(`<param><value>worker</value></param>`),
+			method: "supervisor.test",
+			params: []interface{}{"worker"},
+		},
+		{
+			name: "scalars",
+			body: call(`<param><value><string>a b</string></value></param>` +
+				`<param><value><int> 42 </int></value></param>` +
+				`<param><value><i4>-7</i4></value></param>` +
+				`<param><value><i8>9</i8></value></param>` +
+				`<param><value><boolean>1</boolean></value></param>` +
+				`<param><value><boolean>0</boolean></value></param>` +
+				`<param><value><double>1.5</double></value></param>` +
+				`<param><value><base64>aGVsbG8=</base64></value></param>` +
+				`<param><value><dateTime.iso8601>20240101T00:00:00</dateTime.iso8601></value></param>` +
+				`<param><value><nil/></value></param>`),
+			method: "supervisor.test",
+			params: []interface{}{"a b", 42, -7, 9, true, false, 1.5, "hello", "20240101T00:00:00", nil},
+		},
+		{
+			name:   "escaped text",
+			body:   call(`<param><value><string>&lt;tag&gt; &amp; &quot;q&quot;</string></value></param>`),
+			method: "supervisor.test",
+			params: []interface{}{`<tag> & "q"`},
+		},
+		{
+			name:   "empty string",
+			body:   call(`<param><value><string></string></value></param>`),
+			method: "supervisor.test",
+			params: []interface{}{""},
+		},
+		{
+			name: "array and struct",
+			body: call(`<param><value><array><data>` +
+				`<value><int>1</int></value><value>two</value>` +
+				`<value><struct><member><name>k</name><value><boolean>1</boolean></value></member></struct></value>` +
+				`</data></array></value></param>`),
+			method: "supervisor.test",
+			params: []interface{}{[]interface{}{1, "two", map[string]interface{}{"k": true}}},
+		},
+		{
+			name:   "empty array",
+			body:   call(`<param><value><array><data></data></array></value></param>`),
+			method: "supervisor.test",
+			params: []interface{}{[]interface{}{}},
+		},
+		{
+			name: "nested struct",
+			body: call(`<param><value><struct>` +
+				`<member><name>name</name><value><string>web</string></value></member>` +
+				`<member><name>env</name><value><struct><member><name>A</name><value>1</value></member></struct></value></member>` +
+				`</struct></value></param>`),
+			method: "supervisor.test",
+			params: []interface{}{map[string]interface{}{
+				"name": "web",
+				"env":  map[string]interface{}{"A": "1"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, params, err := DecodeCall(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("DecodeCall: %v", err)
+			}
+			if method != tt.method {
+				t.Errorf("method = %q, want %q", method, tt.method)
+			}
+			if !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("params = %#v, want %#v", params, tt.params)
+			}
+		})
+	}
+}
+
+func TestDecodeCallErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty", ``},
+		{"not a call", `<methodResponse><params></params></methodResponse>`},
+		{"no method name", `<methodCall><params></params></methodCall>`},
+		{"element in method name", `<methodCall><methodName><b>x</b></methodName></methodCall>`},
+		{"invalid int", call(`<param><value><int>x</int></value></param>`)},
+		{"invalid boolean", call(`<param><value><boolean>yes</boolean></value></param>`)},
+		{"invalid base64", call(`<param><value><base64>!!</base64></value></param>`)},
+		{"unsupported type", call(`<param><value><blob>x</blob></value></param>`)},
+		{"truncated", `<methodCall><methodName>x</methodName><params><param><value><array><data>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := DecodeCall(strings.NewReader(tt.body)); err == nil {
+				t.Error("DecodeCall succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestEncodeResponse(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"nil", nil, `<value><nil/></value>`},
+		{"bool", true, `<value><boolean>1</boolean></value>`},
+		{"int", 3, `<value><int>3</int></value>`},
+		{"int64", int64(1) << 40, `<value><int>1099511627776</int></value>`},
+		{"double", 0.25, `<value><double>0.25</double></value>`},
+		{"escaped string", `a<b & "c"`, `<value><string>a&lt;b &amp; &#34;c&#34;</string></value>`},
+		{"strings", []string{"a", "b"}, `<value><array><data><value><string>a</string></value><value><string>b</string></value></data></array></value>`},
+		{
+			"struct with sorted members",
+			map[string]interface{}{"b": 1, "a": "x"},
+			`<value><struct><member><name>a</name><value><string>x</string></value></member><member><name>b</name><value><int>1</int></value></member></struct></value>`,
+		},
+		{
+			"structs",
+			[]map[string]interface{}{{"n": 1}},
+			`<value><array><data><value><struct><member><name>n</name><value><int>1</int></value></member></struct></value></data></array></value>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeResponse(&buf, tt.value); err != nil {
+				t.Fatalf("EncodeResponse: %v", err)
+			}
+			want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<methodResponse><params><param>` + tt.want + `</param></params></methodResponse>` + "\n"
+			if buf.String() != want {
+				t.Errorf("got  %s\nwant %s", buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestEncodeUnsupported(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeResponse(&buf, struct{}{}); err == nil {
+		t.Error("EncodeResponse succeeded for a struct{}, want an error")
+	}
+}
+
+func TestEncodeFault(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeFault(&buf, &Fault{Code: 10, String: "BAD_NAME: <web>"}); err != nil {
+		t.Fatalf("EncodeFault: %v", err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<methodResponse><fault><value><struct>` +
+		`<member><name>faultCode</name><value><int>10</int></value></member>` +
+		`<member><name>faultString</name><value><string>BAD_NAME: &lt;web&gt;</string></value></member>` +
+		`</struct></value></fault></methodResponse>` + "\n"
+	if buf.String() != want {
+		t.Errorf("got  %s\nwant %s", buf.String(), want)
+	}
+}
+
+// TestRoundTrip encodes values and decodes them again as call parameters.
+// Types without an XML-RPC counterpart come back as their decoded type.
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"string", "line 1\nline 2 & <3>", "line 1\nline 2 & <3>"},
+		{"unicode", "процесс ✓", "процесс ✓"},
+		{"int64", int64(5), 5},
+		{"negative double", -2.5, -2.5},
+		{"nil", nil, nil},
+		{"strings", []string{"x"}, []interface{}{"x"}},
+		{
+			"nested",
+			map[string]interface{}{
+				"name":   "web:web_00",
+				"state":  20,
+				"ok":     false,
+				"groups": []interface{}{"a", map[string]interface{}{"n": 1.5}},
+			},
+			map[string]interface{}{
+				"name":   "web:web_00",
+				"state":  20,
+				"ok":     false,
+				"groups": []interface{}{"a", map[string]interface{}{"n": 1.5}},
+			},
+		},
+		{
+			"fault struct",
+			map[string]interface{}{"faultCode": 70, "faultString": "NOT_RUNNING"},
+			map[string]interface{}{"faultCode": 70, "faultString": "NOT_RUNNING"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value bytes.Buffer
+			if err := encodeValue(&value, tt.value); err != nil {
+				t.Fatalf("encodeValue: %v", err)
+			}
+
+			_, params, err := DecodeCall(strings.NewReader(call("<param>" + value.String() + "</param>")))
+			if err != nil {
+				t.Fatalf("DecodeCall: %v", err)
+			}
+			if len(params) != 1 || !reflect.DeepEqual(params[0], tt.want) {
+				t.Errorf("decoded %#v, want %#v", params, []interface{}{tt.want})
+			}
+		})
+	}
+}